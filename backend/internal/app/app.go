@@ -27,12 +27,16 @@ func Run(cfg *config.Config) {
 		logger.Fatal("unable initialize data sources : %v", err)
 	}
 
-	router, err := inject(ds, *cfg)
+	router, workers, err := inject(ds, *cfg)
 
 	if err != nil {
 		logger.Fatal("failure to inject data sources: %v\n", err)
 	}
 
+	for _, w := range workers {
+		w.start()
+	}
+
 	httpServer := httpserver.New(httpserver.SConfig{
 		Hendler: router,
 		Addr:    fmt.Sprintf("%s:%s", cfg.HTTPHost, cfg.HTTPPort),
@@ -54,6 +58,10 @@ func Run(cfg *config.Config) {
 		logger.Error("error http server shutdown: %w", err)
 	}
 
+	for _, w := range workers {
+		w.stop()
+	}
+
 	if err := ds.close(); err != nil {
 		logger.Error("error data sourse close: %w", err)
 	}
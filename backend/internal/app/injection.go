@@ -1,40 +1,45 @@
 package app
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"time"
 
 	"github.com/Kara4ev/go-web-tmp/internal/config"
 	"github.com/Kara4ev/go-web-tmp/internal/handler"
+	"github.com/Kara4ev/go-web-tmp/internal/model"
 	"github.com/Kara4ev/go-web-tmp/internal/repository"
 	"github.com/Kara4ev/go-web-tmp/internal/service"
 	"github.com/Kara4ev/go-web-tmp/pkg/logger"
-	"github.com/dgrijalva/jwt-go"
+	"github.com/Kara4ev/go-web-tmp/pkg/mailer"
 	"github.com/gin-gonic/gin"
 )
 
-func inject(d *dataSource, cfg config.Config) (*gin.Engine, error) {
+func inject(d *dataSource, cfg config.Config) (*gin.Engine, []*worker, error) {
 	logger.Debug("injecting data source")
 
 	/*
 	*	init
 	 */
 
-	// load rsa key
+	// load the signing key, rsa, ecdsa p-256 or ed25519
 	logger.Debug("read private key")
 	priv, err := ioutil.ReadFile(cfg.AppPrivateKeyFile)
 	if err != nil {
 		logger.Debug("could not read private key pem file: %w", err)
-		return nil, fmt.Errorf("could not read private key pem file: %w", err)
+		return nil, nil, fmt.Errorf("could not read private key pem file: %w", err)
 	}
 
 	logger.Debug("parse private key")
-	privKey, err := jwt.ParseRSAPrivateKeyFromPEM(priv)
+	privKey, err := service.ParsePrivateKeyPEM(priv)
 
 	if err != nil {
 		logger.Debug("could not parse private key: %w", err)
-		return nil, fmt.Errorf("could not parse private key: %w", err)
+		return nil, nil, fmt.Errorf("could not parse private key: %w", err)
 	}
 
 	logger.Debug("read public key")
@@ -42,60 +47,242 @@ func inject(d *dataSource, cfg config.Config) (*gin.Engine, error) {
 
 	if err != nil {
 		logger.Debug("could not read public key pem file: %w", err)
-		return nil, fmt.Errorf("could not read public key pem file: %w", err)
+		return nil, nil, fmt.Errorf("could not read public key pem file: %w", err)
 	}
 
 	logger.Debug("parse public key")
-	pubKey, err := jwt.ParseRSAPublicKeyFromPEM(pub)
+	pubKey, err := service.ParsePublicKeyPEM(pub)
 
 	if err != nil {
 		logger.Debug("could not parse public key: %w", err)
-		return nil, fmt.Errorf("could not parse public key: %w", err)
+		return nil, nil, fmt.Errorf("could not parse public key: %w", err)
+	}
+
+	if signer, ok := privKey.(crypto.Signer); !ok || !pubKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(signer.Public()) {
+		return nil, nil, fmt.Errorf("public key does not match the private key")
+	}
+
+	var retiredPubKeys []crypto.PublicKey
+	for _, file := range cfg.AppRetiredPublicKeyFiles {
+		logger.Debug("read retired public key: %s", file)
+		pub, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read retired public key pem file: %s: %w", file, err)
+		}
+
+		retiredPubKey, err := service.ParsePublicKeyPEM(pub)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not parse retired public key: %s: %w", file, err)
+		}
+		retiredPubKeys = append(retiredPubKeys, retiredPubKey)
+	}
+
+	if cfg.AppRefreshTokenFormat != "jwt" && cfg.AppRefreshTokenFormat != "opaque" {
+		return nil, nil, fmt.Errorf("refresh token format must be jwt or opaque, got: %q", cfg.AppRefreshTokenFormat)
+	}
+
+	// mfa secrets key
+	mfaKey, err := hex.DecodeString(cfg.AppMFAKey)
+	if err != nil || len(mfaKey) != 32 {
+		logger.Debug("mfa key must be hex encoded 32 bytes")
+		return nil, nil, fmt.Errorf("mfa key must be hex encoded 32 bytes")
+	}
+	if bytes.Equal(mfaKey, make([]byte, len(mfaKey))) {
+		logger.Debug("mfa key must not be zero")
+		return nil, nil, fmt.Errorf("mfa key must not be zero, set a random key in APP_MFA_KEY")
+	}
+
+	// mail sender
+	var mailSender model.MailSender
+	if cfg.MailHost != "" {
+		logger.Debug("create smtp mail sender")
+		mailSender = mailer.NewSMTP(mailer.SMTPConfig{
+			Host:     cfg.MailHost,
+			Port:     cfg.MailPort,
+			User:     cfg.MailUser,
+			Password: cfg.MailPassword,
+			From:     cfg.MailFrom,
+		})
+	} else {
+		logger.Debug("mail host is empty, mails are written to the log")
+		mailSender = mailer.NewLog()
 	}
 
 	// gin init
 	logger.Debug("create router")
 	router := gin.Default()
 
+	// gin trusts X-Forwarded-For of every peer by default, anyone could pick their ip
+	if err := router.SetTrustedProxies(cfg.HTTPTrustedProxies); err != nil {
+		return nil, nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
 	/*
 	* reposytory layer
 	 */
 	logger.Debug("create user repository")
 	userReposytory := repository.NewUserReposytory(d.DB)
 	toketRepository := repository.NewTokenRepository(d.Radis)
+	loginAttemptRepository := repository.NewLoginAttemptRepository(d.Radis)
+	var breachedPasswordRepository model.BreachedPasswordRepository
+	if cfg.AppBreachedPasswordsDir != "" {
+		breachedPasswordRepository = repository.NewBreachedPasswordRepository(cfg.AppBreachedPasswordsDir)
+	}
+	mfaRepository := repository.NewMFARepository(d.DB)
+	webAuthnRepository := repository.NewWebAuthnRepository(d.DB)
+	oauthClientRepository := repository.NewOAuthClientRepository(d.DB)
+	serviceAccountRepository := repository.NewServiceAccountRepository(d.DB)
+	roleRepository := repository.NewRoleRepository(d.DB)
+	dataExportRepository := repository.NewDataExportRepository(d.Radis)
+	securityEventRepository := repository.NewSecurityEventRepository(d.DB)
 
 	/*
 	* service layer
 	 */
 	logger.Debug("create user services")
 	userService := service.NewUserServices(&service.USConfig{
-		UserRepository: userReposytory,
+		UserRepository:              userReposytory,
+		TokenRepository:             toketRepository,
+		MailSender:                  mailSender,
+		RequireEmailVerification:    cfg.AppRequireEmailVerified,
+		VerifyEmailURL:              cfg.MailVerifyEmailURL,
+		VerifyEmailExpirationSecs:   cfg.AppVerifyEmailExpiration,
+		ResetPasswordURL:            cfg.MailResetPasswordURL,
+		ResetPasswordExpirationSecs: cfg.AppResetPasswordExpiration,
+		IDTokenExpirationSecs:       cfg.AppIDTokenExpiration,
+		LoginAttemptRepository:      loginAttemptRepository,
+		SigninMaxFailures:           cfg.AppSigninMaxFailures,
+		SigninIPMaxFailures:         cfg.AppSigninIPMaxFailures,
+		SigninFailureWindowSecs:     cfg.AppSigninFailureWindow,
+		SigninLockoutSecs:           cfg.AppSigninLockout,
+		MFARepository:               mfaRepository,
+		PasswordMinLength:           cfg.AppPasswordMinLength,
+		PasswordMaxLength:           cfg.AppPasswordMaxLength,
+		PasswordMinStrength:         cfg.AppPasswordMinStrength,
+		BreachedPasswordRepository:  breachedPasswordRepository,
+		DeletionGracePeriodSecs:     cfg.AppDeletionGracePeriod,
+		SecurityEventRepository:     securityEventRepository,
+	})
+
+	logger.Debug("create mfa services")
+	mfaService := service.NewMFAService(&service.MFAConfig{
+		MFARepository:           mfaRepository,
+		TokenRepository:         toketRepository,
+		Issuer:                  cfg.AppName,
+		SecretKey:               mfaKey,
+		ChallengeExpirationSecs: cfg.AppMFAChallengeExpiration,
+		UserRepository:          userReposytory,
+		LoginAttemptRepository:  loginAttemptRepository,
+		SigninMaxFailures:       cfg.AppSigninMaxFailures,
+		SigninIPMaxFailures:     cfg.AppSigninIPMaxFailures,
+		SigninFailureWindowSecs: cfg.AppSigninFailureWindow,
+		SigninLockoutSecs:       cfg.AppSigninLockout,
+		SecurityEventRepository: securityEventRepository,
+	})
+
+	logger.Debug("create webauthn services")
+	webAuthnService := service.NewWebAuthnService(&service.WebAuthnConfig{
+		WebAuthnRepository:      webAuthnRepository,
+		UserRepository:          userReposytory,
+		TokenRepository:         toketRepository,
+		RPID:                    cfg.WebAuthnRPID,
+		RPName:                  cfg.AppName,
+		Origin:                  cfg.WebAuthnOrigin,
+		TimeoutSecs:             cfg.WebAuthnTimeout,
+		SecurityEventRepository: securityEventRepository,
 	})
 
 	logger.Debug("create token services")
 	tokenService := service.NewTokenService(&service.TSConfig{
-		TokenRepository:       toketRepository,
-		PrivKey:               privKey,
-		PubKey:                pubKey,
-		RefreshSecret:         cfg.AppSecret,
-		RefrashExpirationSecs: cfg.AppRefreshTokenExpiration,
-		IDExpirationSecs:      cfg.AppIDTokenExpiration,
+		TokenRepository:         toketRepository,
+		RoleRepository:          roleRepository,
+		PrivKey:                 privKey,
+		PubKey:                  pubKey,
+		RetiredPubKeys:          retiredPubKeys,
+		Issuer:                  cfg.AppIssuer,
+		Audience:                cfg.AppAudience,
+		RefreshSecret:           cfg.AppSecret,
+		RefrashExpirationSecs:   cfg.AppRefreshTokenExpiration,
+		IDExpirationSecs:        cfg.AppIDTokenExpiration,
+		DenylistCacheTTLSecs:    cfg.AppDenylistCacheTTL,
+		OpaqueRefreshTokens:     cfg.AppRefreshTokenFormat == "opaque",
+		SecurityEventRepository: securityEventRepository,
+	})
+
+	logger.Debug("create oauth services")
+	oauthService := service.NewOAuthService(&service.OAuthConfig{
+		OAuthClientRepository:           oauthClientRepository,
+		ServiceAccountRepository:        serviceAccountRepository,
+		TokenRepository:                 toketRepository,
+		AuthorizationCodeExpirationSecs: cfg.AppAuthorizationCodeExpiration,
+	})
+
+	logger.Debug("create export services")
+	exportService := service.NewExportService(&service.ExportConfig{
+		UserRepository:          userReposytory,
+		RoleRepository:          roleRepository,
+		TokenRepository:         toketRepository,
+		MFARepository:           mfaRepository,
+		WebAuthnRepository:      webAuthnRepository,
+		DataExportRepository:    dataExportRepository,
+		SecurityEventRepository: securityEventRepository,
+		ExpirationSecs:          cfg.AppExportExpiration,
 	})
 
 	/*
 	* hendler layer
 	 */
 
+	var rateLimitStore model.RateLimitStore
+	switch cfg.RateLimitStore {
+	case "redis":
+		rateLimitStore = repository.NewRateLimitStore(d.Radis)
+	case "memory":
+		rateLimitStore = repository.NewMemoryRateLimitStore()
+	case "off":
+	default:
+		return nil, nil, fmt.Errorf("rate limit store must be redis, memory or off, got: %q", cfg.RateLimitStore)
+	}
+
 	logger.Debug("create handler")
 	handler.NewHandler(&handler.Config{
-		Router:          router,
-		UserService:     userService,
-		TokenService:    tokenService,
-		BaseUrl:         cfg.HTTPBaseURL,
-		TimeoutDuration: time.Duration(time.Duration(cfg.HTTPHendlerTimeOut) * time.Second),
+		Router:                   router,
+		UserService:              userService,
+		TokenService:             tokenService,
+		MFAService:               mfaService,
+		WebAuthnService:          webAuthnService,
+		OAuthService:             oauthService,
+		ExportService:            exportService,
+		BaseUrl:                  cfg.HTTPBaseURL,
+		Issuer:                   cfg.AppIssuer,
+		ConsentURL:               cfg.AppConsentURL,
+		TimeoutDuration:          time.Duration(time.Duration(cfg.HTTPHendlerTimeOut) * time.Second),
+		RequireEmailVerification: cfg.AppRequireEmailVerified,
+		CookieSessions:           cfg.AppCookieSessions,
+		CookieDomain:             cfg.AppCookieDomain,
+		AccessCookieMaxAge:       int(cfg.AppIDTokenExpiration),
+		RefreshCookieMaxAge:      int(cfg.AppRefreshTokenExpiration),
+		RateLimitStore:           rateLimitStore,
+		AuthRateLimit:            model.RateLimit{Rate: cfg.RateLimitAuthRate, Burst: cfg.RateLimitAuthBurst},
+		UserRateLimit:            model.RateLimit{Rate: cfg.RateLimitUserRate, Burst: cfg.RateLimitUserBurst},
+		ClientRateLimit:          model.RateLimit{Rate: cfg.RateLimitClientRate, Burst: cfg.RateLimitClientBurst},
 	})
 
+	/*
+	* background workers
+	 */
+	var workers []*worker
+	if cfg.AppPurgeInterval > 0 {
+		workers = append(workers, newWorker("purge deleted accounts", time.Duration(cfg.AppPurgeInterval)*time.Second, func(ctx context.Context) error {
+			n, err := userService.PurgeDeletedAccounts(ctx)
+			if n > 0 {
+				logger.Info("purged %d deleted accounts", n)
+			}
+			return err
+		}))
+	}
+
 	logger.Debug("data source injecting")
-	return router, nil
+	return router, workers, nil
 
 }
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+)
+
+// worker runs a background job of the app every interval until it is stopped
+type worker struct {
+	name     string
+	interval time.Duration
+	job      func(ctx context.Context) error
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func newWorker(name string, interval time.Duration, job func(ctx context.Context) error) *worker {
+	return &worker{
+		name:     name,
+		interval: interval,
+		job:      job,
+		done:     make(chan struct{}),
+	}
+}
+
+func (w *worker) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := w.job(ctx); err != nil {
+				logger.Warn("worker %s: job failed, err: %v", w.name, err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	logger.Debug("worker %s: started, interval: %v", w.name, w.interval)
+}
+
+// stop cancels the running job and waits for it to return
+func (w *worker) stop() {
+	if w.cancel == nil {
+		return
+	}
+
+	w.cancel()
+	<-w.done
+	logger.Debug("worker %s: stopped", w.name)
+}
@@ -8,23 +8,69 @@ import (
 
 type (
 	Config struct {
-		App      `yaml:"app"`
-		HTTP     `yaml:"http"`
-		Logger   `yaml:"logger"`
-		Postgres `yaml:"postgres"`
-		Redis    `yaml:"radis"`
+		App       `yaml:"app"`
+		HTTP      `yaml:"http"`
+		Logger    `yaml:"logger"`
+		Postgres  `yaml:"postgres"`
+		Redis     `yaml:"radis"`
+		Mail      `yaml:"mail"`
+		WebAuthn  `yaml:"webauthn"`
+		RateLimit `yaml:"rate_limit"`
 	}
 
 	App struct {
-		AppName                   string `yaml:"name" env-required:"true"`
-		AppVersion                string `yaml:"version" env-required:"true"`
-		AppDebug                  int    `yaml:"debug" env-required:"true" env:"APP_DEBUG"`
-		AppSecret                 string `yaml:"secret" env-required:"true" env:"APP_SECRET"`
-		AppPrivateKeyFile         string `yaml:"privat_key_file" env-required:"true" env:"APP_PRIV_KEY_FILE"`
-		AppPublicKeyFile          string `yaml:"pub_key_file" env-required:"true" env:"APP_PUB_KEY_FILE"`
-		AppLogFile                string `yaml:"log_file" env-required:"true" env:"APP_LOG_FILE"`
-		AppRefreshTokenExpiration int64  `yaml:"refresh_token_exp" env-required:"true" env:"APP_R_TOKEN_EXP"`
-		AppIDTokenExpiration      int64  `yaml:"id_token_exp" env-required:"true" env:"APP_R_TOKEN_EXP"`
+		AppName                    string `yaml:"name" env-required:"true"`
+		AppVersion                 string `yaml:"version" env-required:"true"`
+		AppDebug                   int    `yaml:"debug" env-required:"true" env:"APP_DEBUG"`
+		AppSecret                  string `yaml:"secret" env-required:"true" env:"APP_SECRET"`
+		AppPrivateKeyFile          string `yaml:"privat_key_file" env-required:"true" env:"APP_PRIV_KEY_FILE"`
+		AppPublicKeyFile           string `yaml:"pub_key_file" env-required:"true" env:"APP_PUB_KEY_FILE"`
+		AppLogFile                 string `yaml:"log_file" env-required:"true" env:"APP_LOG_FILE"`
+		AppRefreshTokenExpiration  int64  `yaml:"refresh_token_exp" env-required:"true" env:"APP_R_TOKEN_EXP"`
+		AppIDTokenExpiration       int64  `yaml:"id_token_exp" env-required:"true" env:"APP_R_TOKEN_EXP"`
+		AppVerifyEmailExpiration   int64  `yaml:"verify_email_token_exp" env-required:"true" env:"APP_VERIFY_EMAIL_TOKEN_EXP"`
+		AppResetPasswordExpiration int64  `yaml:"reset_password_token_exp" env-required:"true" env:"APP_RESET_PASSWORD_TOKEN_EXP"`
+		AppMFAKey                  string `yaml:"mfa_key" env-required:"true" env:"APP_MFA_KEY"`
+		AppMFAChallengeExpiration  int64  `yaml:"mfa_challenge_exp" env-required:"true" env:"APP_MFA_CHALLENGE_EXP"`
+		AppRequireEmailVerified    bool   `yaml:"require_email_verified" env:"APP_REQUIRE_EMAIL_VERIFIED"`
+
+		// AppRetiredPublicKeyFiles verify id tokens signed before the key rotation
+		AppRetiredPublicKeyFiles []string `yaml:"retired_pub_key_files" env:"APP_RETIRED_PUB_KEY_FILES"`
+		// AppIssuer is the OpenID Connect issuer, the public url the service is served from
+		AppIssuer   string `yaml:"issuer" env-required:"true" env:"APP_ISSUER"`
+		AppAudience string `yaml:"audience" env-required:"true" env:"APP_AUDIENCE"`
+
+		AppAuthorizationCodeExpiration int64 `yaml:"authorization_code_exp" env-required:"true" env:"APP_AUTHORIZATION_CODE_EXP"`
+		// AppConsentURL is the page where users sign in and consent to authorization requests of oauth clients
+		AppConsentURL string `yaml:"consent_url" env-required:"true" env:"APP_CONSENT_URL"`
+		// AppDenylistCacheTTL is how long an instance trusts that an id token is not revoked
+		AppDenylistCacheTTL int64 `yaml:"denylist_cache_ttl" env:"APP_DENYLIST_CACHE_TTL"`
+		// AppRefreshTokenFormat is jwt or opaque
+		AppRefreshTokenFormat string `yaml:"refresh_token_format" env:"APP_REFRESH_TOKEN_FORMAT" env-default:"jwt"`
+		// AppCookieSessions sets tokens as HttpOnly cookies for browser clients
+		AppCookieSessions bool   `yaml:"cookie_sessions" env:"APP_COOKIE_SESSIONS"`
+		AppCookieDomain   string `yaml:"cookie_domain" env:"APP_COOKIE_DOMAIN"`
+
+		// signin lockout, failures are counted per email and per ip within the window
+		AppSigninMaxFailures   int64 `yaml:"signin_max_failures" env:"APP_SIGNIN_MAX_FAILURES" env-default:"5"`
+		AppSigninIPMaxFailures int64 `yaml:"signin_ip_max_failures" env:"APP_SIGNIN_IP_MAX_FAILURES" env-default:"100"`
+		AppSigninFailureWindow int64 `yaml:"signin_failure_window" env:"APP_SIGNIN_FAILURE_WINDOW" env-default:"900"`
+		AppSigninLockout       int64 `yaml:"signin_lockout" env:"APP_SIGNIN_LOCKOUT" env-default:"900"`
+
+		// password policy, strength is a score from 0 to 4. AppBreachedPasswordsDir
+		// holds the Pwned Passwords ranges, a file per hash prefix, empty disables the check
+		AppPasswordMinLength    int    `yaml:"password_min_length" env:"APP_PASSWORD_MIN_LENGTH" env-default:"8"`
+		AppPasswordMaxLength    int    `yaml:"password_max_length" env:"APP_PASSWORD_MAX_LENGTH" env-default:"128"`
+		AppPasswordMinStrength  int    `yaml:"password_min_strength" env:"APP_PASSWORD_MIN_STRENGTH" env-default:"2"`
+		AppBreachedPasswordsDir string `yaml:"breached_passwords_dir" env:"APP_BREACHED_PASSWORDS_DIR"`
+
+		// deleted accounts can be reactivated by signin within the grace period,
+		// the purge worker deletes them every purge interval once it is over
+		AppDeletionGracePeriod int64 `yaml:"deletion_grace_period" env:"APP_DELETION_GRACE_PERIOD" env-default:"2592000"`
+		AppPurgeInterval       int64 `yaml:"purge_interval" env:"APP_PURGE_INTERVAL" env-default:"3600"`
+
+		// AppExportExpiration is how long the archive of a personal data export can be downloaded
+		AppExportExpiration int64 `yaml:"export_expiration" env:"APP_EXPORT_EXPIRATION" env-default:"86400"`
 	}
 
 	HTTP struct {
@@ -32,6 +78,9 @@ type (
 		HTTPPort           string `yaml:"port" env-required:"true" env:"HTTP_PORT"`
 		HTTPBaseURL        string `yaml:"base_url" env-required:"true" env:"HTTP_BASE_URL"`
 		HTTPHendlerTimeOut int64  `yaml:"hendler_time_out" env-required:"true" env:"HTTP_HENDLER_TIME_OUT"`
+		// HTTPTrustedProxies are the ips or cidrs of the reverse proxies, the client ip
+		// is taken from X-Forwarded-For only behind them. Empty trusts no proxy
+		HTTPTrustedProxies []string `yaml:"trusted_proxies" env:"HTTP_TRUSTED_PROXIES"`
 	}
 
 	Logger struct {
@@ -53,6 +102,35 @@ type (
 		RDPassword string `yaml:"password" env-required:"true" env:"RD_PASSWORD"`
 		RDdb       int    `yaml:"db" env-required:"true" env:"RD_DB"`
 	}
+
+	WebAuthn struct {
+		WebAuthnRPID    string `yaml:"rp_id" env-required:"true" env:"WEBAUTHN_RP_ID"`
+		WebAuthnOrigin  string `yaml:"origin" env-required:"true" env:"WEBAUTHN_ORIGIN"`
+		WebAuthnTimeout int64  `yaml:"timeout" env-required:"true" env:"WEBAUTHN_TIMEOUT"`
+	}
+
+	// RateLimit are token buckets of the route groups, rates are requests per second.
+	// Store is redis, memory for a single instance, or off
+	RateLimit struct {
+		RateLimitStore       string  `yaml:"store" env:"RATE_LIMIT_STORE" env-default:"redis"`
+		RateLimitAuthRate    float64 `yaml:"auth_rate" env:"RATE_LIMIT_AUTH_RATE"`
+		RateLimitAuthBurst   int     `yaml:"auth_burst" env:"RATE_LIMIT_AUTH_BURST"`
+		RateLimitUserRate    float64 `yaml:"user_rate" env:"RATE_LIMIT_USER_RATE"`
+		RateLimitUserBurst   int     `yaml:"user_burst" env:"RATE_LIMIT_USER_BURST"`
+		RateLimitClientRate  float64 `yaml:"client_rate" env:"RATE_LIMIT_CLIENT_RATE"`
+		RateLimitClientBurst int     `yaml:"client_burst" env:"RATE_LIMIT_CLIENT_BURST"`
+	}
+
+	// Mail with empty host writes mails to the log
+	Mail struct {
+		MailHost             string `yaml:"host" env:"MAIL_HOST"`
+		MailPort             string `yaml:"port" env:"MAIL_PORT"`
+		MailUser             string `yaml:"user" env:"MAIL_USER"`
+		MailPassword         string `yaml:"password" env:"MAIL_PASSWORD"`
+		MailFrom             string `yaml:"from" env-required:"true" env:"MAIL_FROM"`
+		MailVerifyEmailURL   string `yaml:"verify_email_url" env-required:"true" env:"MAIL_VERIFY_EMAIL_URL"`
+		MailResetPasswordURL string `yaml:"reset_password_url" env-required:"true" env:"MAIL_RESET_PASSWORD_URL"`
+	}
 )
 
 func New() (*Config, error) {
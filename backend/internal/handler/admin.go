@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type adminUsersReq struct {
+	Query         string `form:"q"`
+	Status        string `form:"status" binding:"omitempty,oneof=active pending_verification suspended deleted"`
+	EmailVerified *bool  `form:"email_verified"`
+	Role          string `form:"role"`
+	Limit         int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Offset        int    `form:"offset" binding:"omitempty,min=0"`
+}
+
+type adminUpdateUserReq struct {
+	Name          *string `json:"name" binding:"omitempty,max=50"`
+	Email         *string `json:"email" binding:"omitempty,email"`
+	ImageURL      *string `json:"image_url"`
+	EmailVerified *bool   `json:"email_verified"`
+}
+
+// AdminUsers handler lists and searches users, a page at a time
+func (h *Handler) AdminUsers(c *gin.Context) {
+	var req adminUsersReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		logger.Warn("error binding admin users query: %v", err)
+		sendError(c, queryError(err))
+		return
+	}
+
+	f := &model.UserFilter{
+		Query:         req.Query,
+		Status:        req.Status,
+		EmailVerified: req.EmailVerified,
+		Role:          req.Role,
+		Limit:         req.Limit,
+		Offset:        req.Offset,
+	}
+
+	users, total, err := h.UserService.ListUsers(c.Request.Context(), f)
+	if err != nil {
+		sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":  users,
+		"total":  total,
+		"limit":  f.Limit,
+		"offset": f.Offset,
+	})
+}
+
+// AdminUser handler gets a user by uid
+func (h *Handler) AdminUser(c *gin.Context) {
+	uid, ok := uidParam(c)
+	if !ok {
+		return
+	}
+
+	u, err := h.UserService.Get(c.Request.Context(), uid)
+	if err != nil {
+		sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": u,
+	})
+}
+
+// AdminUpdateUser handler changes the fields of the request body, other fields are kept
+func (h *Handler) AdminUpdateUser(c *gin.Context) {
+	uid, ok := uidParam(c)
+	if !ok {
+		return
+	}
+
+	var req adminUpdateUserReq
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	u, err := h.UserService.UpdateUser(c.Request.Context(), uid, &model.UserUpdate{
+		Name:          req.Name,
+		Email:         req.Email,
+		ImageURL:      req.ImageURL,
+		EmailVerified: req.EmailVerified,
+	})
+	if err != nil {
+		sendError(c, err)
+		return
+	}
+
+	logger.Info("admin %s updated uid: %s", adminName(c), uid.String())
+	c.JSON(http.StatusOK, gin.H{
+		"user": u,
+	})
+}
+
+// AdminResetPassword handler invalidates the password of the user and mails a reset link
+func (h *Handler) AdminResetPassword(c *gin.Context) {
+	uid, ok := uidParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.UserService.ForcePasswordReset(c.Request.Context(), uid); err != nil {
+		sendError(c, err)
+		return
+	}
+
+	logger.Info("admin %s forced password reset of uid: %s", adminName(c), uid.String())
+	c.JSON(http.StatusOK, gin.H{
+		"message": "password reset, a reset link was sent to the user",
+	})
+}
+
+// AdminSuspendUser handler refuses signin to the user and signs out every session
+func (h *Handler) AdminSuspendUser(c *gin.Context) {
+	uid, ok := otherUIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.UserService.Suspend(c.Request.Context(), uid); err != nil {
+		sendError(c, err)
+		return
+	}
+
+	logger.Info("admin %s suspended uid: %s", adminName(c), uid.String())
+	c.JSON(http.StatusOK, gin.H{
+		"message": "user suspended",
+	})
+}
+
+// AdminUnsuspendUser handler allows signin to a suspended user again
+func (h *Handler) AdminUnsuspendUser(c *gin.Context) {
+	uid, ok := uidParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.UserService.Unsuspend(c.Request.Context(), uid); err != nil {
+		sendError(c, err)
+		return
+	}
+
+	logger.Info("admin %s unsuspended uid: %s", adminName(c), uid.String())
+	c.JSON(http.StatusOK, gin.H{
+		"message": "user unsuspended",
+	})
+}
+
+// AdminDeleteUser handler deletes the user and signs out every session
+func (h *Handler) AdminDeleteUser(c *gin.Context) {
+	uid, ok := otherUIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.UserService.Delete(c.Request.Context(), uid); err != nil {
+		sendError(c, err)
+		return
+	}
+
+	logger.Info("admin %s deleted uid: %s", adminName(c), uid.String())
+	c.JSON(http.StatusOK, gin.H{
+		"message": "user deleted",
+	})
+}
+
+// uidParam parses the uid of the path
+func uidParam(c *gin.Context) (uuid.UUID, bool) {
+	uid, err := uuid.Parse(c.Param("uid"))
+	if err != nil {
+		err := apperrors.NewBadRequest("uid is not a valid uuid")
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return uuid.Nil, false
+	}
+	return uid, true
+}
+
+// otherUIDParam parses the uid of the path, admins can not lock themselves out
+func otherUIDParam(c *gin.Context) (uuid.UUID, bool) {
+	uid, ok := uidParam(c)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	if uid.String() == adminUID(c) {
+		err := apperrors.NewBadRequest("admins can not suspend or delete their own account")
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return uuid.Nil, false
+	}
+	return uid, true
+}
+
+// adminUID is the uid of the signed in admin, empty for service accounts
+func adminUID(c *gin.Context) string {
+	if u, ok := c.Get("user"); ok {
+		if u, ok := u.(*model.User); ok {
+			return u.UID.String()
+		}
+	}
+	return ""
+}
+
+// adminName is the signed in admin or service account for the logs
+func adminName(c *gin.Context) string {
+	if p, ok := c.Get("service"); ok {
+		if p, ok := p.(*model.ServicePrincipal); ok {
+			return "client: " + p.ClientID
+		}
+	}
+	return "uid: " + adminUID(c)
+}
+
+// queryError is the BadRequest error of invalid query parameters
+func queryError(err error) error {
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return apperrors.NewBadRequest("invalid query parameters")
+	}
+
+	args := make([]apperrors.InvalidArgument, 0, len(errs))
+	for _, err := range errs {
+		args = append(args, apperrors.InvalidArgument{
+			Field: err.Field(),
+			Tag:   err.Tag(),
+			Param: err.Param(),
+		})
+	}
+	return apperrors.NewInvalidArgs("invalid query parameters, see invalidArgs", args)
+}
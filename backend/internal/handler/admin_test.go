@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAdminUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	baseURL := "/api/account"
+	url := fmt.Sprintf("%s/admin/users", baseURL)
+
+	adminID, _ := uuid.NewRandom()
+	uid, _ := uuid.NewRandom()
+	admin := &model.User{UID: adminID, Roles: []string{model.RoleAdmin}, Permissions: []string{model.PermissionUsersRead, model.PermissionUsersWrite}}
+	support := &model.User{UID: adminID, Permissions: []string{model.PermissionUsersRead}}
+
+	newRouter := func(u *model.User, mockUserService *mocks.MockUserService) *gin.Engine {
+		router := gin.Default()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", u)
+		})
+
+		NewHandler(&Config{
+			Router:      router,
+			UserService: mockUserService,
+			BaseUrl:     baseURL,
+		})
+
+		return router
+	}
+
+	serve := func(router *gin.Engine, method, url string, body interface{}) *httptest.ResponseRecorder {
+		var reqBody []byte
+		if body != nil {
+			reqBody, _ = json.Marshal(body)
+		}
+
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(method, url, bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		router.ServeHTTP(rr, request)
+		return rr
+	}
+
+	t.Run("List with filters", func(t *testing.T) {
+		users := []*model.User{{UID: uid, Email: "bob@bob.com", Status: model.UserStatusActive}}
+		verified := true
+
+		mockUserService := new(mocks.MockUserService)
+		mockUserService.
+			On("ListUsers", mock.Anything, &model.UserFilter{Query: "bob", Status: "active", EmailVerified: &verified, Limit: 10, Offset: 20}).
+			Return(users, int64(21), nil)
+
+		rr := serve(newRouter(support, mockUserService), http.MethodGet, url+"?q=bob&status=active&email_verified=true&limit=10&offset=20", nil)
+
+		respBody, err := json.Marshal(gin.H{
+			"users":  users,
+			"total":  21,
+			"limit":  10,
+			"offset": 20,
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+		mockUserService.AssertExpectations(t)
+	})
+
+	t.Run("List with invalid filter", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+
+		rr := serve(newRouter(support, mockUserService), http.MethodGet, url+"?limit=1000", nil)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"tag":"max"`)
+		mockUserService.AssertNotCalled(t, "ListUsers", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		u := &model.User{UID: uid, Email: "bob@bob.com"}
+
+		mockUserService := new(mocks.MockUserService)
+		mockUserService.On("Get", mock.Anything, uid).Return(u, nil)
+
+		rr := serve(newRouter(support, mockUserService), http.MethodGet, fmt.Sprintf("%s/%s", url, uid), nil)
+
+		respBody, err := json.Marshal(gin.H{
+			"user": u,
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+	})
+
+	t.Run("Get with invalid uid", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+
+		rr := serve(newRouter(support, mockUserService), http.MethodGet, url+"/not-an-uid", nil)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockUserService.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		email := "new@bob.com"
+		u := &model.User{UID: uid, Email: email, Name: "Bob"}
+
+		mockUserService := new(mocks.MockUserService)
+		mockUserService.On("UpdateUser", mock.Anything, uid, &model.UserUpdate{Email: &email}).Return(u, nil)
+
+		rr := serve(newRouter(admin, mockUserService), http.MethodPatch, fmt.Sprintf("%s/%s", url, uid), gin.H{
+			"email": email,
+		})
+
+		respBody, err := json.Marshal(gin.H{
+			"user": u,
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+	})
+
+	t.Run("Update to a taken email", func(t *testing.T) {
+		email := "taken@bob.com"
+
+		mockUserService := new(mocks.MockUserService)
+		mockUserService.On("UpdateUser", mock.Anything, uid, mock.Anything).Return(nil, apperrors.NewConflict("email", email))
+
+		rr := serve(newRouter(admin, mockUserService), http.MethodPatch, fmt.Sprintf("%s/%s", url, uid), gin.H{
+			"email": email,
+		})
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("Write without permission", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+
+		rr := serve(newRouter(support, mockUserService), http.MethodDelete, fmt.Sprintf("%s/%s", url, uid), nil)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		mockUserService.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Read without permission", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+
+		rr := serve(newRouter(&model.User{UID: uid}, mockUserService), http.MethodGet, url, nil)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		mockUserService.AssertNotCalled(t, "ListUsers", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Service account granted the scopes", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+		mockUserService.On("ForcePasswordReset", mock.Anything, uid).Return(nil)
+
+		newServiceRouter := func(scopes ...string) *gin.Engine {
+			router := gin.Default()
+			router.Use(func(c *gin.Context) {
+				c.Set("service", &model.ServicePrincipal{ClientID: "support-job", Scopes: scopes})
+			})
+
+			NewHandler(&Config{
+				Router:      router,
+				UserService: mockUserService,
+				BaseUrl:     baseURL,
+			})
+
+			return router
+		}
+
+		rr := serve(newServiceRouter(model.PermissionUsersRead), http.MethodPost, fmt.Sprintf("%s/%s/password-reset", url, uid), nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = serve(newServiceRouter(model.PermissionUsersRead, model.PermissionUsersWrite), http.MethodPost, fmt.Sprintf("%s/%s/password-reset", url, uid), nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockUserService.AssertNumberOfCalls(t, "ForcePasswordReset", 1)
+	})
+
+	t.Run("Actions", func(t *testing.T) {
+		cases := []struct {
+			method string
+			path   string
+			call   string
+		}{
+			{http.MethodPost, "/password-reset", "ForcePasswordReset"},
+			{http.MethodPost, "/suspend", "Suspend"},
+			{http.MethodPost, "/unsuspend", "Unsuspend"},
+			{http.MethodDelete, "", "Delete"},
+		}
+
+		for _, c := range cases {
+			mockUserService := new(mocks.MockUserService)
+			mockUserService.On(c.call, mock.Anything, uid).Return(nil)
+
+			rr := serve(newRouter(admin, mockUserService), c.method, fmt.Sprintf("%s/%s%s", url, uid, c.path), nil)
+
+			assert.Equal(t, http.StatusOK, rr.Code, c.call)
+			mockUserService.AssertExpectations(t)
+		}
+	})
+
+	t.Run("Action on unknown user", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+		mockUserService.On("Delete", mock.Anything, uid).Return(apperrors.NewNotFound("uid", uid.String()))
+
+		rr := serve(newRouter(admin, mockUserService), http.MethodDelete, fmt.Sprintf("%s/%s", url, uid), nil)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Admins can not suspend or delete themselves", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+
+		rr := serve(newRouter(admin, mockUserService), http.MethodPost, fmt.Sprintf("%s/%s/suspend", url, adminID), nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = serve(newRouter(admin, mockUserService), http.MethodDelete, fmt.Sprintf("%s/%s", url, adminID), nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		mockUserService.AssertNotCalled(t, "Suspend", mock.Anything, mock.Anything)
+		mockUserService.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+}
@@ -61,3 +61,29 @@ func bindData(c *gin.Context, req interface{}) bool {
 
 	return true
 }
+
+// sendError responds with the error, and with its invalidArgs for BadRequest
+// errors of the services. Values are not sent, they may be passwords
+func sendError(c *gin.Context, err error) {
+	args := apperrors.InvalidArgs(err)
+	if len(args) == 0 {
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	invalidArgs := make([]invalidArgument, 0, len(args))
+	for _, arg := range args {
+		invalidArgs = append(invalidArgs, invalidArgument{
+			Filed: arg.Field,
+			Tag:   arg.Tag,
+			Param: arg.Param,
+		})
+	}
+
+	c.JSON(apperrors.Status(err), gin.H{
+		"error":       err,
+		"invalidArgs": invalidArgs,
+	})
+}
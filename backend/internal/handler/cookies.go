@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"path"
+
+	"github.com/Kara4ev/go-web-tmp/internal/handler/middleware"
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// sendTokens responds with the issued token pair. In cookie session mode
+// the tokens are set as HttpOnly cookies and only the csrf token is returned,
+// scripts of the browser client never see the tokens
+func (h *Handler) sendTokens(c *gin.Context, status int, tokens *model.TokenPair) {
+	if !h.CookieSessions {
+		c.JSON(status, gin.H{
+			"tokens": tokens,
+		})
+		return
+	}
+
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		logger.Warn("failed to generate csrf token: %v", err)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	h.setCookie(c, middleware.AccessTokenCookie, tokens.IDToken.SS, h.BaseURL, h.AccessCookieMaxAge, true)
+	h.setCookie(c, middleware.RefreshTokenCookie, tokens.RefreshToken.SS, path.Join(h.BaseURL, "tokens"), h.RefreshCookieMaxAge, true)
+	h.setCookie(c, middleware.CSRFCookie, csrfToken, "/", h.RefreshCookieMaxAge, false)
+
+	c.JSON(status, gin.H{
+		"csrf_token": csrfToken,
+	})
+}
+
+// clearSessionCookies expires the cookies of the cookie session mode
+func (h *Handler) clearSessionCookies(c *gin.Context) {
+	if !h.CookieSessions {
+		return
+	}
+
+	h.setCookie(c, middleware.AccessTokenCookie, "", h.BaseURL, -1, true)
+	h.setCookie(c, middleware.RefreshTokenCookie, "", path.Join(h.BaseURL, "tokens"), -1, true)
+	h.setCookie(c, middleware.CSRFCookie, "", "/", -1, false)
+}
+
+func (h *Handler) setCookie(c *gin.Context, name, value, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   h.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// refreshToken is the refresh token of the request body, or in cookie
+// session mode of the refresh token cookie when the body has none
+func (h *Handler) refreshToken(c *gin.Context) (string, bool) {
+	if !h.CookieSessions {
+		var req tokenReq
+		if ok := bindData(c, &req); !ok {
+			return "", false
+		}
+		return req.RefreshToken, true
+	}
+
+	var req cookieTokenReq
+	if ok := bindData(c, &req); !ok {
+		return "", false
+	}
+
+	if req.RefreshToken != "" {
+		return req.RefreshToken, true
+	}
+
+	token, err := c.Cookie(middleware.RefreshTokenCookie)
+	if err != nil || token == "" {
+		err := apperrors.NewAuthorization("missing refresh token")
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return "", false
+	}
+
+	return token, true
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// Export handler returns the personal data export of the user, starting one when
+// there is none. Pending exports respond with 202, clients poll until the export
+// is ready and has a download url
+func (h *Handler) Export(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		logger.Error("Unable to extract user from request context for unknown reason: %v", c)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	e, err := h.ExportService.RequestExport(c.Request.Context(), user.(*model.User).UID)
+	if err != nil {
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	status := http.StatusOK
+	switch e.Status {
+	case model.DataExportPending:
+		status = http.StatusAccepted
+	case model.DataExportReady:
+		e.URL = fmt.Sprintf("%s/me/export/%s", h.BaseURL, e.ID)
+	}
+
+	c.JSON(status, gin.H{
+		"export": e,
+	})
+}
+
+// ExportDownload handler serves the zip archive of a ready export of the user
+func (h *Handler) ExportDownload(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		logger.Error("Unable to extract user from request context for unknown reason: %v", c)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	id := c.Param("id")
+	archive, err := h.ExportService.Archive(c.Request.Context(), user.(*model.User).UID, id)
+	if err != nil {
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s.zip"`, id))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/zip", archive)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	baseURL := "/api/account"
+	url := fmt.Sprintf("%s/me/export", baseURL)
+	uid, _ := uuid.NewRandom()
+
+	newRouter := func(mockExportService *mocks.MockExportService) *gin.Engine {
+		router := gin.Default()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", &model.User{UID: uid})
+		})
+
+		NewHandler(&Config{
+			Router:        router,
+			ExportService: mockExportService,
+			BaseUrl:       baseURL,
+		})
+
+		return router
+	}
+
+	serve := func(router *gin.Engine, url string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		assert.NoError(t, err)
+
+		router.ServeHTTP(rr, request)
+		return rr
+	}
+
+	t.Run("Pending", func(t *testing.T) {
+		e := &model.DataExport{ID: "export-id", Status: model.DataExportPending, CreatedAt: time.Now()}
+
+		mockExportService := new(mocks.MockExportService)
+		mockExportService.On("RequestExport", mock.Anything, uid).Return(e, nil)
+
+		rr := serve(newRouter(mockExportService), url)
+
+		respBody, err := json.Marshal(gin.H{
+			"export": e,
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+		mockExportService.AssertExpectations(t)
+	})
+
+	t.Run("Ready", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour)
+		e := &model.DataExport{ID: "export-id", Status: model.DataExportReady, CreatedAt: time.Now(), ExpiresAt: &expiresAt}
+
+		mockExportService := new(mocks.MockExportService)
+		mockExportService.On("RequestExport", mock.Anything, uid).Return(e, nil)
+
+		rr := serve(newRouter(mockExportService), url)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"url":"/api/account/me/export/export-id"`)
+	})
+
+	t.Run("Download", func(t *testing.T) {
+		archive := []byte("zip archive")
+
+		mockExportService := new(mocks.MockExportService)
+		mockExportService.On("Archive", mock.Anything, uid, "export-id").Return(archive, nil)
+
+		rr := serve(newRouter(mockExportService), url+"/export-id")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="export-export-id.zip"`, rr.Header().Get("Content-Disposition"))
+		assert.Equal(t, archive, rr.Body.Bytes())
+	})
+
+	t.Run("Download expired export", func(t *testing.T) {
+		mockExportService := new(mocks.MockExportService)
+		mockExportService.On("Archive", mock.Anything, uid, "export-id").Return(nil, apperrors.NewNotFound("data_export", "export-id"))
+
+		rr := serve(newRouter(mockExportService), url+"/export-id")
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
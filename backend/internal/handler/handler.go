@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"strings"
 	"time"
 
 	"github.com/Kara4ev/go-web-tmp/internal/handler/middleware"
@@ -11,23 +12,75 @@ import (
 )
 
 type Handler struct {
-	UserService  model.UserService
-	TokenService model.TokenService
+	UserService              model.UserService
+	TokenService             model.TokenService
+	MFAService               model.MFAService
+	WebAuthnService          model.WebAuthnService
+	OAuthService             model.OAuthService
+	ExportService            model.ExportService
+	RequireEmailVerification bool
+	Issuer                   string
+	ConsentURL               string
+	BaseURL                  string
+	CookieSessions           bool
+	CookieDomain             string
+	AccessCookieMaxAge       int
+	RefreshCookieMaxAge      int
+	RateLimitStore           model.RateLimitStore
+	ClientRateLimit          model.RateLimit
 }
 
 type Config struct {
 	Router          *gin.Engine
 	UserService     model.UserService
 	TokenService    model.TokenService
+	MFAService      model.MFAService
+	WebAuthnService model.WebAuthnService
+	OAuthService    model.OAuthService
+	ExportService   model.ExportService
 	BaseUrl         string
 	TimeoutDuration time.Duration
+	// RequireEmailVerification makes Signup skip issuing tokens
+	// until the email address is verified
+	RequireEmailVerification bool
+	// Issuer is the public url of the service, used in the discovery document
+	Issuer string
+	// ConsentURL is the page where users sign in and consent to authorization requests,
+	// the authorization endpoint redirects to it with the query of the request
+	ConsentURL string
+	// CookieSessions sets the tokens issued to browsers as HttpOnly cookies
+	// and requires a double submit csrf token on state changing requests
+	CookieSessions bool
+	CookieDomain   string
+	// max age in seconds of the cookies, the lifetimes of the id and refresh tokens
+	AccessCookieMaxAge  int
+	RefreshCookieMaxAge int
+	// RateLimitStore keeps the rate limit buckets, nil disables rate limiting
+	RateLimitStore  model.RateLimitStore
+	AuthRateLimit   model.RateLimit
+	UserRateLimit   model.RateLimit
+	ClientRateLimit model.RateLimit
 }
 
 func NewHandler(c *Config) {
 
 	h := &Handler{
-		UserService:  c.UserService,
-		TokenService: c.TokenService,
+		UserService:              c.UserService,
+		TokenService:             c.TokenService,
+		MFAService:               c.MFAService,
+		WebAuthnService:          c.WebAuthnService,
+		OAuthService:             c.OAuthService,
+		ExportService:            c.ExportService,
+		RequireEmailVerification: c.RequireEmailVerification,
+		Issuer:                   strings.TrimRight(c.Issuer, "/"),
+		ConsentURL:               c.ConsentURL,
+		BaseURL:                  "/" + strings.Trim(c.BaseUrl, "/"),
+		CookieSessions:           c.CookieSessions,
+		CookieDomain:             c.CookieDomain,
+		AccessCookieMaxAge:       c.AccessCookieMaxAge,
+		RefreshCookieMaxAge:      c.RefreshCookieMaxAge,
+		RateLimitStore:           c.RateLimitStore,
+		ClientRateLimit:          c.ClientRateLimit,
 	}
 
 	timeoutDuration := c.TimeoutDuration
@@ -35,21 +88,90 @@ func NewHandler(c *Config) {
 		timeoutDuration = 5 * time.Minute
 	}
 
+	// well known endpoints are served from the root
+	c.Router.GET("/.well-known/jwks.json", h.JWKS)
+	c.Router.GET("/.well-known/openid-configuration", h.OpenIDConfiguration)
+
 	g := c.Router.Group(c.BaseUrl)
 	logger.Debug("Gin mode: %s", gin.Mode())
+	if h.CookieSessions {
+		g.Use(middleware.CSRF())
+	}
+
+	// rate limits of the route groups, public routes are limited by ip,
+	// authenticated routes by user or service account. Oauth endpoints are limited by ip until
+	// the handler authenticated the client, then by client
+	authLimit := middleware.RateLimit(c.RateLimitStore, "auth", c.AuthRateLimit, middleware.KeyByIP)
+	userLimit := middleware.RateLimit(c.RateLimitStore, "user", c.UserRateLimit, middleware.KeyByUser)
+	clientLimit := middleware.RateLimit(c.RateLimitStore, "client", c.ClientRateLimit, middleware.KeyByClient)
+	adminLimit := middleware.RateLimit(c.RateLimitStore, "admin", c.UserRateLimit, middleware.KeyByPrincipal)
+
+	var admin *gin.RouterGroup
 	if gin.Mode() != gin.TestMode {
 		g.Use(middleware.Timeout(timeoutDuration, apperrors.NewServiceUnavailable()))
-		g.GET("/me", middleware.AuthUser(h.TokenService), h.Me)
-		g.POST("/signout", middleware.AuthUser(h.TokenService), h.Signout)
-		g.PUT("/details", middleware.AuthUser(h.TokenService), h.Details)
+		g.GET("/me", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.Me)
+		g.DELETE("/me", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.DeleteMe)
+		g.GET("/me/export", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.Export)
+		g.GET("/me/export/:id", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.ExportDownload)
+		g.POST("/signout", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.Signout)
+		g.PUT("/details", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.Details)
+		g.PUT("/password", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.ChangePassword)
+		g.POST("/mfa/totp/setup", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.SetupTOTP)
+		g.POST("/mfa/totp/confirm", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.ConfirmTOTP)
+		g.POST("/webauthn/register/begin", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.WebAuthnRegisterBegin)
+		g.POST("/webauthn/register/finish", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.WebAuthnRegisterFinish)
+		g.GET("/userinfo", middleware.AuthClientUser(h.TokenService, h.UserService), userLimit, h.UserInfo)
+		g.GET("/sessions", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.Sessions)
+		g.DELETE("/sessions", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.DeleteSessions)
+		g.DELETE("/sessions/:id", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.DeleteSession)
+		g.GET("/authorize/consent", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.AuthorizeConsent)
+		g.POST("/authorize/consent", middleware.AuthUser(h.TokenService, h.UserService), userLimit, h.AuthorizeDecision)
+		admin = g.Group("/admin", middleware.AuthPrincipal(h.TokenService, h.UserService), adminLimit)
 	} else {
-		g.GET("/me", h.Me)
-		g.POST("/signout", h.Signout)
-		g.PUT("/details", h.Details)
+		g.GET("/me", userLimit, h.Me)
+		g.DELETE("/me", userLimit, h.DeleteMe)
+		g.GET("/me/export", userLimit, h.Export)
+		g.GET("/me/export/:id", userLimit, h.ExportDownload)
+		g.POST("/signout", userLimit, h.Signout)
+		g.PUT("/details", userLimit, h.Details)
+		g.PUT("/password", userLimit, h.ChangePassword)
+		g.POST("/mfa/totp/setup", userLimit, h.SetupTOTP)
+		g.POST("/mfa/totp/confirm", userLimit, h.ConfirmTOTP)
+		g.POST("/webauthn/register/begin", userLimit, h.WebAuthnRegisterBegin)
+		g.POST("/webauthn/register/finish", userLimit, h.WebAuthnRegisterFinish)
+		g.GET("/userinfo", userLimit, h.UserInfo)
+		g.GET("/sessions", userLimit, h.Sessions)
+		g.DELETE("/sessions", userLimit, h.DeleteSessions)
+		g.DELETE("/sessions/:id", userLimit, h.DeleteSession)
+		g.GET("/authorize/consent", userLimit, h.AuthorizeConsent)
+		g.POST("/authorize/consent", userLimit, h.AuthorizeDecision)
+		admin = g.Group("/admin", adminLimit)
 	}
 
-	g.POST("/signin", h.Signin)
-	g.POST("/signup", h.Signup)
-	g.POST("/tokens", h.Tokens)
+	// user management of the support staff and of service accounts granted the permissions as scopes
+	read := middleware.Require(model.PermissionUsersRead)
+	write := middleware.Require(model.PermissionUsersRead, model.PermissionUsersWrite)
+	admin.GET("/users", read, h.AdminUsers)
+	admin.GET("/users/:uid", read, h.AdminUser)
+	admin.PATCH("/users/:uid", write, h.AdminUpdateUser)
+	admin.POST("/users/:uid/password-reset", write, h.AdminResetPassword)
+	admin.POST("/users/:uid/suspend", write, h.AdminSuspendUser)
+	admin.POST("/users/:uid/unsuspend", write, h.AdminUnsuspendUser)
+	admin.DELETE("/users/:uid", write, h.AdminDeleteUser)
+
+	g.POST("/signin", authLimit, h.Signin)
+	g.POST("/signin/mfa", authLimit, h.SigninMFA)
+	g.POST("/webauthn/login/begin", authLimit, h.WebAuthnLoginBegin)
+	g.POST("/webauthn/login/finish", authLimit, h.WebAuthnLoginFinish)
+	g.POST("/signup", authLimit, h.Signup)
+	g.POST("/tokens", authLimit, h.Tokens)
+	g.POST("/verify-email", authLimit, h.VerifyEmail)
+	g.POST("/verify-email/resend", authLimit, h.ResendVerification)
+	g.POST("/password/forgot", authLimit, h.ForgotPassword)
+	g.POST("/password/reset", authLimit, h.ResetPassword)
+	g.GET("/authorize", authLimit, h.Authorize)
+	g.POST("/oauth/token", clientLimit, h.OAuthToken)
+	g.POST("/oauth/introspect", clientLimit, h.OAuthIntrospect)
+	g.POST("/oauth/revoke", clientLimit, h.OAuthRevoke)
 
 }
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWKS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jwks := &model.JSONWebKeySet{
+		Keys: []model.JSONWebKey{
+			{Kty: "RSA", Use: "sig", Alg: "RS256", Kid: "active", N: "n", E: "AQAB"},
+		},
+	}
+
+	mockTokenService := new(mocks.MockTokenService)
+	mockTokenService.On("JWKS").Return(jwks)
+
+	rr := httptest.NewRecorder()
+	router := gin.Default()
+
+	NewHandler(&Config{
+		Router:       router,
+		TokenService: mockTokenService,
+		BaseUrl:      "/api/account",
+	})
+
+	request, err := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	assert.NoError(t, err)
+
+	router.ServeHTTP(rr, request)
+
+	respBody, err := json.Marshal(jwks)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, respBody, rr.Body.Bytes())
+	mockTokenService.AssertExpectations(t)
+}
@@ -38,3 +38,42 @@ func (h *Handler) Me(c *gin.Context) {
 		"user": u,
 	})
 }
+
+type deleteMeReq struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// DeleteMe handler deletes the account of the user after the password is entered again,
+// signing in before the returned deleteAt reactivates it
+func (h *Handler) DeleteMe(c *gin.Context) {
+	var req deleteMeReq
+
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		logger.Error("Unable to extract user from request context for unknown reason: %v", c)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	deleteAt, err := h.UserService.DeleteAccount(ctx, user.(*model.User).UID, req.Password)
+	if err != nil {
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	h.clearSessionCookies(c)
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "account deleted, sign in before deleteAt to reactivate it",
+		"deleteAt": deleteAt,
+	})
+}
@@ -1,11 +1,13 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/Kara4ev/go-web-tmp/internal/model"
 	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
@@ -134,3 +136,74 @@ func TestMe(t *testing.T) {
 		mockUserService.AssertExpectations(t) // assert that UserService.Get was called
 	})
 }
+
+func TestDeleteMe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	baseURL := "/api/account"
+	url := fmt.Sprintf("%s/me", baseURL)
+	uid, _ := uuid.NewRandom()
+
+	serve := func(mockUserService *mocks.MockUserService, body gin.H) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", &model.User{UID: uid})
+		})
+
+		NewHandler(&Config{
+			Router:      router,
+			UserService: mockUserService,
+			BaseUrl:     baseURL,
+		})
+
+		reqBody, err := json.Marshal(body)
+		assert.NoError(t, err)
+
+		request, err := http.NewRequest(http.MethodDelete, url, bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		router.ServeHTTP(rr, request)
+		return rr
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		deleteAt := time.Now().Add(30 * 24 * time.Hour)
+
+		mockUserService := new(mocks.MockUserService)
+		mockUserService.On("DeleteAccount", mock.Anything, uid, "correct-password").Return(deleteAt, nil)
+
+		rr := serve(mockUserService, gin.H{"password": "correct-password"})
+
+		respBody, err := json.Marshal(gin.H{
+			"message":  "account deleted, sign in before deleteAt to reactivate it",
+			"deleteAt": deleteAt,
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+		mockUserService.AssertExpectations(t)
+	})
+
+	t.Run("Invalid password", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+		mockUserService.
+			On("DeleteAccount", mock.Anything, uid, "incorrect-password").
+			Return(nil, apperrors.NewAuthorization("invalid password"))
+
+		rr := serve(mockUserService, gin.H{"password": "incorrect-password"})
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Password required", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+
+		rr := serve(mockUserService, gin.H{})
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockUserService.AssertNotCalled(t, "DeleteAccount", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
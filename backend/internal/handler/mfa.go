@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type confirmTOTPReq struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type signinMFAReq struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// SetupTOTP handler
+func (h *Handler) SetupTOTP(c *gin.Context) {
+	authUser, exists := c.Get("user")
+	if !exists {
+		logger.Error("Unable to extract user from request context for unknown reason: %v", c)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	uri, err := h.MFAService.SetupTOTP(ctx, authUser.(*model.User))
+	if err != nil {
+		logger.Warn("failed to setup totp: %v", err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"uri": uri,
+	})
+}
+
+// ConfirmTOTP handler
+func (h *Handler) ConfirmTOTP(c *gin.Context) {
+	var req confirmTOTPReq
+
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	authUser, exists := c.Get("user")
+	if !exists {
+		logger.Error("Unable to extract user from request context for unknown reason: %v", c)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	codes, err := h.MFAService.ConfirmTOTP(ctx, authUser.(*model.User).UID, req.Code)
+	if err != nil {
+		logger.Warn("failed to confirm totp: %v", err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// SigninMFA handler, the second step of Signin for users with mfa enabled
+func (h *Handler) SigninMFA(c *gin.Context) {
+	var req signinMFAReq
+
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	uid, err := h.MFAService.VerifyChallenge(ctx, req.MFAToken, req.Code, c.ClientIP())
+	if err != nil {
+		logger.Warn("failed to verify mfa challenge: %v", err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	u, err := h.UserService.Get(ctx, uid)
+	if err != nil {
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	tokens, err := h.TokenService.NewPairFromUser(ctx, u, "", sessionClient(c))
+	if err != nil {
+		logger.Warn("failed to create tokens for uid: %v, err: %v", uid, err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	h.sendTokens(c, http.StatusOK, tokens)
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// AuthPrincipal accepts the id token of a user or the access token of a service account.
+// Users are checked and set as "user" like AuthUser does, also by the access token cookie
+// of the cookie session mode. Service accounts are set as "service" and must be granted
+// all of the scopes
+func AuthPrincipal(s model.TokenService, us model.UserService, scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger.Debug("middleware AuthPrincipal: execute")
+		token, ok := cookieToken(c)
+		if !ok {
+			token, ok = bearerToken(c)
+		}
+		if !ok {
+			return
+		}
+
+		// tokens of oauth clients are not accepted, like by AuthUser
+		if claims, err := s.ValidateIDToken(token); err == nil && claims.ClientID == "" {
+			if !activeUser(c, us, claims) {
+				return
+			}
+
+			logger.Debug("middleware AuthPrincipal: user uid: %s", claims.User.UID.String())
+			c.Set("user", claims.User)
+			c.Set("sid", claims.SessionID)
+			c.Next()
+			return
+		}
+
+		p, err := s.ValidateAccessToken(token)
+		if err != nil {
+			logger.Debug("middleware AuthPrincipal: error token validate")
+			err := apperrors.NewAuthorization("Provided token is invalid")
+			c.JSON(err.Status(), gin.H{
+				"error": err,
+			})
+			c.Abort()
+			return
+		}
+
+		for _, scope := range scopes {
+			if !p.HasScope(scope) {
+				logger.Debug("middleware AuthPrincipal: client: %s has no scope: %s", p.ClientID, scope)
+				err := apperrors.NewForbidden("insufficient scope: " + scope)
+				c.JSON(err.Status(), gin.H{
+					"error": err,
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		logger.Debug("middleware AuthPrincipal: service account client: %s", p.ClientID)
+		c.Set("service", p)
+		c.Next()
+	}
+}
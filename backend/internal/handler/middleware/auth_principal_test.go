@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthPrincipal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	uid, _ := uuid.NewRandom()
+	invalid := apperrors.NewAuthorization("invalid token")
+
+	mockTokenService := new(mocks.MockTokenService)
+	mockTokenService.On("ValidateIDToken", "idToken").Return(&model.IDTokenClaims{User: &model.User{UID: uid}, SessionID: "sid"}, nil)
+	mockTokenService.On("ValidateIDToken", "accessToken").Return(nil, invalid)
+	mockTokenService.On("ValidateIDToken", "invalid").Return(nil, invalid)
+	mockTokenService.On("ValidateIDToken", "clientToken").Return(&model.IDTokenClaims{User: &model.User{UID: uid}, SessionID: "sid", ClientID: "spa"}, nil)
+	mockTokenService.On("ValidateAccessToken", "clientToken").Return(nil, invalid)
+	mockTokenService.On("ValidateAccessToken", "accessToken").Return(&model.ServicePrincipal{ClientID: "billing-job", Scopes: []string{"users:read"}}, nil)
+	mockTokenService.On("ValidateAccessToken", "invalid").Return(nil, invalid)
+
+	suspendedUID, _ := uuid.NewRandom()
+	mockTokenService.On("ValidateIDToken", "suspendedToken").Return(&model.IDTokenClaims{User: &model.User{UID: suspendedUID}, SessionID: "sid"}, nil)
+
+	mockUserService := new(mocks.MockUserService)
+	mockUserService.On("Get", mock.Anything, uid).Return(&model.User{UID: uid, Status: model.UserStatusActive}, nil)
+	mockUserService.On("Get", mock.Anything, suspendedUID).Return(&model.User{UID: suspendedUID, Status: model.UserStatusSuspended}, nil)
+
+	serve := func(token string, scopes ...string) (*httptest.ResponseRecorder, *gin.Context) {
+		var ctx *gin.Context
+
+		rr := httptest.NewRecorder()
+		router := gin.New()
+		router.GET("/", AuthPrincipal(mockTokenService, mockUserService, scopes...), func(c *gin.Context) {
+			ctx = c
+			c.Status(http.StatusOK)
+		})
+
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(rr, request)
+
+		return rr, ctx
+	}
+
+	t.Run("User", func(t *testing.T) {
+		rr, c := serve("idToken", "users:read")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, uid, c.MustGet("user").(*model.User).UID)
+		_, exists := c.Get("service")
+		assert.False(t, exists)
+	})
+
+	t.Run("Inactive user", func(t *testing.T) {
+		rr, _ := serve("suspendedToken")
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("User of the access token cookie", func(t *testing.T) {
+		var ctx *gin.Context
+
+		rr := httptest.NewRecorder()
+		router := gin.New()
+		router.GET("/", AuthPrincipal(mockTokenService, mockUserService), func(c *gin.Context) {
+			ctx = c
+			c.Status(http.StatusOK)
+		})
+
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.AddCookie(&http.Cookie{Name: AccessTokenCookie, Value: "idToken"})
+		router.ServeHTTP(rr, request)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, uid, ctx.MustGet("user").(*model.User).UID)
+	})
+
+	t.Run("Service account", func(t *testing.T) {
+		rr, c := serve("accessToken", "users:read")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "billing-job", c.MustGet("service").(*model.ServicePrincipal).ClientID)
+		_, exists := c.Get("user")
+		assert.False(t, exists)
+	})
+
+	t.Run("Service account without scope", func(t *testing.T) {
+		rr, _ := serve("accessToken", "users:write")
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Token of oauth client", func(t *testing.T) {
+		rr, _ := serve("clientToken")
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		rr, _ := serve("invalid")
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
@@ -23,64 +23,149 @@ type invalidArgument struct {
 	Param string `json:"param"`
 }
 
-func AuthUser(s model.TokenService) gin.HandlerFunc {
+// AuthUser authenticates the user by the id token of the Authorization header,
+// or of the access token cookie of the cookie session mode when there is no header.
+// The account has to be active, its status is looked up on every request.
+// Tokens issued to oauth clients are rejected, their audience is the client
+func AuthUser(s model.TokenService, us model.UserService) gin.HandlerFunc {
+	return authUser(s, us, false)
+}
+
+// AuthClientUser is AuthUser that also accepts the tokens issued to oauth clients,
+// it guards the endpoints of the clients like userinfo
+func AuthClientUser(s model.TokenService, us model.UserService) gin.HandlerFunc {
+	return authUser(s, us, true)
+}
+
+func authUser(s model.TokenService, us model.UserService, clients bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		logger.Debug("middleware AuthUser: execute")
-		h := new(authHeader)
-		if err := c.ShouldBindHeader(&h); err != nil {
-			logger.Debug("middleware AuthUser: error validate request")
-			if errs, ok := err.(validator.ValidationErrors); ok {
-				var invalidArgs []invalidArgument
-
-				for _, err := range errs {
-					invalidArgs = append(invalidArgs, invalidArgument{
-						err.Field(),
-						err.Value().(string),
-						err.Tag(),
-						err.Param(),
-					})
-				}
-				err := apperrors.NewBadRequest("invalid request parametrs. See invalidArgs")
-
-				c.JSON(err.Status(), gin.H{
-					"error":       err,
-					"invalidArgs": invalidArgs,
-				})
-				c.Abort()
-				return
-			}
+		token, ok := cookieToken(c)
+		if !ok {
+			token, ok = bearerToken(c)
+		}
+		if !ok {
+			return
+		}
 
-			err := apperrors.NewInternal()
+		claims, err := s.ValidateIDToken(token)
+		if err != nil {
+			logger.Debug("middleware AuthUser execute: error token validate")
+			err := apperrors.NewAuthorization("Provided token is invalid")
 			c.JSON(err.Status(), gin.H{
 				"error": err,
 			})
 			c.Abort()
 			return
 		}
-		logger.Debug("middleware AuthUser: request valid")
-		idTokenHeader := strings.Split(h.IDToken, "Bearer ")
-		if len(idTokenHeader) != 2 {
-			logger.Debug("middleware AuthUser: error token format")
-			err := apperrors.NewAuthorization("Must provide Authorization header with format `Bearer {token}`")
+
+		if claims.ClientID != "" && !clients {
+			logger.Warn("middleware AuthUser: token of client: %s used on %s, uid: %s", claims.ClientID, c.FullPath(), claims.User.UID.String())
+			err := apperrors.NewAuthorization("Provided token is invalid")
 			c.JSON(err.Status(), gin.H{
 				"error": err,
 			})
 			c.Abort()
 			return
 		}
-		logger.Debug("middleware AuthUser: bearer format valid")
-		user, err := s.ValidateIDToken(idTokenHeader[1])
-		if err != nil {
-			logger.Debug("middleware AuthUser execute: error token validate")
-			err := apperrors.NewAuthorization("Provided token is invalid")
+
+		if !activeUser(c, us, claims) {
+			return
+		}
+
+		logger.Debug("middleware AuthUser: token valide, user uid: %s email: %s", claims.User.UID.String(), claims.User.Email)
+		c.Set("user", claims.User)
+		c.Set("sid", claims.SessionID)
+		c.Next()
+	}
+}
+
+// activeUser looks up the account of the token, the request is
+// aborted when it is gone or not active
+func activeUser(c *gin.Context, us model.UserService, claims *model.IDTokenClaims) bool {
+	u, err := us.Get(c.Request.Context(), claims.User.UID)
+	if err != nil {
+		logger.Debug("middleware: user of token not found, uid: %s", claims.User.UID.String())
+		err := apperrors.NewAuthorization("Provided token is invalid")
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		c.Abort()
+		return false
+	}
+
+	if !u.Active() {
+		logger.Warn("middleware: account with status: %s, uid: %s", u.Status, u.UID.String())
+		err := apperrors.NewForbidden("account is not active")
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
+
+// cookieToken is the id token of the access token cookie
+func cookieToken(c *gin.Context) (string, bool) {
+	if c.GetHeader("Authorization") != "" {
+		return "", false
+	}
+
+	token, err := c.Cookie(AccessTokenCookie)
+	if err != nil || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// bearerToken extracts the token of the Authorization header,
+// the request is aborted when there is none
+func bearerToken(c *gin.Context) (string, bool) {
+	h := new(authHeader)
+	if err := c.ShouldBindHeader(&h); err != nil {
+		logger.Debug("middleware: error validate request")
+		if errs, ok := err.(validator.ValidationErrors); ok {
+			var invalidArgs []invalidArgument
+
+			for _, err := range errs {
+				invalidArgs = append(invalidArgs, invalidArgument{
+					err.Field(),
+					err.Value().(string),
+					err.Tag(),
+					err.Param(),
+				})
+			}
+			err := apperrors.NewBadRequest("invalid request parametrs. See invalidArgs")
+
 			c.JSON(err.Status(), gin.H{
-				"error": err,
+				"error":       err,
+				"invalidArgs": invalidArgs,
 			})
 			c.Abort()
-			return
+			return "", false
 		}
-		logger.Debug("middleware AuthUser: token valide, user uid: %s email: %s", user.UID.String(), user.Email)
-		c.Set("user", user)
-		c.Next()
+
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		c.Abort()
+		return "", false
 	}
+	logger.Debug("middleware: request valid")
+	tokenHeader := strings.Split(h.IDToken, "Bearer ")
+	if len(tokenHeader) != 2 {
+		logger.Debug("middleware: error token format")
+		err := apperrors.NewAuthorization("Must provide Authorization header with format `Bearer {token}`")
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		c.Abort()
+		return "", false
+	}
+	logger.Debug("middleware: bearer format valid")
+
+	return tokenHeader[1], true
 }
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	uid, _ := uuid.NewRandom()
+	claims := &model.IDTokenClaims{User: &model.User{UID: uid, Roles: []string{model.RoleAdmin}}, SessionID: "sid"}
+
+	clientClaims := &model.IDTokenClaims{User: &model.User{UID: uid}, SessionID: "sid", ClientID: "spa"}
+
+	serveWith := func(auth func(model.TokenService, model.UserService) gin.HandlerFunc, claims *model.IDTokenClaims, u *model.User, err error) (*httptest.ResponseRecorder, *gin.Context) {
+		var ctx *gin.Context
+
+		mockTokenService := new(mocks.MockTokenService)
+		mockTokenService.On("ValidateIDToken", "idToken").Return(claims, nil)
+
+		mockUserService := new(mocks.MockUserService)
+		mockUserService.On("Get", mock.Anything, uid).Return(u, err)
+
+		rr := httptest.NewRecorder()
+		router := gin.New()
+		router.GET("/", auth(mockTokenService, mockUserService), func(c *gin.Context) {
+			ctx = c
+			c.Status(http.StatusOK)
+		})
+
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Authorization", "Bearer idToken")
+		router.ServeHTTP(rr, request)
+
+		return rr, ctx
+	}
+
+	serve := func(u *model.User, err error) (*httptest.ResponseRecorder, *gin.Context) {
+		return serveWith(AuthUser, claims, u, err)
+	}
+
+	t.Run("Active", func(t *testing.T) {
+		rr, c := serve(&model.User{UID: uid, Status: model.UserStatusActive}, nil)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, claims.User, c.MustGet("user"))
+		assert.Equal(t, "sid", c.GetString("sid"))
+	})
+
+	t.Run("Suspended", func(t *testing.T) {
+		rr, _ := serve(&model.User{UID: uid, Status: model.UserStatusSuspended}, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		rr, _ := serve(&model.User{UID: uid, Status: model.UserStatusDeleted}, nil)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("User not found", func(t *testing.T) {
+		rr, _ := serve(nil, apperrors.NewNotFound("uid", uid.String()))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Token of oauth client", func(t *testing.T) {
+		rr, _ := serveWith(AuthUser, clientClaims, &model.User{UID: uid, Status: model.UserStatusActive}, nil)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Token of oauth client on client endpoint", func(t *testing.T) {
+		rr, c := serveWith(AuthClientUser, clientClaims, &model.User{UID: uid, Status: model.UserStatusActive}, nil)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, clientClaims.User, c.MustGet("user"))
+	})
+}
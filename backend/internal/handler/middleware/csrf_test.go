@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSRF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(CSRF())
+	router.Any("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	serve := func(method string, cookies map[string]string, headers map[string]string) int {
+		rr := httptest.NewRecorder()
+		request, _ := http.NewRequest(method, "/", nil)
+		for name, value := range cookies {
+			request.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		router.ServeHTTP(rr, request)
+		return rr.Code
+	}
+
+	session := map[string]string{AccessTokenCookie: "idToken", CSRFCookie: "csrf"}
+
+	t.Run("Safe method", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, session, nil))
+	})
+
+	t.Run("Matching token", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(http.MethodPost, session, map[string]string{CSRFHeader: "csrf"}))
+	})
+
+	t.Run("Missing token", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, session, nil))
+	})
+
+	t.Run("Mismatching token", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, serve(http.MethodDelete, session, map[string]string{CSRFHeader: "other"}))
+	})
+
+	t.Run("Missing cookie", func(t *testing.T) {
+		cookies := map[string]string{RefreshTokenCookie: "refreshToken"}
+		assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, cookies, map[string]string{CSRFHeader: ""}))
+	})
+
+	t.Run("No session cookie", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(http.MethodPost, nil, nil))
+	})
+
+	t.Run("Bearer token", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(http.MethodPost, session, map[string]string{"Authorization": "Bearer idToken"}))
+	})
+}
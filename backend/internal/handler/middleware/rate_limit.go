@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitKey returns the key of the bucket the request takes a token of
+type RateLimitKey func(c *gin.Context) string
+
+// KeyByIP limits each client ip
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByUser limits each user authenticated by AuthUser, requests without a user by ip
+func KeyByUser(c *gin.Context) string {
+	if u, ok := c.Get("user"); ok {
+		if u, ok := u.(*model.User); ok {
+			return "user:" + u.UID.String()
+		}
+	}
+	return KeyByIP(c)
+}
+
+// KeyByClient limits each authenticated service account, set as "service" by AuthPrincipal
+// or the handler that checked its secret, others by ip. The client id of the request is
+// not used before it is authenticated, anyone could empty the bucket of another client
+func KeyByClient(c *gin.Context) string {
+	if p, ok := c.Get("service"); ok {
+		if p, ok := p.(*model.ServicePrincipal); ok {
+			return "client:" + p.ClientID
+		}
+	}
+
+	return KeyByIP(c)
+}
+
+// KeyByPrincipal limits each user or service account authenticated by AuthPrincipal
+func KeyByPrincipal(c *gin.Context) string {
+	if _, ok := c.Get("user"); ok {
+		return KeyByUser(c)
+	}
+
+	return KeyByClient(c)
+}
+
+// RateLimit takes a token of the bucket of the request key for every request and
+// responds 429 when it is empty. name separates the buckets of route groups.
+// The state of the bucket is sent in the RateLimit-* headers,
+// https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/.
+// A nil store or a zero limit disables the limit. Store errors let the request through
+func RateLimit(store model.RateLimitStore, name string, l model.RateLimit, key RateLimitKey) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Limit(c, store, name, l, key) {
+			c.Next()
+		}
+	}
+}
+
+// Limit is RateLimit for handlers, which know the key only after they authenticated
+// the request. It returns false when the limit is exceeded and the 429 is sent
+func Limit(c *gin.Context, store model.RateLimitStore, name string, l model.RateLimit, key RateLimitKey) bool {
+	if store == nil || l.Burst <= 0 || l.Rate <= 0 {
+		return true
+	}
+
+	k := key(c)
+	res, err := store.Take(c.Request.Context(), name+":"+k, l, time.Now())
+	if err != nil {
+		logger.Warn("middleware RateLimit: unable to take token of %s: %s, err: %v", name, k, err)
+		return true
+	}
+
+	c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+
+	if !res.Allowed {
+		logger.Warn("middleware RateLimit: %s limit exceeded by: %s", name, k)
+		err := apperrors.NewTooManyRequests("rate limit exceeded, try again later", res.RetryAfter)
+		c.Header("Retry-After", strconv.Itoa(err.RetryAfter))
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
+
+// seconds rounds d up to whole seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
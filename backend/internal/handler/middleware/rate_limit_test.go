@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	uid, _ := uuid.NewRandom()
+
+	newRouter := func(store model.RateLimitStore, key RateLimitKey) *gin.Engine {
+		router := gin.New()
+		router.POST("/", func(c *gin.Context) {
+			if c.GetHeader("X-User") != "" {
+				c.Set("user", &model.User{UID: uid})
+			}
+			if clientID := c.GetHeader("X-Service"); clientID != "" {
+				c.Set("service", &model.ServicePrincipal{ClientID: clientID})
+			}
+		}, RateLimit(store, "test", model.RateLimit{Rate: 1, Burst: 2}, key), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		return router
+	}
+
+	serve := func(router *gin.Engine, ip string, user bool) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		request, _ := http.NewRequest(http.MethodPost, "/", nil)
+		request.RemoteAddr = ip + ":1234"
+		if user {
+			request.Header.Set("X-User", "1")
+		}
+		router.ServeHTTP(rr, request)
+		return rr
+	}
+
+	t.Run("Bucket is emptied", func(t *testing.T) {
+		router := newRouter(repository.NewMemoryRateLimitStore(), KeyByIP)
+
+		rr := serve(router, "10.0.0.1", false)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "1", rr.Header().Get("RateLimit-Reset"))
+
+		rr = serve(router, "10.0.0.1", false)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+
+		rr = serve(router, "10.0.0.1", false)
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+		// other ips have their own bucket
+		rr = serve(router, "10.0.0.2", false)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Users have their own bucket", func(t *testing.T) {
+		router := newRouter(repository.NewMemoryRateLimitStore(), KeyByUser)
+
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusOK, serve(router, "10.0.0.1", true).Code)
+		}
+		assert.Equal(t, http.StatusTooManyRequests, serve(router, "10.0.0.1", true).Code)
+		// without a user the ip is limited
+		assert.Equal(t, http.StatusOK, serve(router, "10.0.0.1", false).Code)
+	})
+
+	t.Run("Principals have their own bucket", func(t *testing.T) {
+		router := newRouter(repository.NewMemoryRateLimitStore(), KeyByPrincipal)
+
+		withService := func(clientID string) int {
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodPost, "/", nil)
+			request.Header.Set("X-Service", clientID)
+			request.RemoteAddr = "10.0.0.1:1234"
+			router.ServeHTTP(rr, request)
+			return rr.Code
+		}
+
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusOK, serve(router, "10.0.0.1", true).Code)
+			assert.Equal(t, http.StatusOK, withService("billing-job"))
+		}
+		assert.Equal(t, http.StatusTooManyRequests, serve(router, "10.0.0.1", true).Code)
+		assert.Equal(t, http.StatusTooManyRequests, withService("billing-job"))
+		assert.Equal(t, http.StatusOK, withService("report-job"))
+	})
+
+	t.Run("Forwarded ip only of trusted proxies", func(t *testing.T) {
+		router := newRouter(repository.NewMemoryRateLimitStore(), KeyByIP)
+		assert.NoError(t, router.SetTrustedProxies([]string{"10.0.0.100"}))
+
+		forwarded := func(peer, ip string) int {
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodPost, "/", nil)
+			request.RemoteAddr = peer + ":1234"
+			request.Header.Set("X-Forwarded-For", ip)
+			router.ServeHTTP(rr, request)
+			return rr.Code
+		}
+
+		// a spoofed header does not get a fresh bucket
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, http.StatusOK, forwarded("10.0.0.1", "192.168.0."+strconv.Itoa(i)))
+		}
+		assert.Equal(t, http.StatusTooManyRequests, forwarded("10.0.0.1", "192.168.0.9"))
+
+		// behind the proxy every client has its own bucket
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, forwarded("10.0.0.100", "192.168.1."+strconv.Itoa(i)))
+		}
+	})
+
+	t.Run("Unauthenticated clients are limited by ip", func(t *testing.T) {
+		router := newRouter(repository.NewMemoryRateLimitStore(), KeyByClient)
+
+		withClient := func(clientID string) int {
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodPost, "/", strings.NewReader("client_id="+clientID))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			request.SetBasicAuth(clientID, "secret")
+			request.RemoteAddr = "10.0.0.1:1234"
+			router.ServeHTTP(rr, request)
+			return rr.Code
+		}
+
+		assert.Equal(t, http.StatusOK, withClient("a"))
+		assert.Equal(t, http.StatusOK, withClient("b"))
+		assert.Equal(t, http.StatusTooManyRequests, withClient("c"))
+	})
+
+	t.Run("No store", func(t *testing.T) {
+		router := newRouter(nil, KeyByIP)
+
+		for i := 0; i < 3; i++ {
+			rr := serve(router, "10.0.0.1", false)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Empty(t, rr.Header().Get("RateLimit-Limit"))
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// Require lets the request through when the principal has all of the permissions.
+// It runs after AuthUser or AuthPrincipal, users need the permissions granted by
+// their roles, service accounts need them granted as scopes
+func Require(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		has, principal, ok := principalPermissions(c)
+		if !ok {
+			logger.Debug("middleware Require: no authenticated principal")
+			err := apperrors.NewAuthorization("request is not authenticated")
+			c.JSON(err.Status(), gin.H{
+				"error": err,
+			})
+			c.Abort()
+			return
+		}
+
+		for _, permission := range permissions {
+			if !has(permission) {
+				logger.Warn("middleware Require: %s has no permission: %s for %s %s", principal, permission, c.Request.Method, c.FullPath())
+				err := apperrors.NewForbidden("insufficient permission: " + permission)
+				c.JSON(err.Status(), gin.H{
+					"error": err,
+				})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// principalPermissions is the permission check of the authenticated user or service account
+func principalPermissions(c *gin.Context) (func(string) bool, string, bool) {
+	if u, ok := c.Get("user"); ok {
+		if u, ok := u.(*model.User); ok {
+			return u.HasPermission, "uid: " + u.UID.String(), true
+		}
+	}
+
+	if p, ok := c.Get("service"); ok {
+		if p, ok := p.(*model.ServicePrincipal); ok {
+			return p.HasScope, "client: " + p.ClientID, true
+		}
+	}
+
+	return nil, "", false
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequire(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	uid, _ := uuid.NewRandom()
+	admin := &model.User{UID: uid, Roles: []string{model.RoleAdmin}, Permissions: []string{model.PermissionUsersRead, model.PermissionUsersWrite}}
+	viewer := &model.User{UID: uid, Permissions: []string{model.PermissionUsersRead}}
+	service := &model.ServicePrincipal{ClientID: "billing-job", Scopes: []string{model.PermissionUsersRead}}
+
+	serve := func(key string, principal interface{}, permissions ...string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			if principal != nil {
+				c.Set(key, principal)
+			}
+		})
+		router.GET("/", Require(permissions...), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		router.ServeHTTP(rr, request)
+
+		return rr
+	}
+
+	t.Run("User with all permissions", func(t *testing.T) {
+		rr := serve("user", admin, model.PermissionUsersRead, model.PermissionUsersWrite)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("User missing a permission", func(t *testing.T) {
+		rr := serve("user", viewer, model.PermissionUsersRead, model.PermissionUsersWrite)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), model.PermissionUsersWrite)
+	})
+
+	t.Run("User without roles", func(t *testing.T) {
+		rr := serve("user", &model.User{UID: uid}, model.PermissionUsersRead)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Service account by scope", func(t *testing.T) {
+		rr := serve("service", service, model.PermissionUsersRead)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = serve("service", service, model.PermissionUsersWrite)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Not authenticated", func(t *testing.T) {
+		rr := serve("user", nil, model.PermissionUsersRead)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
@@ -0,0 +1,418 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/Kara4ev/go-web-tmp/internal/handler/middleware"
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type oauthTokenResp struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type accessTokenResp struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+type consentReq struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	// Approve is the decision of the user, the client gets access_denied without it
+	Approve bool `json:"approve"`
+}
+
+type consentResp struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// Authorize handler is the authorization endpoint the client redirects the browser to.
+// A valid request is passed on to the consent page, where the user signs in and decides
+func (h *Handler) Authorize(c *gin.Context) {
+	req := authorizationRequest(c)
+	ctx := c.Request.Context()
+
+	// without a valid client and redirect uri the error is not redirected
+	_, redirectURI, err := h.OAuthService.ValidateClient(ctx, req.ClientID, req.RedirectURI)
+	if err != nil {
+		logger.Warn("invalid authorization request of client: %s, err: %v", req.ClientID, err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	if _, err := h.OAuthService.Consent(ctx, req); err != nil {
+		logger.Warn("authorization request of client: %s failed: %v", req.ClientID, err)
+		c.Redirect(http.StatusFound, withQuery(redirectURI, authorizationError(req, err)))
+		return
+	}
+
+	c.Redirect(http.StatusFound, withQuery(h.ConsentURL, c.Request.URL.Query()))
+}
+
+// AuthorizeConsent handler returns the client and the scope of the authorization request
+// the consent page shows to the signed in user
+func (h *Handler) AuthorizeConsent(c *gin.Context) {
+	req := authorizationRequest(c)
+
+	consent, err := h.OAuthService.Consent(c.Request.Context(), req)
+	if err != nil {
+		logger.Warn("consent to authorization request of client: %s failed: %v", req.ClientID, err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, consent)
+}
+
+// AuthorizeDecision handler takes the decision of the signed in user on the consent page.
+// An authorization code is issued once they approved, the page redirects to the client
+func (h *Handler) AuthorizeDecision(c *gin.Context) {
+	authUser, exists := c.Get("user")
+	if !exists {
+		logger.Error("Unable to extract user from request context for unknown reason: %v", c)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	var cr consentReq
+	if ok := bindData(c, &cr); !ok {
+		return
+	}
+
+	req := &model.AuthorizationRequest{
+		ResponseType:        cr.ResponseType,
+		ClientID:            cr.ClientID,
+		RedirectURI:         cr.RedirectURI,
+		Scope:               cr.Scope,
+		State:               cr.State,
+		CodeChallenge:       cr.CodeChallenge,
+		CodeChallengeMethod: cr.CodeChallengeMethod,
+	}
+
+	ctx := c.Request.Context()
+
+	_, redirectURI, err := h.OAuthService.ValidateClient(ctx, req.ClientID, req.RedirectURI)
+	if err != nil {
+		logger.Warn("invalid authorization request of client: %s, err: %v", req.ClientID, err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	uid := authUser.(*model.User).UID
+	if !cr.Approve {
+		logger.Info("user: %v denied the authorization request of client: %s", uid, req.ClientID)
+		err := apperrors.NewOAuth(apperrors.OAuthAccessDenied, "the user denied the request")
+		c.JSON(http.StatusOK, consentResp{RedirectTo: withQuery(redirectURI, authorizationError(req, err))})
+		return
+	}
+
+	code, err := h.OAuthService.Authorize(ctx, uid, req)
+	if err != nil {
+		logger.Warn("authorization request of client: %s failed: %v", req.ClientID, err)
+		c.JSON(http.StatusOK, consentResp{RedirectTo: withQuery(redirectURI, authorizationError(req, err))})
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	c.JSON(http.StatusOK, consentResp{RedirectTo: withQuery(redirectURI, params)})
+}
+
+// authorizationRequest reads the parameters of the authorization endpoint from the query
+func authorizationRequest(c *gin.Context) *model.AuthorizationRequest {
+	return &model.AuthorizationRequest{
+		ResponseType:        c.Query("response_type"),
+		ClientID:            c.Query("client_id"),
+		RedirectURI:         c.Query("redirect_uri"),
+		Scope:               c.Query("scope"),
+		State:               c.Query("state"),
+		CodeChallenge:       c.Query("code_challenge"),
+		CodeChallengeMethod: c.Query("code_challenge_method"),
+	}
+}
+
+// authorizationError are the query parameters of the error redirect to the client
+func authorizationError(req *model.AuthorizationRequest, err error) url.Values {
+	oe := apperrors.AsOAuth(err)
+	params := url.Values{
+		"error":             {oe.Code},
+		"error_description": {oe.Description},
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return params
+}
+
+// OAuthToken handler exchanges an authorization code or a refresh token for tokens,
+// service accounts get an access token with their client credentials
+func (h *Handler) OAuthToken(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	if c.PostForm("grant_type") == "client_credentials" {
+		h.clientCredentialsGrant(c)
+		return
+	}
+
+	ctx := c.Request.Context()
+	clientID := c.PostForm("client_id")
+
+	if clientID == "" {
+		oauthError(c, apperrors.NewOAuth(apperrors.OAuthInvalidClient, "client_id is required"))
+		return
+	}
+
+	if _, err := h.OAuthService.Client(ctx, clientID); err != nil {
+		oauthError(c, err)
+		return
+	}
+
+	client := sessionClient(c)
+	client.ClientID = clientID
+
+	var (
+		u            *model.User
+		prevTokenID  string
+		scope        string
+		err          error
+		refreshToken *model.RefreshToken
+	)
+
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		var ac *model.AuthorizationCode
+		ac, err = h.OAuthService.ExchangeCode(ctx, clientID, c.PostForm("code"), c.PostForm("redirect_uri"), c.PostForm("code_verifier"))
+		if err != nil {
+			oauthError(c, err)
+			return
+		}
+
+		scope = ac.Scope
+		u, err = h.UserService.Get(ctx, ac.UID)
+
+	case "refresh_token":
+		refreshToken, err = h.TokenService.ValidateRefreshToken(c.PostForm("refresh_token"))
+		if err != nil {
+			oauthError(c, err)
+			return
+		}
+
+		prevTokenID = refreshToken.ID.String()
+		u, err = h.UserService.Get(ctx, refreshToken.UID)
+
+	case "":
+		oauthError(c, apperrors.NewOAuth(apperrors.OAuthInvalidRequest, "grant_type is required"))
+		return
+
+	default:
+		oauthError(c, apperrors.NewOAuth(apperrors.OAuthUnsupportedGrantType, "unsupported grant_type"))
+		return
+	}
+
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+
+	tokens, err := h.TokenService.NewPairFromUser(ctx, u, prevTokenID, client)
+	if err != nil {
+		logger.Warn("failed to create tokens for client: %s, uid: %v, err: %v", clientID, u.UID, err)
+		oauthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, oauthTokenResp{
+		AccessToken:  tokens.IDToken.SS,
+		IDToken:      tokens.IDToken.SS,
+		RefreshToken: tokens.RefreshToken.SS,
+		TokenType:    "Bearer",
+		Scope:        scope,
+	})
+}
+
+// clientCredentialsGrant issues an access token to a service account
+func (h *Handler) clientCredentialsGrant(c *gin.Context) {
+	ctx := c.Request.Context()
+	clientID, secret := clientCredentials(c)
+
+	sa, scope, err := h.OAuthService.AuthenticateServiceAccount(ctx, clientID, secret, c.PostForm("scope"))
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+
+	if !h.limitClient(c, sa) {
+		return
+	}
+
+	token, err := h.TokenService.NewAccessToken(ctx, sa, scope)
+	if err != nil {
+		logger.Warn("failed to create access token for client: %s, err: %v", clientID, err)
+		oauthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, accessTokenResp{
+		AccessToken: token.SS,
+		TokenType:   "Bearer",
+		ExpiresIn:   token.ExpiresIn,
+		Scope:       token.Scope,
+	})
+}
+
+// OAuthIntrospect handler returns the state of a token to a service account,
+// https://www.rfc-editor.org/rfc/rfc7662
+func (h *Handler) OAuthIntrospect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	ctx := c.Request.Context()
+	clientID, secret := clientCredentials(c)
+
+	sa, _, err := h.OAuthService.AuthenticateServiceAccount(ctx, clientID, secret, "")
+	if err != nil {
+		oauthError(c, err)
+		return
+	}
+
+	if !h.limitClient(c, sa) {
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		oauthError(c, apperrors.NewOAuth(apperrors.OAuthInvalidRequest, "token is required"))
+		return
+	}
+
+	introspection, err := h.TokenService.Introspect(ctx, token)
+	if err != nil {
+		logger.Warn("failed to introspect token for client: %s, err: %v", clientID, err)
+		oauthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, introspection)
+}
+
+// OAuthRevoke handler revokes a refresh token, https://www.rfc-editor.org/rfc/rfc7009.
+// Public clients identify with client_id, first party clients send none
+func (h *Handler) OAuthRevoke(c *gin.Context) {
+	ctx := c.Request.Context()
+	clientID := c.PostForm("client_id")
+
+	if clientID != "" {
+		if _, err := h.OAuthService.Client(ctx, clientID); err != nil {
+			oauthError(c, err)
+			return
+		}
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		oauthError(c, apperrors.NewOAuth(apperrors.OAuthInvalidRequest, "token is required"))
+		return
+	}
+
+	// the id token is the access token of users, without a hint both kinds are tried
+	hint := c.PostForm("token_type_hint")
+	if hint != "" && hint != "refresh_token" && hint != "access_token" {
+		oauthError(c, apperrors.NewOAuth(apperrors.OAuthUnsupportedTokenType, "only refresh and access tokens can be revoked"))
+		return
+	}
+
+	if hint != "access_token" {
+		if err := h.TokenService.RevokeRefreshToken(ctx, token, clientID); err != nil {
+			logger.Warn("failed to revoke token for client: %q, err: %v", clientID, err)
+			oauthError(c, err)
+			return
+		}
+	}
+
+	if hint != "refresh_token" {
+		if err := h.TokenService.RevokeIDToken(ctx, token); err != nil {
+			logger.Warn("failed to revoke id token for client: %q, err: %v", clientID, err)
+			oauthError(c, err)
+			return
+		}
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// clientCredentials reads the client id and secret from the basic
+// authorization header or from the form, https://www.rfc-editor.org/rfc/rfc6749#section-2.3.1
+func clientCredentials(c *gin.Context) (string, string) {
+	id, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		return c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	if unescaped, err := url.QueryUnescape(id); err == nil {
+		id = unescaped
+	}
+	if unescaped, err := url.QueryUnescape(secret); err == nil {
+		secret = unescaped
+	}
+
+	return id, secret
+}
+
+// limitClient takes a token of the rate limit bucket of the authenticated service account,
+// false when the limit is exceeded and the response is sent
+func (h *Handler) limitClient(c *gin.Context, sa *model.ServiceAccount) bool {
+	c.Set("service", &model.ServicePrincipal{ClientID: sa.ID, Scopes: sa.Scopes})
+	return middleware.Limit(c, h.RateLimitStore, "client", h.ClientRateLimit, middleware.KeyByClient)
+}
+
+// oauthError responds in the error format of RFC 6749
+func oauthError(c *gin.Context, err error) {
+	oe := apperrors.AsOAuth(err)
+	if oe.Code == apperrors.OAuthInvalidClient {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.JSON(oe.Status(), oe)
+}
+
+func withQuery(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
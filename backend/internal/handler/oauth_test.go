@@ -0,0 +1,667 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/Kara4ev/go-web-tmp/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthorize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	client := &model.OAuthClient{ID: "spa", RedirectURIs: []string{"https://app.malcorp.test/callback"}}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"spa"},
+		"redirect_uri":          {"https://app.malcorp.test/callback"},
+		"state":                 {"xyz"},
+		"code_challenge":        {"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+		"code_challenge_method": {"S256"},
+	}
+
+	setup := func(mockOAuthService *mocks.MockOAuthService) *gin.Engine {
+		router := gin.Default()
+
+		NewHandler(&Config{
+			Router:       router,
+			OAuthService: mockOAuthService,
+			BaseUrl:      "/api/account",
+			ConsentURL:   "https://malcorp.test/oauth/consent",
+		})
+		return router
+	}
+
+	t.Run("Redirect to consent page", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockOAuthService.On("ValidateClient", mock.Anything, "spa", "https://app.malcorp.test/callback").Return(client, "https://app.malcorp.test/callback", nil)
+		mockOAuthService.On("Consent", mock.Anything, mock.AnythingOfType("*model.AuthorizationRequest")).Return(&model.Consent{Client: client, Scope: "openid"}, nil)
+
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/api/account/authorize?"+query.Encode(), nil)
+		assert.NoError(t, err)
+
+		setup(mockOAuthService).ServeHTTP(rr, request)
+
+		assert.Equal(t, http.StatusFound, rr.Code)
+		assert.Equal(t, "https://malcorp.test/oauth/consent?"+query.Encode(), rr.Header().Get("Location"))
+		mockOAuthService.AssertExpectations(t)
+		mockOAuthService.AssertNotCalled(t, "Authorize", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Redirect with error", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockOAuthService.On("ValidateClient", mock.Anything, "spa", "https://app.malcorp.test/callback").Return(client, "https://app.malcorp.test/callback", nil)
+		mockOAuthService.On("Consent", mock.Anything, mock.AnythingOfType("*model.AuthorizationRequest")).
+			Return(nil, apperrors.NewOAuth(apperrors.OAuthInvalidScope, "scope is not allowed"))
+
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/api/account/authorize?"+query.Encode(), nil)
+		assert.NoError(t, err)
+
+		setup(mockOAuthService).ServeHTTP(rr, request)
+
+		location, err := url.Parse(rr.Header().Get("Location"))
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusFound, rr.Code)
+		assert.Equal(t, "app.malcorp.test", location.Host)
+		assert.Equal(t, "invalid_scope", location.Query().Get("error"))
+		assert.Equal(t, "xyz", location.Query().Get("state"))
+	})
+
+	t.Run("Invalid redirect uri is not redirected", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockOAuthService.On("ValidateClient", mock.Anything, "spa", "https://app.malcorp.test/callback").
+			Return(nil, "", apperrors.NewBadRequest("redirect_uri is not registered for the client"))
+
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/api/account/authorize?"+query.Encode(), nil)
+		assert.NoError(t, err)
+
+		setup(mockOAuthService).ServeHTTP(rr, request)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Empty(t, rr.Header().Get("Location"))
+		mockOAuthService.AssertNotCalled(t, "Consent", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthorizeConsent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	uid, _ := uuid.NewRandom()
+	client := &model.OAuthClient{ID: "spa", Name: "Malcorp App", RedirectURIs: []string{"https://app.malcorp.test/callback"}}
+
+	authorization := map[string]interface{}{
+		"response_type":         "code",
+		"client_id":             "spa",
+		"redirect_uri":          "https://app.malcorp.test/callback",
+		"state":                 "xyz",
+		"code_challenge":        "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		"code_challenge_method": "S256",
+	}
+
+	setup := func(mockOAuthService *mocks.MockOAuthService) *gin.Engine {
+		router := gin.Default()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", &model.User{UID: uid})
+		})
+
+		NewHandler(&Config{
+			Router:       router,
+			OAuthService: mockOAuthService,
+			BaseUrl:      "/api/account",
+		})
+		return router
+	}
+
+	decide := func(mockOAuthService *mocks.MockOAuthService, approve bool) (*httptest.ResponseRecorder, *url.URL) {
+		body := map[string]interface{}{"approve": approve}
+		for k, v := range authorization {
+			body[k] = v
+		}
+		reqBody, err := json.Marshal(body)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodPost, "/api/account/authorize/consent", strings.NewReader(string(reqBody)))
+		assert.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		setup(mockOAuthService).ServeHTTP(rr, request)
+
+		var resp struct {
+			RedirectTo string `json:"redirect_to"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		location, err := url.Parse(resp.RedirectTo)
+		assert.NoError(t, err)
+
+		return rr, location
+	}
+
+	t.Run("Consent request", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockOAuthService.On("Consent", mock.Anything, mock.AnythingOfType("*model.AuthorizationRequest")).Return(&model.Consent{Client: client, Scope: "openid email"}, nil)
+
+		query := url.Values{}
+		for k, v := range authorization {
+			query.Set(k, v.(string))
+		}
+
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, "/api/account/authorize/consent?"+query.Encode(), nil)
+		assert.NoError(t, err)
+
+		setup(mockOAuthService).ServeHTTP(rr, request)
+
+		var resp struct {
+			Client struct {
+				ID   string `json:"client_id"`
+				Name string `json:"client_name"`
+			} `json:"client"`
+			Scope string `json:"scope"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "spa", resp.Client.ID)
+		assert.Equal(t, "Malcorp App", resp.Client.Name)
+		assert.Equal(t, "openid email", resp.Scope)
+	})
+
+	t.Run("Approve", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockOAuthService.On("ValidateClient", mock.Anything, "spa", "https://app.malcorp.test/callback").Return(client, "https://app.malcorp.test/callback", nil)
+		mockOAuthService.On("Authorize", mock.Anything, uid, mock.AnythingOfType("*model.AuthorizationRequest")).Return("the-code", nil)
+
+		rr, location := decide(mockOAuthService, true)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "https://app.malcorp.test/callback?code=the-code&state=xyz", location.String())
+		mockOAuthService.AssertExpectations(t)
+	})
+
+	t.Run("Deny", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockOAuthService.On("ValidateClient", mock.Anything, "spa", "https://app.malcorp.test/callback").Return(client, "https://app.malcorp.test/callback", nil)
+
+		rr, location := decide(mockOAuthService, false)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "access_denied", location.Query().Get("error"))
+		assert.Equal(t, "xyz", location.Query().Get("state"))
+		assert.Empty(t, location.Query().Get("code"))
+		mockOAuthService.AssertNotCalled(t, "Authorize", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Approve with error", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockOAuthService.On("ValidateClient", mock.Anything, "spa", "https://app.malcorp.test/callback").Return(client, "https://app.malcorp.test/callback", nil)
+		mockOAuthService.On("Authorize", mock.Anything, uid, mock.AnythingOfType("*model.AuthorizationRequest")).
+			Return("", apperrors.NewOAuth(apperrors.OAuthInvalidScope, "scope is not allowed"))
+
+		rr, location := decide(mockOAuthService, true)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "invalid_scope", location.Query().Get("error"))
+		assert.Equal(t, "xyz", location.Query().Get("state"))
+	})
+}
+
+func TestOAuthToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	uid, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com"}
+	client := &model.OAuthClient{ID: "spa"}
+
+	mockTokenResp := &model.TokenPair{
+		IDToken:      model.IDToken{SS: "idToken"},
+		RefreshToken: model.RefreshToken{SS: "refreshToken"},
+	}
+
+	post := func(router *gin.Engine, form url.Values) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		request, _ := http.NewRequest(http.MethodPost, "/api/account/oauth/token", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		router.ServeHTTP(rr, request)
+		return rr
+	}
+
+	t.Run("Authorization code grant", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockUserService := new(mocks.MockUserService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockOAuthService.On("Client", mock.Anything, "spa").Return(client, nil)
+		mockOAuthService.On("ExchangeCode", mock.Anything, "spa", "the-code", "https://app.malcorp.test/callback", "verifier").
+			Return(&model.AuthorizationCode{ClientID: "spa", UID: uid, Scope: "openid"}, nil)
+		mockUserService.On("Get", mock.Anything, uid).Return(u, nil)
+		mockTokenService.On("NewPairFromUser", mock.Anything, u, "", mock.MatchedBy(func(c *model.SessionClient) bool {
+			return c.ClientID == "spa"
+		})).Return(mockTokenResp, nil)
+
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:       router,
+			UserService:  mockUserService,
+			TokenService: mockTokenService,
+			OAuthService: mockOAuthService,
+			BaseUrl:      "/api/account",
+		})
+
+		rr := post(router, url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {"spa"},
+			"code":          {"the-code"},
+			"redirect_uri":  {"https://app.malcorp.test/callback"},
+			"code_verifier": {"verifier"},
+		})
+
+		var resp map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+		assert.Equal(t, "idToken", resp["access_token"])
+		assert.Equal(t, "idToken", resp["id_token"])
+		assert.Equal(t, "refreshToken", resp["refresh_token"])
+		assert.Equal(t, "Bearer", resp["token_type"])
+		assert.Equal(t, "openid", resp["scope"])
+		mockOAuthService.AssertExpectations(t)
+		mockTokenService.AssertExpectations(t)
+	})
+
+	t.Run("Invalid grant", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockOAuthService.On("Client", mock.Anything, "spa").Return(client, nil)
+		mockOAuthService.On("ExchangeCode", mock.Anything, "spa", "used", "", "verifier").
+			Return(nil, apperrors.NewOAuth(apperrors.OAuthInvalidGrant, "invalid or expired authorization code"))
+
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:       router,
+			OAuthService: mockOAuthService,
+			BaseUrl:      "/api/account",
+		})
+
+		rr := post(router, url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {"spa"},
+			"code":          {"used"},
+			"code_verifier": {"verifier"},
+		})
+
+		var resp map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "invalid_grant", resp["error"])
+	})
+
+	t.Run("Refresh of inactive account", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockUserService := new(mocks.MockUserService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		tokenID, _ := uuid.NewRandom()
+		suspended := &model.User{UID: uid, Email: "bob@bob.com", Status: model.UserStatusSuspended}
+
+		mockOAuthService.On("Client", mock.Anything, "spa").Return(client, nil)
+		mockTokenService.On("ValidateRefreshToken", "refreshToken").Return(&model.RefreshToken{ID: tokenID, UID: uid}, nil)
+		mockUserService.On("Get", mock.Anything, uid).Return(suspended, nil)
+		mockTokenService.On("NewPairFromUser", mock.Anything, suspended, tokenID.String(), mock.AnythingOfType("*model.SessionClient")).
+			Return(nil, apperrors.NewForbidden("account is not active"))
+
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:       router,
+			UserService:  mockUserService,
+			TokenService: mockTokenService,
+			OAuthService: mockOAuthService,
+			BaseUrl:      "/api/account",
+		})
+
+		rr := post(router, url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {"spa"},
+			"refresh_token": {"refreshToken"},
+		})
+
+		var resp map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "invalid_grant", resp["error"])
+		assert.Nil(t, resp["access_token"])
+	})
+
+	t.Run("Unsupported grant type", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockOAuthService.On("Client", mock.Anything, "spa").Return(client, nil)
+
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:       router,
+			OAuthService: mockOAuthService,
+			BaseUrl:      "/api/account",
+		})
+
+		rr := post(router, url.Values{
+			"grant_type": {"password"},
+			"client_id":  {"spa"},
+		})
+
+		var resp map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "unsupported_grant_type", resp["error"])
+	})
+
+	t.Run("Unknown client", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockOAuthService.On("Client", mock.Anything, "unknown").
+			Return(nil, apperrors.NewOAuth(apperrors.OAuthInvalidClient, "unknown client_id"))
+
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:       router,
+			OAuthService: mockOAuthService,
+			BaseUrl:      "/api/account",
+		})
+
+		rr := post(router, url.Values{
+			"grant_type": {"authorization_code"},
+			"client_id":  {"unknown"},
+		})
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	sa := &model.ServiceAccount{ID: "billing-job", Scopes: []string{"users:read"}}
+
+	setup := func(mockOAuthService *mocks.MockOAuthService, mockTokenService *mocks.MockTokenService) *gin.Engine {
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:       router,
+			TokenService: mockTokenService,
+			OAuthService: mockOAuthService,
+			BaseUrl:      "/api/account",
+		})
+		return router
+	}
+
+	t.Run("Basic authentication", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockOAuthService.On("AuthenticateServiceAccount", mock.Anything, "billing-job", "secret", "users:read").Return(sa, "users:read", nil)
+		mockTokenService.On("NewAccessToken", mock.Anything, sa, "users:read").
+			Return(&model.AccessToken{SS: "accessToken", Scope: "users:read", ExpiresIn: 900}, nil)
+
+		rr := httptest.NewRecorder()
+		form := url.Values{"grant_type": {"client_credentials"}, "scope": {"users:read"}}
+		request, _ := http.NewRequest(http.MethodPost, "/api/account/oauth/token", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.SetBasicAuth("billing-job", "secret")
+
+		setup(mockOAuthService, mockTokenService).ServeHTTP(rr, request)
+
+		var resp map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "accessToken", resp["access_token"])
+		assert.Equal(t, "Bearer", resp["token_type"])
+		assert.Equal(t, float64(900), resp["expires_in"])
+		assert.NotContains(t, resp, "refresh_token")
+		mockOAuthService.AssertExpectations(t)
+		mockTokenService.AssertExpectations(t)
+	})
+
+	t.Run("Invalid client credentials", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockOAuthService.On("AuthenticateServiceAccount", mock.Anything, "billing-job", "wrong", "").
+			Return(nil, "", apperrors.NewOAuth(apperrors.OAuthInvalidClient, "invalid client credentials"))
+
+		rr := httptest.NewRecorder()
+		form := url.Values{"grant_type": {"client_credentials"}, "client_id": {"billing-job"}, "client_secret": {"wrong"}}
+		request, _ := http.NewRequest(http.MethodPost, "/api/account/oauth/token", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		setup(mockOAuthService, mockTokenService).ServeHTTP(rr, request)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		mockTokenService.AssertNotCalled(t, "NewAccessToken", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestOAuthIntrospect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	sa := &model.ServiceAccount{ID: "resource-server"}
+
+	post := func(router *gin.Engine, form url.Values, secret string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		request, _ := http.NewRequest(http.MethodPost, "/api/account/oauth/introspect", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.SetBasicAuth("resource-server", secret)
+		router.ServeHTTP(rr, request)
+		return rr
+	}
+
+	t.Run("Active token", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockOAuthService.On("AuthenticateServiceAccount", mock.Anything, "resource-server", "secret", "").Return(sa, "", nil)
+		mockTokenService.On("Introspect", mock.Anything, "idToken").
+			Return(&model.TokenIntrospection{Active: true, Sub: "uid", Exp: 1700000000}, nil)
+
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:       router,
+			TokenService: mockTokenService,
+			OAuthService: mockOAuthService,
+			BaseUrl:      "/api/account",
+		})
+
+		rr := post(router, url.Values{"token": {"idToken"}}, "secret")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"active":true,"sub":"uid","exp":1700000000}`, rr.Body.String())
+	})
+
+	t.Run("Inactive token", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockOAuthService.On("AuthenticateServiceAccount", mock.Anything, "resource-server", "secret", "").Return(sa, "", nil)
+		mockTokenService.On("Introspect", mock.Anything, "expired").Return(&model.TokenIntrospection{}, nil)
+
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:       router,
+			TokenService: mockTokenService,
+			OAuthService: mockOAuthService,
+			BaseUrl:      "/api/account",
+		})
+
+		rr := post(router, url.Values{"token": {"expired"}}, "secret")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"active":false}`, rr.Body.String())
+	})
+
+	t.Run("Unauthenticated client", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockOAuthService.On("AuthenticateServiceAccount", mock.Anything, "resource-server", "wrong", "").
+			Return(nil, "", apperrors.NewOAuth(apperrors.OAuthInvalidClient, "invalid client credentials"))
+
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:       router,
+			TokenService: mockTokenService,
+			OAuthService: mockOAuthService,
+			BaseUrl:      "/api/account",
+		})
+
+		rr := post(router, url.Values{"token": {"idToken"}}, "wrong")
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		mockTokenService.AssertNotCalled(t, "Introspect", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Rate limit of authenticated client", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockOAuthService.On("AuthenticateServiceAccount", mock.Anything, "resource-server", "secret", "").Return(sa, "", nil)
+		mockOAuthService.On("AuthenticateServiceAccount", mock.Anything, "resource-server", "wrong", "").
+			Return(nil, "", apperrors.NewOAuth(apperrors.OAuthInvalidClient, "invalid client credentials"))
+		mockTokenService.On("Introspect", mock.Anything, "idToken").Return(&model.TokenIntrospection{}, nil)
+
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:          router,
+			TokenService:    mockTokenService,
+			OAuthService:    mockOAuthService,
+			BaseUrl:         "/api/account",
+			RateLimitStore:  repository.NewMemoryRateLimitStore(),
+			ClientRateLimit: model.RateLimit{Rate: 0.001, Burst: 2},
+		})
+
+		postFrom := func(ip, secret string) int {
+			rr := httptest.NewRecorder()
+			request, _ := http.NewRequest(http.MethodPost, "/api/account/oauth/introspect", strings.NewReader("token=idToken"))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			request.SetBasicAuth("resource-server", secret)
+			request.RemoteAddr = ip + ":1234"
+			router.ServeHTTP(rr, request)
+			return rr.Code
+		}
+
+		// failed authentications with the client id do not empty the bucket of the client
+		assert.Equal(t, http.StatusUnauthorized, postFrom("10.0.0.1", "wrong"))
+		assert.Equal(t, http.StatusUnauthorized, postFrom("10.0.0.1", "wrong"))
+		assert.Equal(t, http.StatusTooManyRequests, postFrom("10.0.0.1", "wrong"))
+
+		// the authenticated client is limited on whatever ip it calls from
+		assert.Equal(t, http.StatusOK, postFrom("10.0.0.2", "secret"))
+		assert.Equal(t, http.StatusOK, postFrom("10.0.0.3", "secret"))
+		assert.Equal(t, http.StatusTooManyRequests, postFrom("10.0.0.4", "secret"))
+	})
+}
+
+func TestOAuthRevoke(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	post := func(router *gin.Engine, form url.Values) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		request, _ := http.NewRequest(http.MethodPost, "/api/account/oauth/revoke", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		router.ServeHTTP(rr, request)
+		return rr
+	}
+
+	t.Run("Refresh token of a client", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockOAuthService.On("Client", mock.Anything, "spa").Return(&model.OAuthClient{ID: "spa"}, nil)
+		mockTokenService.On("RevokeRefreshToken", mock.Anything, "refreshToken", "spa").Return(nil)
+
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:       router,
+			TokenService: mockTokenService,
+			OAuthService: mockOAuthService,
+			BaseUrl:      "/api/account",
+		})
+
+		rr := post(router, url.Values{"token": {"refreshToken"}, "client_id": {"spa"}, "token_type_hint": {"refresh_token"}})
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockTokenService.AssertExpectations(t)
+		mockTokenService.AssertNotCalled(t, "Signout", mock.Anything, mock.Anything)
+	})
+
+	t.Run("First party refresh token", func(t *testing.T) {
+		mockOAuthService := new(mocks.MockOAuthService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockTokenService.On("RevokeRefreshToken", mock.Anything, "refreshToken", "").Return(nil)
+		mockTokenService.On("RevokeIDToken", mock.Anything, "refreshToken").Return(nil)
+
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:       router,
+			TokenService: mockTokenService,
+			OAuthService: mockOAuthService,
+			BaseUrl:      "/api/account",
+		})
+
+		rr := post(router, url.Values{"token": {"refreshToken"}})
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockOAuthService.AssertNotCalled(t, "Client", mock.Anything, mock.Anything)
+		mockTokenService.AssertExpectations(t)
+	})
+
+	t.Run("Access token", func(t *testing.T) {
+		mockTokenService := new(mocks.MockTokenService)
+		mockTokenService.On("RevokeIDToken", mock.Anything, "idToken").Return(nil)
+
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:       router,
+			TokenService: mockTokenService,
+			BaseUrl:      "/api/account",
+		})
+
+		rr := post(router, url.Values{"token": {"idToken"}, "token_type_hint": {"access_token"}})
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockTokenService.AssertExpectations(t)
+		mockTokenService.AssertNotCalled(t, "RevokeRefreshToken", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Unsupported token type", func(t *testing.T) {
+		mockTokenService := new(mocks.MockTokenService)
+
+		router := gin.Default()
+		NewHandler(&Config{
+			Router:       router,
+			TokenService: mockTokenService,
+			BaseUrl:      "/api/account",
+		})
+
+		rr := post(router, url.Values{"token": {"idToken"}, "token_type_hint": {"device_code"}})
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "unsupported_token_type")
+	})
+}
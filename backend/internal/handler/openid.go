@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// openIDConfiguration is the OpenID Connect discovery document,
+// https://openid.net/specs/openid-connect-discovery-1_0.html
+type openIDConfiguration struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint"`
+	RevocationEndpoint               string   `json:"revocation_endpoint"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint"`
+	ScopesSupported                  []string `json:"scopes_supported"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	GrantTypesSupported              []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported    []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethods         []string `json:"token_endpoint_auth_methods_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
+
+type userInfoResp struct {
+	Sub           string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+}
+
+// OpenIDConfiguration handler serves the discovery document
+func (h *Handler) OpenIDConfiguration(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, openIDConfiguration{
+		Issuer:                           h.Issuer,
+		AuthorizationEndpoint:            h.Issuer + h.BaseURL + "/authorize",
+		TokenEndpoint:                    h.Issuer + h.BaseURL + "/oauth/token",
+		IntrospectionEndpoint:            h.Issuer + h.BaseURL + "/oauth/introspect",
+		RevocationEndpoint:               h.Issuer + h.BaseURL + "/oauth/revoke",
+		JWKSURI:                          h.Issuer + "/.well-known/jwks.json",
+		UserInfoEndpoint:                 h.Issuer + h.BaseURL + "/userinfo",
+		ScopesSupported:                  []string{"openid", "email", "profile"},
+		ResponseTypesSupported:           []string{"code", "id_token"},
+		GrantTypesSupported:              []string{"authorization_code", "refresh_token", "client_credentials"},
+		CodeChallengeMethodsSupported:    []string{"S256"},
+		TokenEndpointAuthMethods:         []string{"none", "client_secret_basic", "client_secret_post"},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: h.idTokenSigningAlgs(),
+		ClaimsSupported:                  []string{"iss", "sub", "aud", "exp", "iat", "email", "email_verified", "name", "picture"},
+	})
+}
+
+// idTokenSigningAlgs is the alg of the active signing key, the first key of the jwks
+func (h *Handler) idTokenSigningAlgs() []string {
+	jwks := h.TokenService.JWKS()
+	if len(jwks.Keys) == 0 {
+		return []string{}
+	}
+	return []string{jwks.Keys[0].Alg}
+}
+
+// UserInfo handler returns the standard claims of the signed in user
+func (h *Handler) UserInfo(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		logger.Error("Unable to extract user from request context for unknown reason: %v", c)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	uid := user.(*model.User).UID
+	ctx := c.Request.Context()
+
+	u, err := h.UserService.Get(ctx, uid)
+	if err != nil {
+		logger.Warn("Unable to find user: %v , error: %v", uid, err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, userInfoResp{
+		Sub:           u.UID.String(),
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Name:          u.Name,
+		Picture:       u.ImageURL,
+	})
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestOpenIDConfiguration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	rr := httptest.NewRecorder()
+	router := gin.Default()
+
+	mockTokenService := new(mocks.MockTokenService)
+	mockTokenService.On("JWKS").Return(&model.JSONWebKeySet{
+		Keys: []model.JSONWebKey{{Kty: "EC", Use: "sig", Alg: "ES256", Kid: "new"}, {Kty: "RSA", Use: "sig", Alg: "RS256", Kid: "old"}},
+	})
+
+	NewHandler(&Config{
+		Router:       router,
+		BaseUrl:      "/api/account/",
+		Issuer:       "http://malcorp.test/",
+		TokenService: mockTokenService,
+	})
+
+	request, err := http.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+	assert.NoError(t, err)
+
+	router.ServeHTTP(rr, request)
+
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "http://malcorp.test", doc["issuer"])
+	assert.Equal(t, "http://malcorp.test/.well-known/jwks.json", doc["jwks_uri"])
+	assert.Equal(t, "http://malcorp.test/api/account/userinfo", doc["userinfo_endpoint"])
+	assert.Equal(t, "http://malcorp.test/api/account/authorize", doc["authorization_endpoint"])
+	assert.Equal(t, "http://malcorp.test/api/account/oauth/token", doc["token_endpoint"])
+	assert.Equal(t, []interface{}{"ES256"}, doc["id_token_signing_alg_values_supported"])
+}
+
+func TestUserInfo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	uid, _ := uuid.NewRandom()
+	u := &model.User{
+		UID:           uid,
+		Email:         "bob@bob.com",
+		EmailVerified: true,
+		Name:          "Bob",
+		ImageURL:      "http://malcorp.test/bob.png",
+	}
+
+	mockUserService := new(mocks.MockUserService)
+	mockUserService.On("Get", mock.Anything, uid).Return(u, nil)
+
+	rr := httptest.NewRecorder()
+	router := gin.Default()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &model.User{UID: uid})
+	})
+
+	NewHandler(&Config{
+		Router:      router,
+		UserService: mockUserService,
+		BaseUrl:     "/api/account",
+	})
+
+	request, err := http.NewRequest(http.MethodGet, "/api/account/userinfo", nil)
+	assert.NoError(t, err)
+
+	router.ServeHTTP(rr, request)
+
+	respBody, err := json.Marshal(gin.H{
+		"sub":            uid.String(),
+		"email":          u.Email,
+		"email_verified": true,
+		"name":           u.Name,
+		"picture":        u.ImageURL,
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, string(respBody), rr.Body.String())
+	mockUserService.AssertExpectations(t)
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type forgotPasswordReq struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type resetPasswordReq struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type changePasswordReq struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+	SignoutOthers   bool   `json:"signout_others"`
+}
+
+// ForgotPassword handler
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req forgotPasswordReq
+
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.UserService.ForgotPassword(ctx, req.Email); err != nil {
+		logger.Warn("failed to send reset password email: %v", err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "if the account exists, a reset password email has been sent",
+	})
+}
+
+// ResetPassword handler
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req resetPasswordReq
+
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.UserService.ResetPassword(ctx, req.Token, req.Password); err != nil {
+		logger.Warn("failed to reset password: %v", err)
+		sendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "password changed successfully",
+	})
+}
+
+// ChangePassword handler
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req changePasswordReq
+
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	authUser, exists := c.Get("user")
+	if !exists {
+		logger.Error("Unable to extract user from request context for unknown reason: %v", c)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	uid := authUser.(*model.User).UID
+	ctx := c.Request.Context()
+
+	if err := h.UserService.ChangePassword(ctx, uid, c.GetString("sid"), req.CurrentPassword, req.NewPassword); err != nil {
+		logger.Warn("failed to change password for uid: %v, err: %v", uid, err)
+		sendError(c, err)
+		return
+	}
+
+	if !req.SignoutOthers {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "password changed successfully",
+		})
+		return
+	}
+
+	if err := h.TokenService.Signout(ctx, uid); err != nil {
+		logger.Warn("failed to signout sessions for uid: %v, err: %v", uid, err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	u, err := h.UserService.Get(ctx, uid)
+	if err != nil {
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	tokens, err := h.TokenService.NewPairFromUser(ctx, u, "", sessionClient(c))
+	if err != nil {
+		logger.Warn("failed to create tokens for uid: %v, err: %v", uid, err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	h.sendTokens(c, http.StatusOK, tokens)
+}
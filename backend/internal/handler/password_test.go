@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestChangePassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	baseURL := "/api/account"
+	url := fmt.Sprintf("%s/password", baseURL)
+
+	t.Run("Success with signout of other sessions", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		u := &model.User{UID: uid, Email: "bob@bob.com"}
+
+		mockTokenResp := &model.TokenPair{
+			IDToken:      model.IDToken{SS: "idToken"},
+			RefreshToken: model.RefreshToken{SS: "refreshToken"},
+		}
+
+		mockUserService := new(mocks.MockUserService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockUserService.On("ChangePassword", mock.Anything, uid, "", "current-password", "new-password").Return(nil)
+		mockUserService.On("Get", mock.Anything, uid).Return(u, nil)
+		mockTokenService.On("Signout", mock.Anything, uid).Return(nil)
+		mockTokenService.On("NewPairFromUser", mock.Anything, u, "", mock.AnythingOfType("*model.SessionClient")).Return(mockTokenResp, nil)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", &model.User{UID: uid})
+		})
+
+		NewHandler(&Config{
+			Router:       router,
+			UserService:  mockUserService,
+			TokenService: mockTokenService,
+			BaseUrl:      baseURL,
+		})
+
+		reqBody, err := json.Marshal(gin.H{
+			"current_password": "current-password",
+			"new_password":     "new-password",
+			"signout_others":   true,
+		})
+		assert.NoError(t, err)
+
+		request, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+
+		request.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(rr, request)
+
+		respBody, err := json.Marshal(gin.H{
+			"tokens": mockTokenResp,
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+		mockUserService.AssertExpectations(t)
+		mockTokenService.AssertExpectations(t)
+	})
+
+	t.Run("Signout of other sessions sets cookies in cookie session mode", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		u := &model.User{UID: uid, Email: "bob@bob.com"}
+
+		mockTokenResp := &model.TokenPair{
+			IDToken:      model.IDToken{SS: "idToken"},
+			RefreshToken: model.RefreshToken{SS: "refreshToken"},
+		}
+
+		mockUserService := new(mocks.MockUserService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockUserService.On("ChangePassword", mock.Anything, uid, "", "current-password", "new-password").Return(nil)
+		mockUserService.On("Get", mock.Anything, uid).Return(u, nil)
+		mockTokenService.On("Signout", mock.Anything, uid).Return(nil)
+		mockTokenService.On("NewPairFromUser", mock.Anything, u, "", mock.AnythingOfType("*model.SessionClient")).Return(mockTokenResp, nil)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", &model.User{UID: uid})
+		})
+
+		NewHandler(&Config{
+			Router:              router,
+			UserService:         mockUserService,
+			TokenService:        mockTokenService,
+			BaseUrl:             baseURL,
+			CookieSessions:      true,
+			AccessCookieMaxAge:  900,
+			RefreshCookieMaxAge: 3600,
+		})
+
+		reqBody, err := json.Marshal(gin.H{
+			"current_password": "current-password",
+			"new_password":     "new-password",
+			"signout_others":   true,
+		})
+		assert.NoError(t, err)
+
+		request, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+
+		request.Header.Set("Content-Type", "application/json")
+		request.AddCookie(&http.Cookie{Name: "csrf_token", Value: "csrf"})
+		request.Header.Set("X-CSRF-Token", "csrf")
+		router.ServeHTTP(rr, request)
+
+		cookies := map[string]*http.Cookie{}
+		for _, cookie := range rr.Result().Cookies() {
+			cookies[cookie.Name] = cookie
+		}
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "idToken", cookies["access_token"].Value)
+		assert.Equal(t, "refreshToken", cookies["refresh_token"].Value)
+		assert.True(t, cookies["refresh_token"].HttpOnly)
+
+		var body map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Equal(t, cookies["csrf_token"].Value, body["csrf_token"])
+		assert.NotContains(t, body, "tokens")
+	})
+
+	t.Run("Invalid current password", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		mockError := apperrors.NewAuthorization("invalid current password")
+
+		mockUserService := new(mocks.MockUserService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockUserService.On("ChangePassword", mock.Anything, uid, "", "wrong-password", "new-password").Return(mockError)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", &model.User{UID: uid})
+		})
+
+		NewHandler(&Config{
+			Router:       router,
+			UserService:  mockUserService,
+			TokenService: mockTokenService,
+			BaseUrl:      baseURL,
+		})
+
+		reqBody, err := json.Marshal(gin.H{
+			"current_password": "wrong-password",
+			"new_password":     "new-password",
+			"signout_others":   true,
+		})
+		assert.NoError(t, err)
+
+		request, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+
+		request.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(rr, request)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		mockTokenService.AssertNotCalled(t, "Signout", mock.Anything, mock.Anything)
+	})
+
+	t.Run("New password too short", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+		mockErr := apperrors.NewInvalidArgs("password does not meet the password policy", []apperrors.InvalidArgument{
+			{Field: "new_password", Tag: "min_length", Param: "8"},
+		})
+		mockUserService.On("ChangePassword", mock.Anything, mock.Anything, mock.Anything, "current-password", "pas").Return(mockErr)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", &model.User{})
+		})
+
+		NewHandler(&Config{
+			Router:      router,
+			UserService: mockUserService,
+			BaseUrl:     baseURL,
+		})
+
+		reqBody, err := json.Marshal(gin.H{
+			"current_password": "current-password",
+			"new_password":     "pas",
+		})
+		assert.NoError(t, err)
+
+		request, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+
+		request.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(rr, request)
+
+		respBody, err := json.Marshal(gin.H{
+			"error": mockErr,
+			"invalidArgs": []invalidArgument{
+				{Filed: "new_password", Tag: "min_length", Param: "8"},
+			},
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+	})
+}
+
+func TestForgotPassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	baseURL := "/api/account"
+	url := fmt.Sprintf("%s/password/forgot", baseURL)
+
+	serve := func(mockUserService *mocks.MockUserService, body gin.H) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+
+		NewHandler(&Config{
+			Router:      router,
+			UserService: mockUserService,
+			BaseUrl:     baseURL,
+		})
+
+		reqBody, err := json.Marshal(body)
+		assert.NoError(t, err)
+
+		request, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+
+		request.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(rr, request)
+		return rr
+	}
+
+	t.Run("Known and unknown emails respond alike", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+		mockUserService.On("ForgotPassword", mock.Anything, "bob@bob.com").Return(nil)
+		mockUserService.On("ForgotPassword", mock.Anything, "nobody@bob.com").Return(nil)
+
+		known := serve(mockUserService, gin.H{"email": "bob@bob.com"})
+		unknown := serve(mockUserService, gin.H{"email": "nobody@bob.com"})
+
+		respBody, err := json.Marshal(gin.H{
+			"message": "if the account exists, a reset password email has been sent",
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, known.Code)
+		assert.Equal(t, respBody, known.Body.Bytes())
+		assert.Equal(t, known.Code, unknown.Code)
+		assert.Equal(t, known.Body.Bytes(), unknown.Body.Bytes())
+		mockUserService.AssertExpectations(t)
+	})
+
+	t.Run("Invalid email", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+
+		rr := serve(mockUserService, gin.H{"email": "not-an-email"})
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockUserService.AssertNotCalled(t, "ForgotPassword", mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// sessionClient describes the client of the request for the session metadata
+func sessionClient(c *gin.Context) *model.SessionClient {
+	return &model.SessionClient{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+}
+
+// Sessions handler lists the signed in devices of the user
+func (h *Handler) Sessions(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		logger.Error("Unable to extract user from request context for unknown reason: %v", c)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	sessions, err := h.TokenService.ListSessions(ctx, user.(*model.User).UID, c.GetString("sid"))
+	if err != nil {
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+	})
+}
+
+// DeleteSession handler signs out a single device
+func (h *Handler) DeleteSession(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		logger.Error("Unable to extract user from request context for unknown reason: %v", c)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.TokenService.RevokeSession(ctx, user.(*model.User).UID, c.Param("id")); err != nil {
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "session revoked successfully",
+	})
+}
+
+// DeleteSessions handler signs out every device,
+// with except=current the device of the request stays signed in
+func (h *Handler) DeleteSessions(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		logger.Error("Unable to extract user from request context for unknown reason: %v", c)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	uid := user.(*model.User).UID
+	ctx := c.Request.Context()
+
+	var err error
+	switch c.Query("except") {
+	case "":
+		err = h.TokenService.Signout(ctx, uid)
+	case "current":
+		sid := c.GetString("sid")
+		if sid == "" {
+			err = apperrors.NewBadRequest("current session is unknown, sign in again")
+			break
+		}
+		err = h.TokenService.RevokeOtherSessions(ctx, uid, sid)
+	default:
+		err = apperrors.NewBadRequest("except must be current")
+	}
+
+	if err != nil {
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "sessions revoked successfully",
+	})
+}
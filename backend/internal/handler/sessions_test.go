@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	baseURL := "/api/account"
+	url := fmt.Sprintf("%s/sessions", baseURL)
+
+	uid, _ := uuid.NewRandom()
+	sid := "current-session-id"
+
+	newRouter := func(mockTokenService *mocks.MockTokenService) *gin.Engine {
+		router := gin.Default()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", &model.User{UID: uid})
+			c.Set("sid", sid)
+		})
+
+		NewHandler(&Config{
+			Router:       router,
+			TokenService: mockTokenService,
+			BaseUrl:      baseURL,
+		})
+
+		return router
+	}
+
+	t.Run("List", func(t *testing.T) {
+		sessions := []*model.Session{
+			{ID: sid, UserAgent: "Mozilla/5.0", IP: "10.0.0.1", Current: true},
+			{ID: "other-session-id", UserAgent: "curl/7.79.1", IP: "10.0.0.2"},
+		}
+
+		mockTokenService := new(mocks.MockTokenService)
+		mockTokenService.On("ListSessions", mock.Anything, uid, sid).Return(sessions, nil)
+
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		assert.NoError(t, err)
+
+		newRouter(mockTokenService).ServeHTTP(rr, request)
+
+		respBody, err := json.Marshal(gin.H{
+			"sessions": sessions,
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+		mockTokenService.AssertExpectations(t)
+	})
+
+	t.Run("Delete one", func(t *testing.T) {
+		mockTokenService := new(mocks.MockTokenService)
+		mockTokenService.On("RevokeSession", mock.Anything, uid, "other-session-id").Return(nil)
+
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodDelete, url+"/other-session-id", nil)
+		assert.NoError(t, err)
+
+		newRouter(mockTokenService).ServeHTTP(rr, request)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockTokenService.AssertExpectations(t)
+	})
+
+	t.Run("Delete unknown", func(t *testing.T) {
+		mockTokenService := new(mocks.MockTokenService)
+		mockTokenService.
+			On("RevokeSession", mock.Anything, uid, "unknown").
+			Return(apperrors.NewNotFound("session", "unknown"))
+
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodDelete, url+"/unknown", nil)
+		assert.NoError(t, err)
+
+		newRouter(mockTokenService).ServeHTTP(rr, request)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		mockTokenService.AssertExpectations(t)
+	})
+
+	t.Run("Delete all except current", func(t *testing.T) {
+		mockTokenService := new(mocks.MockTokenService)
+		mockTokenService.On("RevokeOtherSessions", mock.Anything, uid, sid).Return(nil)
+
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodDelete, url+"?except=current", nil)
+		assert.NoError(t, err)
+
+		newRouter(mockTokenService).ServeHTTP(rr, request)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockTokenService.AssertExpectations(t)
+		mockTokenService.AssertNotCalled(t, "Signout", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Delete all", func(t *testing.T) {
+		mockTokenService := new(mocks.MockTokenService)
+		mockTokenService.On("Signout", mock.Anything, uid).Return(nil)
+
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodDelete, url, nil)
+		assert.NoError(t, err)
+
+		newRouter(mockTokenService).ServeHTTP(rr, request)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		mockTokenService.AssertExpectations(t)
+	})
+
+	t.Run("Invalid except", func(t *testing.T) {
+		mockTokenService := new(mocks.MockTokenService)
+
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodDelete, url+"?except=other", nil)
+		assert.NoError(t, err)
+
+		newRouter(mockTokenService).ServeHTTP(rr, request)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		mockTokenService.AssertNotCalled(t, "Signout", mock.Anything, mock.Anything)
+		mockTokenService.AssertNotCalled(t, "RevokeOtherSessions", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/Kara4ev/go-web-tmp/internal/model"
 	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
@@ -11,7 +12,7 @@ import (
 
 type signinReq struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,gte=6,lte=30"`
+	Password string `json:"password" binding:"required"`
 }
 
 func (h *Handler) Signin(c *gin.Context) {
@@ -29,16 +30,49 @@ func (h *Handler) Signin(c *gin.Context) {
 
 	ctx := c.Request.Context()
 
-	if err := h.UserService.Signin(ctx, u); err != nil {
+	if err := h.UserService.Signin(ctx, u, c.ClientIP()); err != nil {
 		logger.Warn("field to sign user: %v", err)
 
+		if retryAfter, ok := apperrors.RetryAfter(err); ok {
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+		}
+
 		c.JSON(apperrors.Status(err), gin.H{
 			"error": err,
 		})
 		return
 	}
 
-	tokens, err := h.TokenService.NewPairFromUser(ctx, u, "")
+	mfaEnabled, err := h.MFAService.Enabled(ctx, u.UID)
+	if err != nil {
+		logger.Warn("field to check mfa for user: %v", err)
+
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	// tokens are issued by SigninMFA after the second factor
+	if mfaEnabled {
+		challenge, err := h.MFAService.NewChallenge(ctx, u.UID)
+		if err != nil {
+			logger.Warn("field to create mfa challenge for user: %v", err)
+
+			c.JSON(apperrors.Status(err), gin.H{
+				"error": err,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    challenge,
+		})
+		return
+	}
+
+	tokens, err := h.TokenService.NewPairFromUser(ctx, u, "", sessionClient(c))
 	if err != nil {
 		logger.Warn("field to sign user: %v", err)
 
@@ -48,8 +82,6 @@ func (h *Handler) Signin(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"tokens": tokens,
-	})
+	h.sendTokens(c, http.StatusOK, tokens)
 
 }
@@ -6,11 +6,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/Kara4ev/go-web-tmp/internal/model"
 	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
 	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -22,6 +24,8 @@ func TestSignin(t *testing.T) {
 	// setup mock services, gin engine/router, handler layer
 	mockUserService := new(mocks.MockUserService)
 	mockTokenService := new(mocks.MockTokenService)
+	mockMFAService := new(mocks.MockMFAService)
+	mockMFAService.On("Enabled", mock.Anything, mock.Anything).Return(false, nil)
 
 	router := gin.Default()
 
@@ -29,6 +33,7 @@ func TestSignin(t *testing.T) {
 		Router:       router,
 		UserService:  mockUserService,
 		TokenService: mockTokenService,
+		MFAService:   mockMFAService,
 	})
 
 	t.Run("Bad request data", func(t *testing.T) {
@@ -60,6 +65,7 @@ func TestSignin(t *testing.T) {
 		mockUSArgs := mock.Arguments{
 			mock.AnythingOfType("*context.emptyCtx"),
 			&model.User{Email: email, Password: password},
+			mock.AnythingOfType("string"),
 		}
 
 		// so we can check for a known status code
@@ -88,6 +94,32 @@ func TestSignin(t *testing.T) {
 		assert.Equal(t, http.StatusUnauthorized, rr.Code)
 	})
 
+	t.Run("Locked out", func(t *testing.T) {
+		email := "locked@bob.com"
+		password := "pwdoesnotmatch123"
+
+		mockUserService.
+			On("Signin", mock.Anything, &model.User{Email: email, Password: password}, mock.AnythingOfType("string")).
+			Return(apperrors.NewTooManyRequests("too many failed signin attempts", 90*time.Second))
+
+		rr := httptest.NewRecorder()
+
+		reqBody, err := json.Marshal(gin.H{
+			"email":    email,
+			"password": password,
+		})
+		assert.NoError(t, err)
+
+		request, err := http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+
+		request.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(rr, request)
+
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "90", rr.Header().Get("Retry-After"))
+	})
+
 	t.Run("Successful Token Creation", func(t *testing.T) {
 		email := "bob@bob.com"
 		password := "pwworksgreat123"
@@ -95,6 +127,7 @@ func TestSignin(t *testing.T) {
 		mockUSArgs := mock.Arguments{
 			mock.AnythingOfType("*context.emptyCtx"),
 			&model.User{Email: email, Password: password},
+			mock.AnythingOfType("string"),
 		}
 
 		mockUserService.On("Signin", mockUSArgs...).Return(nil)
@@ -103,6 +136,7 @@ func TestSignin(t *testing.T) {
 			mock.AnythingOfType("*context.emptyCtx"),
 			&model.User{Email: email, Password: password},
 			"",
+			mock.AnythingOfType("*model.SessionClient"),
 		}
 
 		mockTokenPair := &model.TokenPair{
@@ -147,6 +181,7 @@ func TestSignin(t *testing.T) {
 		mockUSArgs := mock.Arguments{
 			mock.AnythingOfType("*context.emptyCtx"),
 			&model.User{Email: email, Password: password},
+			mock.AnythingOfType("string"),
 		}
 
 		mockUserService.On("Signin", mockUSArgs...).Return(nil)
@@ -155,6 +190,7 @@ func TestSignin(t *testing.T) {
 			mock.AnythingOfType("*context.emptyCtx"),
 			&model.User{Email: email, Password: password},
 			"",
+			mock.AnythingOfType("*model.SessionClient"),
 		}
 
 		mockError := apperrors.NewInternal()
@@ -187,4 +223,56 @@ func TestSignin(t *testing.T) {
 		mockTokenService.AssertCalled(t, "NewPairFromUser", mockTSArgs...)
 	})
 
+	t.Run("MFA challenge instead of tokens", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		email := "mfa@bob.com"
+		password := "pwworksgreat123"
+
+		mockUserService := new(mocks.MockUserService)
+		mockTokenService := new(mocks.MockTokenService)
+		mockMFAService := new(mocks.MockMFAService)
+
+		mockUserService.
+			On("Signin", mock.Anything, &model.User{Email: email, Password: password}, mock.AnythingOfType("string")).
+			Run(func(args mock.Arguments) {
+				args.Get(1).(*model.User).UID = uid
+			}).
+			Return(nil)
+		mockMFAService.On("Enabled", mock.Anything, uid).Return(true, nil)
+		mockMFAService.On("NewChallenge", mock.Anything, uid).Return("challenge", nil)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+
+		NewHandler(&Config{
+			Router:       router,
+			UserService:  mockUserService,
+			TokenService: mockTokenService,
+			MFAService:   mockMFAService,
+		})
+
+		reqBody, err := json.Marshal(gin.H{
+			"email":    email,
+			"password": password,
+		})
+		assert.NoError(t, err)
+
+		request, err := http.NewRequest(http.MethodPost, "/signin", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+
+		request.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(rr, request)
+
+		respBody, err := json.Marshal(gin.H{
+			"mfa_required": true,
+			"mfa_token":    "challenge",
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+		mockMFAService.AssertExpectations(t)
+		mockTokenService.AssertNotCalled(t, "NewPairFromUser", mock.Anything, mock.Anything, mock.Anything)
+	})
+
 }
@@ -30,6 +30,7 @@ func (h *Handler) Signout(c *gin.Context) {
 		return
 	}
 
+	h.clearSessionCookies(c)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "user signet out successfully",
 	})
@@ -11,7 +11,7 @@ import (
 
 type signupReq struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,gte=6,lte=30"`
+	Password string `json:"password" binding:"required"`
 }
 
 func (h *Handler) Signup(c *gin.Context) {
@@ -30,13 +30,18 @@ func (h *Handler) Signup(c *gin.Context) {
 	ctx := c.Request.Context()
 	if err := h.UserService.Signup(ctx, u); err != nil {
 		logger.Warn("failed to signup up to user: %+v", err.Error())
-		c.JSON(apperrors.Status(err), gin.H{
-			"error": err,
+		sendError(c, err)
+		return
+	}
+
+	if h.RequireEmailVerification {
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "user signed up, check your email to verify the address",
 		})
 		return
 	}
 
-	tokens, err := h.TokenService.NewPairFromUser(ctx, u, "")
+	tokens, err := h.TokenService.NewPairFromUser(ctx, u, "", sessionClient(c))
 
 	if err != nil {
 		logger.Warn("failed to create tokens from user: %+v", err.Error())
@@ -45,8 +50,6 @@ func (h *Handler) Signup(c *gin.Context) {
 		})
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{
-		"tokens": tokens,
-	})
+	h.sendTokens(c, http.StatusCreated, tokens)
 
 }
@@ -266,7 +266,7 @@ func TestSignup(t *testing.T) {
 			Return(nil)
 
 		mockTokenService.
-			On("NewPairFromUser", mock.AnythingOfType("*context.emptyCtx"), u, "").
+			On("NewPairFromUser", mock.AnythingOfType("*context.emptyCtx"), u, "", mock.AnythingOfType("*model.SessionClient")).
 			Return(mockTokenResp, nil)
 
 		rr := httptest.NewRecorder()
@@ -321,7 +321,7 @@ func TestSignup(t *testing.T) {
 			Return(nil)
 
 		mockTokenService.
-			On("NewPairFromUser", mock.AnythingOfType("*context.emptyCtx"), u, "").
+			On("NewPairFromUser", mock.AnythingOfType("*context.emptyCtx"), u, "", mock.AnythingOfType("*model.SessionClient")).
 			Return(nil, mockErrorRespon)
 
 		rr := httptest.NewRecorder()
@@ -12,18 +12,23 @@ type tokenReq struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
+// cookieTokenReq is the body of Tokens in cookie session mode,
+// where the refresh token usually comes in its cookie
+type cookieTokenReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 // Tokens handler
 func (h *Handler) Tokens(c *gin.Context) {
 
-	var req tokenReq
-
-	if ok := bindData(c, &req); !ok {
+	ss, ok := h.refreshToken(c)
+	if !ok {
 		return
 	}
 
 	ctx := c.Request.Context()
 
-	refreshToken, err := h.TokenService.ValidateRefreshToken(req.RefreshToken)
+	refreshToken, err := h.TokenService.ValidateRefreshToken(ss)
 	if err != nil {
 		c.JSON(apperrors.Status(err), gin.H{
 			"error": err,
@@ -39,18 +44,17 @@ func (h *Handler) Tokens(c *gin.Context) {
 		return
 	}
 
-	tokens, err := h.TokenService.NewPairFromUser(ctx, u, refreshToken.ID.String())
+	tokens, err := h.TokenService.NewPairFromUser(ctx, u, refreshToken.ID.String(), sessionClient(c))
 
 	if err != nil {
-		logger.Warn("failed to create tokens for user %+v, error: %v", u, err)
+		// a reused refresh token revokes its session, the client has to sign in again
+		logger.Warn("failed to rotate refresh token: %s for uid: %v, error: %v", refreshToken.ID, u.UID, err)
 		c.JSON(apperrors.Status(err), gin.H{
 			"error": err,
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"tokens": tokens,
-	})
+	h.sendTokens(c, http.StatusOK, tokens)
 
 }
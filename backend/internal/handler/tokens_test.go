@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	baseURL := "/api/account"
+	url := fmt.Sprintf("%s/tokens", baseURL)
+
+	uid, _ := uuid.NewRandom()
+	tokenID, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com"}
+
+	refreshToken := &model.RefreshToken{ID: tokenID, UID: uid, SS: "refreshToken"}
+
+	reqBody, err := json.Marshal(gin.H{
+		"refresh_token": "refreshToken",
+	})
+	assert.NoError(t, err)
+
+	t.Run("Rotates refresh token", func(t *testing.T) {
+		mockTokenResp := &model.TokenPair{
+			IDToken:      model.IDToken{SS: "newIDToken"},
+			RefreshToken: model.RefreshToken{SS: "newRefreshToken"},
+		}
+
+		mockUserService := new(mocks.MockUserService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockTokenService.On("ValidateRefreshToken", "refreshToken").Return(refreshToken, nil)
+		mockUserService.On("Get", mock.Anything, uid).Return(u, nil)
+		mockTokenService.
+			On("NewPairFromUser", mock.Anything, u, tokenID.String(), mock.AnythingOfType("*model.SessionClient")).
+			Return(mockTokenResp, nil)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+
+		NewHandler(&Config{
+			Router:       router,
+			UserService:  mockUserService,
+			TokenService: mockTokenService,
+			BaseUrl:      baseURL,
+		})
+
+		request, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		router.ServeHTTP(rr, request)
+
+		respBody, err := json.Marshal(gin.H{
+			"tokens": mockTokenResp,
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+		mockTokenService.AssertExpectations(t)
+	})
+
+	t.Run("Reused refresh token", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockErr := apperrors.NewAuthorization("refresh token was already used, the session is revoked")
+
+		mockTokenService.On("ValidateRefreshToken", "refreshToken").Return(refreshToken, nil)
+		mockUserService.On("Get", mock.Anything, uid).Return(u, nil)
+		mockTokenService.
+			On("NewPairFromUser", mock.Anything, u, tokenID.String(), mock.AnythingOfType("*model.SessionClient")).
+			Return(nil, mockErr)
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+
+		NewHandler(&Config{
+			Router:       router,
+			UserService:  mockUserService,
+			TokenService: mockTokenService,
+			BaseUrl:      baseURL,
+		})
+
+		request, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		router.ServeHTTP(rr, request)
+
+		respBody, err := json.Marshal(gin.H{
+			"error": mockErr,
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Equal(t, respBody, rr.Body.Bytes())
+		mockTokenService.AssertExpectations(t)
+	})
+
+	t.Run("Suspended account", func(t *testing.T) {
+		mockUserService := new(mocks.MockUserService)
+		mockTokenService := new(mocks.MockTokenService)
+
+		mockTokenService.On("ValidateRefreshToken", "refreshToken").Return(refreshToken, nil)
+		mockUserService.On("Get", mock.Anything, uid).Return(&model.User{UID: uid, Status: model.UserStatusSuspended}, nil)
+		mockTokenService.On("NewPairFromUser", mock.Anything, mock.AnythingOfType("*model.User"), refreshToken.ID.String(), mock.AnythingOfType("*model.SessionClient")).
+			Return(nil, apperrors.NewForbidden("account is not active"))
+
+		rr := httptest.NewRecorder()
+		router := gin.Default()
+
+		NewHandler(&Config{
+			Router:       router,
+			UserService:  mockUserService,
+			TokenService: mockTokenService,
+			BaseUrl:      baseURL,
+		})
+
+		request, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+
+		router.ServeHTTP(rr, request)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		mockTokenService.AssertExpectations(t)
+	})
+}
+
+func TestTokensCookieSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	baseURL := "/api/account"
+	url := fmt.Sprintf("%s/tokens", baseURL)
+
+	uid, _ := uuid.NewRandom()
+	tokenID, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com"}
+
+	refreshToken := &model.RefreshToken{ID: tokenID, UID: uid, SS: "refreshToken"}
+	mockTokenResp := &model.TokenPair{
+		IDToken:      model.IDToken{SS: "newIDToken"},
+		RefreshToken: model.RefreshToken{SS: "newRefreshToken"},
+	}
+
+	mockUserService := new(mocks.MockUserService)
+	mockTokenService := new(mocks.MockTokenService)
+
+	mockTokenService.On("ValidateRefreshToken", "refreshToken").Return(refreshToken, nil)
+	mockUserService.On("Get", mock.Anything, uid).Return(u, nil)
+	mockTokenService.
+		On("NewPairFromUser", mock.Anything, u, tokenID.String(), mock.AnythingOfType("*model.SessionClient")).
+		Return(mockTokenResp, nil)
+
+	router := gin.Default()
+
+	NewHandler(&Config{
+		Router:              router,
+		UserService:         mockUserService,
+		TokenService:        mockTokenService,
+		BaseUrl:             baseURL,
+		CookieSessions:      true,
+		AccessCookieMaxAge:  900,
+		RefreshCookieMaxAge: 3600,
+	})
+
+	serve := func(csrfHeader string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodPost, url, bytes.NewBufferString("{}"))
+		assert.NoError(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		request.AddCookie(&http.Cookie{Name: "refresh_token", Value: "refreshToken"})
+		request.AddCookie(&http.Cookie{Name: "csrf_token", Value: "csrf"})
+		if csrfHeader != "" {
+			request.Header.Set("X-CSRF-Token", csrfHeader)
+		}
+		router.ServeHTTP(rr, request)
+		return rr
+	}
+
+	t.Run("Rotates refresh token cookie", func(t *testing.T) {
+		rr := serve("csrf")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		cookies := map[string]*http.Cookie{}
+		for _, cookie := range rr.Result().Cookies() {
+			cookies[cookie.Name] = cookie
+		}
+
+		assert.Equal(t, "newIDToken", cookies["access_token"].Value)
+		assert.Equal(t, "newRefreshToken", cookies["refresh_token"].Value)
+		assert.Equal(t, "/api/account/tokens", cookies["refresh_token"].Path)
+		assert.Equal(t, 3600, cookies["refresh_token"].MaxAge)
+		assert.True(t, cookies["refresh_token"].HttpOnly)
+		assert.True(t, cookies["refresh_token"].Secure)
+		assert.Equal(t, http.SameSiteStrictMode, cookies["refresh_token"].SameSite)
+		assert.False(t, cookies["csrf_token"].HttpOnly)
+
+		var body map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Equal(t, cookies["csrf_token"].Value, body["csrf_token"])
+		assert.NotContains(t, body, "tokens")
+	})
+
+	t.Run("Missing csrf token", func(t *testing.T) {
+		rr := serve("")
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("Refresh cookie path is the tokens route of the base url", func(t *testing.T) {
+		for base, tokensPath := range map[string]string{
+			"/api/account/": "/api/account/tokens",
+			"/":             "/tokens",
+		} {
+			router := gin.Default()
+			NewHandler(&Config{
+				Router:              router,
+				UserService:         mockUserService,
+				TokenService:        mockTokenService,
+				BaseUrl:             base,
+				CookieSessions:      true,
+				AccessCookieMaxAge:  900,
+				RefreshCookieMaxAge: 3600,
+			})
+
+			rr := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodPost, tokensPath, bytes.NewBufferString("{}"))
+			assert.NoError(t, err)
+			request.Header.Set("Content-Type", "application/json")
+			request.AddCookie(&http.Cookie{Name: "refresh_token", Value: "refreshToken"})
+			request.AddCookie(&http.Cookie{Name: "csrf_token", Value: "csrf"})
+			request.Header.Set("X-CSRF-Token", "csrf")
+			router.ServeHTTP(rr, request)
+
+			assert.Equal(t, http.StatusOK, rr.Code, base)
+			for _, cookie := range rr.Result().Cookies() {
+				if cookie.Name == "refresh_token" {
+					assert.Equal(t, tokensPath, cookie.Path, base)
+				}
+			}
+		}
+	})
+}
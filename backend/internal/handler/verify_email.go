@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type verifyEmailReq struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type resendVerificationReq struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// VerifyEmail handler
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var req verifyEmailReq
+
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.UserService.VerifyEmail(ctx, req.Token); err != nil {
+		logger.Warn("failed to verify email: %v", err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "email verified successfully",
+	})
+}
+
+// ResendVerification handler
+func (h *Handler) ResendVerification(c *gin.Context) {
+	var req resendVerificationReq
+
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.UserService.ResendVerification(ctx, req.Email); err != nil {
+		logger.Warn("failed to resend verification email: %v", err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "if the account exists and is not verified, a verification email has been sent",
+	})
+}
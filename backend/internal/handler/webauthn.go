@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+type webAuthnRegisterReq struct {
+	ID       string `json:"id" binding:"required"`
+	Type     string `json:"type" binding:"required,eq=public-key"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+		AttestationObject string `json:"attestationObject" binding:"required"`
+	} `json:"response" binding:"required"`
+}
+
+type webAuthnLoginBeginReq struct {
+	Email string `json:"email" binding:"omitempty,email"`
+}
+
+type webAuthnLoginReq struct {
+	ID       string `json:"id" binding:"required"`
+	Type     string `json:"type" binding:"required,eq=public-key"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+		AuthenticatorData string `json:"authenticatorData" binding:"required"`
+		Signature         string `json:"signature" binding:"required"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response" binding:"required"`
+}
+
+// WebAuthnRegisterBegin handler
+func (h *Handler) WebAuthnRegisterBegin(c *gin.Context) {
+	authUser, exists := c.Get("user")
+	if !exists {
+		logger.Error("Unable to extract user from request context for unknown reason: %v", c)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	options, err := h.WebAuthnService.BeginRegistration(ctx, authUser.(*model.User))
+	if err != nil {
+		logger.Warn("failed to begin webauthn registration: %v", err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"publicKey": options,
+	})
+}
+
+// WebAuthnRegisterFinish handler
+func (h *Handler) WebAuthnRegisterFinish(c *gin.Context) {
+	var req webAuthnRegisterReq
+
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	authUser, exists := c.Get("user")
+	if !exists {
+		logger.Error("Unable to extract user from request context for unknown reason: %v", c)
+		err := apperrors.NewInternal()
+		c.JSON(err.Status(), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	err := h.WebAuthnService.FinishRegistration(ctx, authUser.(*model.User).UID, &model.WebAuthnAttestation{
+		ID:                req.ID,
+		ClientDataJSON:    req.Response.ClientDataJSON,
+		AttestationObject: req.Response.AttestationObject,
+	})
+	if err != nil {
+		logger.Warn("failed to finish webauthn registration: %v", err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "passkey registered successfully",
+	})
+}
+
+// WebAuthnLoginBegin handler
+func (h *Handler) WebAuthnLoginBegin(c *gin.Context) {
+	var req webAuthnLoginBeginReq
+
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	options, err := h.WebAuthnService.BeginLogin(ctx, req.Email)
+	if err != nil {
+		logger.Warn("failed to begin webauthn login: %v", err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"publicKey": options,
+	})
+}
+
+// WebAuthnLoginFinish handler
+func (h *Handler) WebAuthnLoginFinish(c *gin.Context) {
+	var req webAuthnLoginReq
+
+	if ok := bindData(c, &req); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	uid, err := h.WebAuthnService.FinishLogin(ctx, &model.WebAuthnAssertion{
+		ID:                req.ID,
+		ClientDataJSON:    req.Response.ClientDataJSON,
+		AuthenticatorData: req.Response.AuthenticatorData,
+		Signature:         req.Response.Signature,
+		UserHandle:        req.Response.UserHandle,
+	})
+	if err != nil {
+		logger.Warn("failed to finish webauthn login: %v", err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	u, err := h.UserService.Get(ctx, uid)
+	if err != nil {
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	tokens, err := h.TokenService.NewPairFromUser(ctx, u, "", sessionClient(c))
+	if err != nil {
+		logger.Warn("failed to create tokens for uid: %v, err: %v", uid, err)
+		c.JSON(apperrors.Status(err), gin.H{
+			"error": err,
+		})
+		return
+	}
+
+	h.sendTokens(c, http.StatusOK, tokens)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type Type string
@@ -12,16 +13,30 @@ const (
 	Authorization        Type = "AUTHORIZATION"          // Authentication Failures -
 	BadRequest           Type = "BAD_REQUEST"            // Validation errors / BadInput
 	Conflict             Type = "CONFLICT"               // Already exists (eg, create account with existent email) - 409
+	Forbidden            Type = "FORBIDDEN"              // Authenticated, but not allowed (eg, unverified email) - 403
 	Internal             Type = "INTERNAL"               // Server (500) and fallback errors
 	NotFound             Type = "NOT_FOUND"              // For not finding resource
 	PayloadTooLarge      Type = "PAYLOAD_TOO_LARGE"      // for uploading tons of JSON, or an image over the limit - 413
 	ServisUnavailable    Type = "SERVIS_UNAVAILABLE"     // for long running hendler
+	TooManyRequests      Type = "TOO_MANY_REQUESTS"      // rate limited or locked out, with Retry-After - 429
 	UnsupportedMediaType Type = "UNSUPPORTED_MEDIA_TYPE" // for http 415
 )
 
 type Error struct {
 	Type    Type   `json:"type"`
 	Message string `json:"message"`
+	// RetryAfter is the seconds to wait before retrying a TooManyRequests error
+	RetryAfter int `json:"retryAfter,omitempty"`
+	// InvalidArgs are the reasons of a BadRequest error, sent as invalidArgs
+	InvalidArgs []InvalidArgument `json:"-"`
+}
+
+// InvalidArgument is a reason a field of the request is invalid,
+// Tag names the rule and Param is its parameter
+type InvalidArgument struct {
+	Field string
+	Tag   string
+	Param string
 }
 
 func (e *Error) Error() string {
@@ -36,6 +51,8 @@ func (e *Error) Status() int {
 		return http.StatusBadRequest
 	case Conflict:
 		return http.StatusConflict
+	case Forbidden:
+		return http.StatusForbidden
 	case Internal:
 		return http.StatusInternalServerError
 	case NotFound:
@@ -46,6 +63,8 @@ func (e *Error) Status() int {
 		return http.StatusServiceUnavailable
 	case UnsupportedMediaType:
 		return http.StatusUnsupportedMediaType
+	case TooManyRequests:
+		return http.StatusTooManyRequests
 	default:
 		return http.StatusInternalServerError
 	}
@@ -59,9 +78,32 @@ func Status(err error) int {
 	if errors.As(err, &e) {
 		return e.Status()
 	}
+	var oe *OAuthError
+	if errors.As(err, &oe) {
+		return oe.Status()
+	}
 	return http.StatusInternalServerError
 }
 
+// RetryAfter returns the seconds to wait before retrying
+// if the error is a TooManyRequests error
+func RetryAfter(err error) (int, bool) {
+	var e *Error
+	if errors.As(err, &e) && e.Type == TooManyRequests {
+		return e.RetryAfter, true
+	}
+	return 0, false
+}
+
+// InvalidArgs returns the reasons of a BadRequest error
+func InvalidArgs(err error) []InvalidArgument {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.InvalidArgs
+	}
+	return nil
+}
+
 /*
 * Error "Factories"
  */
@@ -82,6 +124,13 @@ func NewBadRequest(reason string) *Error {
 	}
 }
 
+// NewInvalidArgs to create 400 errors with the reasons of the invalid fields
+func NewInvalidArgs(reason string, args []InvalidArgument) *Error {
+	e := NewBadRequest(reason)
+	e.InvalidArgs = args
+	return e
+}
+
 // NewConflict to create an error for 409
 func NewConflict(name string, value string) *Error {
 	return &Error{
@@ -90,6 +139,14 @@ func NewConflict(name string, value string) *Error {
 	}
 }
 
+// NewForbidden to create an error for 403
+func NewForbidden(reason string) *Error {
+	return &Error{
+		Type:    Forbidden,
+		Message: reason,
+	}
+}
+
 // NewInternal for 500 errors and unknown errors
 func NewInternal() *Error {
 	return &Error{
@@ -121,6 +178,20 @@ func NewServiceUnavailable() *Error {
 	}
 }
 
+// NewTooManyRequests to create an error for 429, retryAfter is rounded up to whole seconds
+func NewTooManyRequests(reason string, retryAfter time.Duration) *Error {
+	secs := int((retryAfter + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+
+	return &Error{
+		Type:       TooManyRequests,
+		Message:    reason,
+		RetryAfter: secs,
+	}
+}
+
 // NewUnsupportedMediaType to create an error for 415
 func NewUnsupportedMediaType(reason string) *Error {
 	return &Error{
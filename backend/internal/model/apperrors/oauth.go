@@ -0,0 +1,71 @@
+package apperrors
+
+import (
+	"errors"
+	"net/http"
+)
+
+// OAuth error codes, https://www.rfc-editor.org/rfc/rfc6749#section-5.2
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthAccessDenied            = "access_denied"
+	OAuthServerError             = "server_error"
+	// OAuthUnsupportedTokenType is a revocation error, https://www.rfc-editor.org/rfc/rfc7009#section-2.2.1
+	OAuthUnsupportedTokenType = "unsupported_token_type"
+)
+
+// OAuthError is an error of the OAuth endpoints, it is
+// serialized in the format clients of RFC 6749 expect
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func (e *OAuthError) Status() int {
+	switch e.Code {
+	case OAuthInvalidClient:
+		return http.StatusUnauthorized
+	case OAuthServerError:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// NewOAuth to create an OAuth error response
+func NewOAuth(code, description string) *OAuthError {
+	return &OAuthError{
+		Code:        code,
+		Description: description,
+	}
+}
+
+// AsOAuth converts errors of the services to an OAuth error response
+func AsOAuth(err error) *OAuthError {
+	var oe *OAuthError
+	if errors.As(err, &oe) {
+		return oe
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		switch e.Type {
+		case Authorization, NotFound, Forbidden:
+			return NewOAuth(OAuthInvalidGrant, e.Message)
+		case BadRequest:
+			return NewOAuth(OAuthInvalidRequest, e.Message)
+		}
+	}
+
+	return NewOAuth(OAuthServerError, "internal server error")
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// statuses of a data export
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// DataExport is an archive of the personal data of a user, it is generated in the
+// background and can be downloaded by the user until it expires
+type DataExport struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt is when the archive of a ready export is deleted
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// URL is the download link of a ready export
+	URL string `json:"url,omitempty"`
+}
@@ -10,15 +10,70 @@ import (
 type UserService interface {
 	Get(ctx context.Context, uid uuid.UUID) (*User, error)
 	Signup(ctx context.Context, u *User) error
-	Signin(ctx context.Context, u *User) error
+	Signin(ctx context.Context, u *User, ip string) error
 	UpdateDetails(ctx context.Context, u *User) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	ChangePassword(ctx context.Context, uid uuid.UUID, sid, currentPassword, newPassword string) error
+	DeleteAccount(ctx context.Context, uid uuid.UUID, password string) (time.Time, error)
+	PurgeDeletedAccounts(ctx context.Context) (int64, error)
+
+	// user management of the admin api
+	ListUsers(ctx context.Context, f *UserFilter) ([]*User, int64, error)
+	UpdateUser(ctx context.Context, uid uuid.UUID, upd *UserUpdate) (*User, error)
+	ForcePasswordReset(ctx context.Context, uid uuid.UUID) error
+	Suspend(ctx context.Context, uid uuid.UUID) error
+	Unsuspend(ctx context.Context, uid uuid.UUID) error
+	Delete(ctx context.Context, uid uuid.UUID) error
+}
+
+// ExportService generates the personal data exports of users, RequestExport
+// returns the current export of the user and starts one when there is none
+type ExportService interface {
+	RequestExport(ctx context.Context, uid uuid.UUID) (*DataExport, error)
+	Archive(ctx context.Context, uid uuid.UUID, id string) ([]byte, error)
 }
 
 type TokenService interface {
-	NewPairFromUser(ctx context.Context, u *User, prevTokenID string) (*TokenPair, error)
+	NewPairFromUser(ctx context.Context, u *User, prevTokenID string, client *SessionClient) (*TokenPair, error)
 	Signout(ctx context.Context, uid uuid.UUID) error
-	ValidateIDToken(tokenString string) (*User, error)
+	ValidateIDToken(tokenString string) (*IDTokenClaims, error)
 	ValidateRefreshToken(tokenString string) (*RefreshToken, error)
+	NewAccessToken(ctx context.Context, sa *ServiceAccount, scope string) (*AccessToken, error)
+	ValidateAccessToken(tokenString string) (*ServicePrincipal, error)
+	Introspect(ctx context.Context, tokenString string) (*TokenIntrospection, error)
+	RevokeRefreshToken(ctx context.Context, tokenString, clientID string) error
+	RevokeIDToken(ctx context.Context, tokenString string) error
+	JWKS() *JSONWebKeySet
+	ListSessions(ctx context.Context, uid uuid.UUID, currentSessionID string) ([]*Session, error)
+	RevokeSession(ctx context.Context, uid uuid.UUID, sessionID string) error
+	RevokeOtherSessions(ctx context.Context, uid uuid.UUID, currentSessionID string) error
+}
+
+type MFAService interface {
+	SetupTOTP(ctx context.Context, u *User) (string, error)
+	ConfirmTOTP(ctx context.Context, uid uuid.UUID, code string) ([]string, error)
+	Enabled(ctx context.Context, uid uuid.UUID) (bool, error)
+	NewChallenge(ctx context.Context, uid uuid.UUID) (string, error)
+	VerifyChallenge(ctx context.Context, challenge, code, ip string) (uuid.UUID, error)
+}
+
+type WebAuthnService interface {
+	BeginRegistration(ctx context.Context, u *User) (*WebAuthnCreationOptions, error)
+	FinishRegistration(ctx context.Context, uid uuid.UUID, a *WebAuthnAttestation) error
+	BeginLogin(ctx context.Context, email string) (*WebAuthnRequestOptions, error)
+	FinishLogin(ctx context.Context, a *WebAuthnAssertion) (uuid.UUID, error)
+}
+
+type OAuthService interface {
+	ValidateClient(ctx context.Context, clientID, redirectURI string) (*OAuthClient, string, error)
+	Consent(ctx context.Context, r *AuthorizationRequest) (*Consent, error)
+	Authorize(ctx context.Context, uid uuid.UUID, r *AuthorizationRequest) (string, error)
+	ExchangeCode(ctx context.Context, clientID, code, redirectURI, codeVerifier string) (*AuthorizationCode, error)
+	Client(ctx context.Context, clientID string) (*OAuthClient, error)
+	AuthenticateServiceAccount(ctx context.Context, clientID, secret, scope string) (*ServiceAccount, string, error)
 }
 
 type UserRepository interface {
@@ -26,10 +81,108 @@ type UserRepository interface {
 	FindByEmail(ctx context.Context, email string) (*User, error)
 	Create(ctx context.Context, u *User) error
 	Update(ctx context.Context, u *User) error
+	SetEmailVerified(ctx context.Context, uid uuid.UUID) error
+	UpdatePassword(ctx context.Context, uid uuid.UUID, password string) error
+	List(ctx context.Context, f *UserFilter) ([]*User, int64, error)
+	Save(ctx context.Context, u *User) error
+	SetStatus(ctx context.Context, uid uuid.UUID, status string) error
+	Delete(ctx context.Context, uid uuid.UUID) error
+	ScheduleDeletion(ctx context.Context, uid uuid.UUID, at time.Time) error
+	CancelDeletion(ctx context.Context, uid uuid.UUID) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 }
 
 type TokenRepository interface {
-	SetRefreshToken(ctx context.Context, userID, tokenID string, expiresIn time.Duration) error
-	DeleteRefreshToken(ctx context.Context, userID, prevTokenID string) error
+	SetRefreshToken(ctx context.Context, userID, tokenID string, s *Session, expiresIn time.Duration) error
+	GetRefreshToken(ctx context.Context, userID, tokenID string) (*Session, error)
+	SetOpaqueRefreshToken(ctx context.Context, tokenHash string, t *OpaqueRefreshToken, expiresIn time.Duration) error
+	GetOpaqueRefreshToken(ctx context.Context, tokenHash string) (*OpaqueRefreshToken, error)
+	DeleteRefreshToken(ctx context.Context, userID, prevTokenID string) (*Session, error)
+	RotateRefreshToken(ctx context.Context, userID, prevTokenID string, expiresIn time.Duration) (*Session, bool, error)
 	DeleteUserRefreshToken(ctx context.Context, userID string) error
+	ListSessions(ctx context.Context, userID string) ([]*Session, error)
+	SetOneTimeToken(ctx context.Context, purpose, tokenHash, userID string, expiresIn time.Duration) error
+	ConsumeOneTimeToken(ctx context.Context, purpose, tokenHash string) (string, error)
+	GetOneTimeToken(ctx context.Context, purpose, tokenHash string) (string, error)
+	IncrOneTimeTokenAttempts(ctx context.Context, purpose, tokenHash string, expiresIn time.Duration) (int64, error)
+	SetAuthorizationCode(ctx context.Context, codeHash string, code *AuthorizationCode, expiresIn time.Duration) error
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*AuthorizationCode, error)
+	DenyTokens(ctx context.Context, ids []string, expiresIn time.Duration) error
+	IsTokenDenied(ctx context.Context, id string) (bool, error)
+}
+
+// LoginAttemptRepository counts failed signins in a sliding window and locks keys
+// out, keys are the email or client ip of the attempts
+type LoginAttemptRepository interface {
+	AddFailure(ctx context.Context, key string, at time.Time, window time.Duration) (int64, error)
+	Failures(ctx context.Context, key string, now time.Time, window time.Duration) (int64, time.Time, error)
+	ResetFailures(ctx context.Context, key string) error
+	Lock(ctx context.Context, key string, d time.Duration) error
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+}
+
+// DataExportRepository keeps the current data export of each user and its archive
+// until they expire. CreateExport does nothing and returns false when the user
+// has an export already, SetArchive stores the archive with the ready export
+type DataExportRepository interface {
+	CreateExport(ctx context.Context, uid uuid.UUID, e *DataExport, expiresIn time.Duration) (bool, error)
+	GetExport(ctx context.Context, uid uuid.UUID) (*DataExport, error)
+	SetExport(ctx context.Context, uid uuid.UUID, e *DataExport, expiresIn time.Duration) error
+	SetArchive(ctx context.Context, uid uuid.UUID, e *DataExport, archive []byte, expiresIn time.Duration) error
+	GetArchive(ctx context.Context, uid uuid.UUID, id string) ([]byte, error)
+}
+
+// RateLimitStore keeps token buckets, Take takes a token of the bucket of key
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, l RateLimit, now time.Time) (*RateLimitResult, error)
+}
+
+type MFARepository interface {
+	FindTOTP(ctx context.Context, uid uuid.UUID) (*TOTP, error)
+	SaveTOTP(ctx context.Context, t *TOTP) error
+	ConfirmTOTP(ctx context.Context, uid uuid.UUID, recoveryCodeHashes []string) error
+	UpdateTOTPLastUsedStep(ctx context.Context, uid uuid.UUID, step int64) error
+	UseRecoveryCode(ctx context.Context, uid uuid.UUID, codeHash string) error
+}
+
+type WebAuthnRepository interface {
+	Create(ctx context.Context, c *WebAuthnCredential) error
+	FindByID(ctx context.Context, id string) (*WebAuthnCredential, error)
+	FindByUID(ctx context.Context, uid uuid.UUID) ([]*WebAuthnCredential, error)
+	UpdateSignCount(ctx context.Context, id string, signCount int64) error
+}
+
+// SecurityEventRepository keeps the login history and the audit log of users,
+// FindByUID returns the events of the user oldest first
+type SecurityEventRepository interface {
+	Create(ctx context.Context, e *SecurityEvent) error
+	FindByUID(ctx context.Context, uid uuid.UUID) ([]*SecurityEvent, error)
+}
+
+// RoleRepository assigns roles to users, FindByUser returns the roles
+// of the user with their permissions
+type RoleRepository interface {
+	FindByUser(ctx context.Context, uid uuid.UUID) ([]*Role, error)
+	Assign(ctx context.Context, uid uuid.UUID, role string) error
+	Unassign(ctx context.Context, uid uuid.UUID, role string) error
+}
+
+type OAuthClientRepository interface {
+	FindByID(ctx context.Context, id string) (*OAuthClient, error)
+}
+
+type ServiceAccountRepository interface {
+	FindByID(ctx context.Context, id string) (*ServiceAccount, error)
+}
+
+// BreachedPasswordRepository finds breached passwords by k-anonymity, FindRange returns
+// the sha1 hash suffixes of breached passwords sharing the 5 hex character prefix,
+// with how often each was seen
+type BreachedPasswordRepository interface {
+	FindRange(ctx context.Context, prefix string) (map[string]int64, error)
+}
+
+// MailSender delivers transactional emails (verification, password reset, ...)
+type MailSender interface {
+	Send(ctx context.Context, to, subject, body string) error
 }
@@ -0,0 +1,21 @@
+package model
+
+// JSONWebKey is a public key in JWK format, https://www.rfc-editor.org/rfc/rfc7517
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is the public keys id tokens can be verified with
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
@@ -0,0 +1,12 @@
+package model
+
+import "github.com/google/uuid"
+
+// TOTP is a time based one time password authenticator of the user.
+// Secret is stored encrypted
+type TOTP struct {
+	UID          uuid.UUID `db:"uid"`
+	Secret       string    `db:"secret"`
+	Confirmed    bool      `db:"confirmed"`
+	LastUsedStep int64     `db:"last_used_step"`
+}
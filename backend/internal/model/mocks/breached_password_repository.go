@@ -0,0 +1,29 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type MockBreachedPasswordRepository struct {
+	mock.Mock
+}
+
+func (m *MockBreachedPasswordRepository) FindRange(ctx context.Context, prefix string) (map[string]int64, error) {
+	ret := m.Called(ctx, prefix)
+
+	var r0 map[string]int64
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(map[string]int64)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
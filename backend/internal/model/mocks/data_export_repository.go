@@ -0,0 +1,86 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockDataExportRepository struct {
+	mock.Mock
+}
+
+func (m *MockDataExportRepository) CreateExport(ctx context.Context, uid uuid.UUID, e *model.DataExport, expiresIn time.Duration) (bool, error) {
+	ret := m.Called(ctx, uid, e, expiresIn)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.Bool(0), r1
+}
+
+func (m *MockDataExportRepository) GetExport(ctx context.Context, uid uuid.UUID) (*model.DataExport, error) {
+	ret := m.Called(ctx, uid)
+
+	var r0 *model.DataExport
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.DataExport)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockDataExportRepository) SetExport(ctx context.Context, uid uuid.UUID, e *model.DataExport, expiresIn time.Duration) error {
+	ret := m.Called(ctx, uid, e, expiresIn)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockDataExportRepository) SetArchive(ctx context.Context, uid uuid.UUID, e *model.DataExport, archive []byte, expiresIn time.Duration) error {
+	ret := m.Called(ctx, uid, e, archive, expiresIn)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockDataExportRepository) GetArchive(ctx context.Context, uid uuid.UUID, id string) ([]byte, error) {
+	ret := m.Called(ctx, uid, id)
+
+	var r0 []byte
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]byte)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
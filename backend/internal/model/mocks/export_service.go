@@ -0,0 +1,49 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockExportService struct {
+	mock.Mock
+}
+
+func (m *MockExportService) RequestExport(ctx context.Context, uid uuid.UUID) (*model.DataExport, error) {
+	ret := m.Called(ctx, uid)
+
+	var r0 *model.DataExport
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.DataExport)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockExportService) Archive(ctx context.Context, uid uuid.UUID, id string) ([]byte, error) {
+	ret := m.Called(ctx, uid, id)
+
+	var r0 []byte
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]byte)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,78 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type MockLoginAttemptRepository struct {
+	mock.Mock
+}
+
+func (m *MockLoginAttemptRepository) AddFailure(ctx context.Context, key string, at time.Time, window time.Duration) (int64, error) {
+	ret := m.Called(ctx, key, at, window)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.Get(0).(int64), r1
+}
+
+func (m *MockLoginAttemptRepository) Failures(ctx context.Context, key string, now time.Time, window time.Duration) (int64, time.Time, error) {
+	ret := m.Called(ctx, key, now, window)
+
+	var r1 time.Time
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(time.Time)
+	}
+
+	var r2 error
+
+	if ret.Get(2) != nil {
+		r2 = ret.Get(2).(error)
+	}
+
+	return ret.Get(0).(int64), r1, r2
+}
+
+func (m *MockLoginAttemptRepository) ResetFailures(ctx context.Context, key string) error {
+	ret := m.Called(ctx, key)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockLoginAttemptRepository) Lock(ctx context.Context, key string, d time.Duration) error {
+	ret := m.Called(ctx, key, d)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockLoginAttemptRepository) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ret := m.Called(ctx, key)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.Get(0).(time.Duration), r1
+}
@@ -0,0 +1,79 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockMFARepository struct {
+	mock.Mock
+}
+
+func (m *MockMFARepository) FindTOTP(ctx context.Context, uid uuid.UUID) (*model.TOTP, error) {
+	ret := m.Called(ctx, uid)
+
+	var r0 *model.TOTP
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.TOTP)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockMFARepository) SaveTOTP(ctx context.Context, t *model.TOTP) error {
+	ret := m.Called(ctx, t)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockMFARepository) ConfirmTOTP(ctx context.Context, uid uuid.UUID, recoveryCodeHashes []string) error {
+	ret := m.Called(ctx, uid, recoveryCodeHashes)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockMFARepository) UpdateTOTPLastUsedStep(ctx context.Context, uid uuid.UUID, step int64) error {
+	ret := m.Called(ctx, uid, step)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockMFARepository) UseRecoveryCode(ctx context.Context, uid uuid.UUID, codeHash string) error {
+	ret := m.Called(ctx, uid, codeHash)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
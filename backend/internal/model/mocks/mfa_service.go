@@ -0,0 +1,79 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockMFAService struct {
+	mock.Mock
+}
+
+func (m *MockMFAService) SetupTOTP(ctx context.Context, u *model.User) (string, error) {
+	ret := m.Called(ctx, u)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.String(0), r1
+}
+
+func (m *MockMFAService) ConfirmTOTP(ctx context.Context, uid uuid.UUID, code string) ([]string, error) {
+	ret := m.Called(ctx, uid, code)
+
+	var r0 []string
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]string)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockMFAService) Enabled(ctx context.Context, uid uuid.UUID) (bool, error) {
+	ret := m.Called(ctx, uid)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.Bool(0), r1
+}
+
+func (m *MockMFAService) NewChallenge(ctx context.Context, uid uuid.UUID) (string, error) {
+	ret := m.Called(ctx, uid)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.String(0), r1
+}
+
+func (m *MockMFAService) VerifyChallenge(ctx context.Context, challenge, code, ip string) (uuid.UUID, error) {
+	ret := m.Called(ctx, challenge, code, ip)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.Get(0).(uuid.UUID), r1
+}
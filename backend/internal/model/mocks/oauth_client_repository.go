@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockOAuthClientRepository struct {
+	mock.Mock
+}
+
+func (m *MockOAuthClientRepository) FindByID(ctx context.Context, id string) (*model.OAuthClient, error) {
+	ret := m.Called(ctx, id)
+
+	var r0 *model.OAuthClient
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.OAuthClient)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
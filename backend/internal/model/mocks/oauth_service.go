@@ -0,0 +1,114 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockOAuthService struct {
+	mock.Mock
+}
+
+func (m *MockOAuthService) ValidateClient(ctx context.Context, clientID, redirectURI string) (*model.OAuthClient, string, error) {
+	ret := m.Called(ctx, clientID, redirectURI)
+
+	var r0 *model.OAuthClient
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.OAuthClient)
+	}
+
+	var r2 error
+
+	if ret.Get(2) != nil {
+		r2 = ret.Get(2).(error)
+	}
+
+	return r0, ret.String(1), r2
+}
+
+func (m *MockOAuthService) Consent(ctx context.Context, r *model.AuthorizationRequest) (*model.Consent, error) {
+	ret := m.Called(ctx, r)
+
+	var r0 *model.Consent
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.Consent)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockOAuthService) Authorize(ctx context.Context, uid uuid.UUID, r *model.AuthorizationRequest) (string, error) {
+	ret := m.Called(ctx, uid, r)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.String(0), r1
+}
+
+func (m *MockOAuthService) ExchangeCode(ctx context.Context, clientID, code, redirectURI, codeVerifier string) (*model.AuthorizationCode, error) {
+	ret := m.Called(ctx, clientID, code, redirectURI, codeVerifier)
+
+	var r0 *model.AuthorizationCode
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.AuthorizationCode)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockOAuthService) Client(ctx context.Context, clientID string) (*model.OAuthClient, error) {
+	ret := m.Called(ctx, clientID)
+
+	var r0 *model.OAuthClient
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.OAuthClient)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockOAuthService) AuthenticateServiceAccount(ctx context.Context, clientID, secret, scope string) (*model.ServiceAccount, string, error) {
+	ret := m.Called(ctx, clientID, secret, scope)
+
+	var r0 *model.ServiceAccount
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.ServiceAccount)
+	}
+
+	var r2 error
+
+	if ret.Get(2) != nil {
+		r2 = ret.Get(2).(error)
+	}
+
+	return r0, ret.String(1), r2
+}
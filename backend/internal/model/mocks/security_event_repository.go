@@ -0,0 +1,43 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockSecurityEventRepository struct {
+	mock.Mock
+}
+
+func (m *MockSecurityEventRepository) Create(ctx context.Context, e *model.SecurityEvent) error {
+	ret := m.Called(ctx, e)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockSecurityEventRepository) FindByUID(ctx context.Context, uid uuid.UUID) ([]*model.SecurityEvent, error) {
+	ret := m.Called(ctx, uid)
+
+	var r0 []*model.SecurityEvent
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*model.SecurityEvent)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
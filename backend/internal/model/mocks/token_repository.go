@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/Kara4ev/go-web-tmp/internal/model"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -11,8 +12,8 @@ type MockTokenRepository struct {
 	mock.Mock
 }
 
-func (m *MockTokenRepository) SetRefreshToken(ctx context.Context, userID, tokenID string, expiresIn time.Duration) error {
-	ret := m.Called(ctx, userID, tokenID, expiresIn)
+func (m *MockTokenRepository) SetRefreshToken(ctx context.Context, userID, tokenID string, s *model.Session, expiresIn time.Duration) error {
+	ret := m.Called(ctx, userID, tokenID, s, expiresIn)
 
 	var r0 error
 
@@ -24,8 +25,26 @@ func (m *MockTokenRepository) SetRefreshToken(ctx context.Context, userID, token
 
 }
 
-func (m *MockTokenRepository) DeleteRefreshToken(ctx context.Context, userID, prevTokenID string) error {
-	ret := m.Called(ctx, userID, prevTokenID)
+func (m *MockTokenRepository) GetRefreshToken(ctx context.Context, userID, tokenID string) (*model.Session, error) {
+	ret := m.Called(ctx, userID, tokenID)
+
+	var r0 *model.Session
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.Session)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockTokenRepository) SetOpaqueRefreshToken(ctx context.Context, tokenHash string, t *model.OpaqueRefreshToken, expiresIn time.Duration) error {
+	ret := m.Called(ctx, tokenHash, t, expiresIn)
 
 	var r0 error
 
@@ -34,7 +53,79 @@ func (m *MockTokenRepository) DeleteRefreshToken(ctx context.Context, userID, pr
 	}
 
 	return r0
+}
+
+func (m *MockTokenRepository) GetOpaqueRefreshToken(ctx context.Context, tokenHash string) (*model.OpaqueRefreshToken, error) {
+	ret := m.Called(ctx, tokenHash)
+
+	var r0 *model.OpaqueRefreshToken
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.OpaqueRefreshToken)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
 
+	return r0, r1
+}
+
+func (m *MockTokenRepository) DeleteRefreshToken(ctx context.Context, userID, prevTokenID string) (*model.Session, error) {
+	ret := m.Called(ctx, userID, prevTokenID)
+
+	var r0 *model.Session
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.Session)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+
+}
+
+func (m *MockTokenRepository) RotateRefreshToken(ctx context.Context, userID, prevTokenID string, expiresIn time.Duration) (*model.Session, bool, error) {
+	ret := m.Called(ctx, userID, prevTokenID, expiresIn)
+
+	var r0 *model.Session
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.Session)
+	}
+
+	var r2 error
+
+	if ret.Get(2) != nil {
+		r2 = ret.Get(2).(error)
+	}
+
+	return r0, ret.Bool(1), r2
+}
+
+func (m *MockTokenRepository) ListSessions(ctx context.Context, userID string) ([]*model.Session, error) {
+	ret := m.Called(ctx, userID)
+
+	var r0 []*model.Session
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*model.Session)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
 }
 
 func (m *MockTokenRepository) DeleteUserRefreshToken(ctx context.Context, userID string) error {
@@ -50,3 +141,105 @@ func (m *MockTokenRepository) DeleteUserRefreshToken(ctx context.Context, userID
 	return r0
 
 }
+
+func (m *MockTokenRepository) SetOneTimeToken(ctx context.Context, purpose, tokenHash, userID string, expiresIn time.Duration) error {
+	ret := m.Called(ctx, purpose, tokenHash, userID, expiresIn)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockTokenRepository) ConsumeOneTimeToken(ctx context.Context, purpose, tokenHash string) (string, error) {
+	ret := m.Called(ctx, purpose, tokenHash)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.String(0), r1
+}
+
+func (m *MockTokenRepository) GetOneTimeToken(ctx context.Context, purpose, tokenHash string) (string, error) {
+	ret := m.Called(ctx, purpose, tokenHash)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.String(0), r1
+}
+
+func (m *MockTokenRepository) IncrOneTimeTokenAttempts(ctx context.Context, purpose, tokenHash string, expiresIn time.Duration) (int64, error) {
+	ret := m.Called(ctx, purpose, tokenHash, expiresIn)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.Get(0).(int64), r1
+}
+
+func (m *MockTokenRepository) SetAuthorizationCode(ctx context.Context, codeHash string, code *model.AuthorizationCode, expiresIn time.Duration) error {
+	ret := m.Called(ctx, codeHash, code, expiresIn)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockTokenRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*model.AuthorizationCode, error) {
+	ret := m.Called(ctx, codeHash)
+
+	var r0 *model.AuthorizationCode
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.AuthorizationCode)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockTokenRepository) DenyTokens(ctx context.Context, ids []string, expiresIn time.Duration) error {
+	ret := m.Called(ctx, ids, expiresIn)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockTokenRepository) IsTokenDenied(ctx context.Context, id string) (bool, error) {
+	ret := m.Called(ctx, id)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.Bool(0), r1
+}
@@ -12,9 +12,9 @@ type MockTokenService struct {
 	mock.Mock
 }
 
-func (m *MockTokenService) NewPairFromUser(ctx context.Context, u *model.User, prevTokenID string) (*model.TokenPair, error) {
+func (m *MockTokenService) NewPairFromUser(ctx context.Context, u *model.User, prevTokenID string, client *model.SessionClient) (*model.TokenPair, error) {
 
-	ret := m.Called(ctx, u, prevTokenID)
+	ret := m.Called(ctx, u, prevTokenID, client)
 
 	var r0 *model.TokenPair
 
@@ -45,13 +45,13 @@ func (m *MockTokenService) Signout(ctx context.Context, uid uuid.UUID) error {
 
 }
 
-func (m *MockTokenService) ValidateIDToken(tokenString string) (*model.User, error) {
+func (m *MockTokenService) ValidateIDToken(tokenString string) (*model.IDTokenClaims, error) {
 	ret := m.Called(tokenString)
 
-	var r0 *model.User
+	var r0 *model.IDTokenClaims
 
 	if ret.Get(0) != nil {
-		r0 = ret.Get(0).(*model.User)
+		r0 = ret.Get(0).(*model.IDTokenClaims)
 	}
 
 	var r1 error
@@ -80,3 +80,135 @@ func (m *MockTokenService) ValidateRefreshToken(tokenString string) (*model.Refr
 
 	return r0, r1
 }
+
+func (m *MockTokenService) ListSessions(ctx context.Context, uid uuid.UUID, currentSessionID string) ([]*model.Session, error) {
+	ret := m.Called(ctx, uid, currentSessionID)
+
+	var r0 []*model.Session
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*model.Session)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockTokenService) RevokeSession(ctx context.Context, uid uuid.UUID, sessionID string) error {
+	ret := m.Called(ctx, uid, sessionID)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockTokenService) RevokeOtherSessions(ctx context.Context, uid uuid.UUID, currentSessionID string) error {
+	ret := m.Called(ctx, uid, currentSessionID)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockTokenService) JWKS() *model.JSONWebKeySet {
+	ret := m.Called()
+
+	var r0 *model.JSONWebKeySet
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.JSONWebKeySet)
+	}
+
+	return r0
+}
+
+func (m *MockTokenService) NewAccessToken(ctx context.Context, sa *model.ServiceAccount, scope string) (*model.AccessToken, error) {
+	ret := m.Called(ctx, sa, scope)
+
+	var r0 *model.AccessToken
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.AccessToken)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockTokenService) ValidateAccessToken(tokenString string) (*model.ServicePrincipal, error) {
+	ret := m.Called(tokenString)
+
+	var r0 *model.ServicePrincipal
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.ServicePrincipal)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockTokenService) Introspect(ctx context.Context, tokenString string) (*model.TokenIntrospection, error) {
+	ret := m.Called(ctx, tokenString)
+
+	var r0 *model.TokenIntrospection
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.TokenIntrospection)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockTokenService) RevokeRefreshToken(ctx context.Context, tokenString, clientID string) error {
+	ret := m.Called(ctx, tokenString, clientID)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockTokenService) RevokeIDToken(ctx context.Context, tokenString string) error {
+	ret := m.Called(ctx, tokenString)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
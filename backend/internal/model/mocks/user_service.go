@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	"github.com/Kara4ev/go-web-tmp/internal/model"
 	"github.com/google/uuid"
@@ -43,8 +44,8 @@ func (m *MockUserService) Signup(ctx context.Context, u *model.User) error {
 	return r0
 }
 
-func (m *MockUserService) Signin(ctx context.Context, u *model.User) error {
-	ret := m.Called(ctx, u)
+func (m *MockUserService) Signin(ctx context.Context, u *model.User, ip string) error {
+	ret := m.Called(ctx, u, ip)
 
 	var r0 error
 
@@ -67,3 +68,177 @@ func (m *MockUserService) UpdateDetails(ctx context.Context, u *model.User) erro
 
 	return r0
 }
+
+func (m *MockUserService) VerifyEmail(ctx context.Context, token string) error {
+	ret := m.Called(ctx, token)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) ResendVerification(ctx context.Context, email string) error {
+	ret := m.Called(ctx, email)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) ForgotPassword(ctx context.Context, email string) error {
+	ret := m.Called(ctx, email)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) ResetPassword(ctx context.Context, token, password string) error {
+	ret := m.Called(ctx, token, password)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) ChangePassword(ctx context.Context, uid uuid.UUID, sid, currentPassword, newPassword string) error {
+	ret := m.Called(ctx, uid, sid, currentPassword, newPassword)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) ListUsers(ctx context.Context, f *model.UserFilter) ([]*model.User, int64, error) {
+	ret := m.Called(ctx, f)
+
+	var r0 []*model.User
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*model.User)
+	}
+
+	var r2 error
+
+	if ret.Get(2) != nil {
+		r2 = ret.Get(2).(error)
+	}
+
+	return r0, ret.Get(1).(int64), r2
+}
+
+func (m *MockUserService) UpdateUser(ctx context.Context, uid uuid.UUID, upd *model.UserUpdate) (*model.User, error) {
+	ret := m.Called(ctx, uid, upd)
+
+	var r0 *model.User
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.User)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockUserService) ForcePasswordReset(ctx context.Context, uid uuid.UUID) error {
+	ret := m.Called(ctx, uid)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) Suspend(ctx context.Context, uid uuid.UUID) error {
+	ret := m.Called(ctx, uid)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) Unsuspend(ctx context.Context, uid uuid.UUID) error {
+	ret := m.Called(ctx, uid)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) Delete(ctx context.Context, uid uuid.UUID) error {
+	ret := m.Called(ctx, uid)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockUserService) DeleteAccount(ctx context.Context, uid uuid.UUID, password string) (time.Time, error) {
+	ret := m.Called(ctx, uid, password)
+
+	var r0 time.Time
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(time.Time)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockUserService) PurgeDeletedAccounts(ctx context.Context) (int64, error) {
+	ret := m.Called(ctx)
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return ret.Get(0).(int64), r1
+}
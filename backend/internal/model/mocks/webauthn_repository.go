@@ -0,0 +1,73 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockWebAuthnRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebAuthnRepository) Create(ctx context.Context, c *model.WebAuthnCredential) error {
+	ret := m.Called(ctx, c)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
+
+func (m *MockWebAuthnRepository) FindByID(ctx context.Context, id string) (*model.WebAuthnCredential, error) {
+	ret := m.Called(ctx, id)
+
+	var r0 *model.WebAuthnCredential
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*model.WebAuthnCredential)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockWebAuthnRepository) FindByUID(ctx context.Context, uid uuid.UUID) ([]*model.WebAuthnCredential, error) {
+	ret := m.Called(ctx, uid)
+
+	var r0 []*model.WebAuthnCredential
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]*model.WebAuthnCredential)
+	}
+
+	var r1 error
+
+	if ret.Get(1) != nil {
+		r1 = ret.Get(1).(error)
+	}
+
+	return r0, r1
+}
+
+func (m *MockWebAuthnRepository) UpdateSignCount(ctx context.Context, id string, signCount int64) error {
+	ret := m.Called(ctx, id, signCount)
+
+	var r0 error
+
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(error)
+	}
+
+	return r0
+}
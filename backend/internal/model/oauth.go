@@ -0,0 +1,37 @@
+package model
+
+import "github.com/google/uuid"
+
+// OAuthClient is an application registered to request tokens of users
+type OAuthClient struct {
+	ID           string   `json:"client_id"`
+	Name         string   `json:"client_name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+}
+
+// AuthorizationRequest are the parameters of the authorization endpoint
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// Consent is what the user is asked to grant the client on the consent page
+type Consent struct {
+	Client *OAuthClient `json:"client"`
+	Scope  string       `json:"scope"`
+}
+
+// AuthorizationCode is what an authorization code was issued for
+type AuthorizationCode struct {
+	ClientID      string    `json:"client_id"`
+	UID           uuid.UUID `json:"uid"`
+	RedirectURI   string    `json:"redirect_uri"`
+	Scope         string    `json:"scope"`
+	CodeChallenge string    `json:"code_challenge"`
+}
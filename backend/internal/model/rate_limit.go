@@ -0,0 +1,47 @@
+package model
+
+import (
+	"math"
+	"time"
+)
+
+// RateLimit is a token bucket of Burst tokens refilled at Rate tokens per second,
+// every request takes a token. A zero Burst disables the limit
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitResult is the state of a bucket after taking a token
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is the time until a token is available, when not allowed
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+}
+
+// Result is the result of a bucket left with tokens
+func (l RateLimit) Result(allowed bool, tokens float64) *RateLimitResult {
+	r := &RateLimitResult{
+		Allowed:   allowed,
+		Limit:     l.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     l.refill(float64(l.Burst) - tokens),
+	}
+
+	if !allowed {
+		r.RetryAfter = l.refill(1 - tokens)
+	}
+	return r
+}
+
+// refill is the time to refill n tokens
+func (l RateLimit) refill(n float64) time.Duration {
+	if n <= 0 || l.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(n / l.Rate * float64(time.Second)))
+}
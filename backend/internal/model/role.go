@@ -0,0 +1,26 @@
+package model
+
+// roles and permissions created by the migrations
+const (
+	RoleAdmin = "admin"
+
+	PermissionUsersRead  = "users:read"
+	PermissionUsersWrite = "users:write"
+)
+
+// Role grants its permissions to the users it is assigned to
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// HasPermission reports whether one of the roles of the user grants the permission
+func (u *User) HasPermission(permission string) bool {
+	for _, p := range u.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// security event types. The signin events are the login history of the user,
+// the others the audit events of changes to the account
+const (
+	EventSignin                = "signin"
+	EventSigninFailed          = "signin_failed"
+	EventAccountLocked         = "account_locked"
+	EventPasswordChanged       = "password_changed"
+	EventPasswordReset         = "password_reset"
+	EventEmailVerified         = "email_verified"
+	EventTOTPEnabled           = "totp_enabled"
+	EventPasskeyRegistered     = "passkey_registered"
+	EventAccountDeleted        = "account_deleted"
+	EventAccountUpdatedByAdmin = "account_updated_by_admin"
+	EventPasswordResetByAdmin  = "password_reset_by_admin"
+	EventAccountSuspended      = "account_suspended"
+	EventAccountUnsuspended    = "account_unsuspended"
+)
+
+// SecurityEvent is an entry of the login history or the audit log of a user
+type SecurityEvent struct {
+	UID       uuid.UUID `json:"-" db:"uid"`
+	Type      string    `json:"type" db:"type"`
+	IP        string    `json:"ip,omitempty" db:"ip"`
+	UserAgent string    `json:"userAgent,omitempty" db:"user_agent"`
+	ClientID  string    `json:"clientId,omitempty" db:"client_id"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// Signin reports whether the event belongs to the login history
+func (e *SecurityEvent) Signin() bool {
+	return e.Type == EventSignin || e.Type == EventSigninFailed
+}
@@ -0,0 +1,33 @@
+package model
+
+// ServiceAccount is a non human principal authenticated by
+// client id and secret with the client credentials grant
+type ServiceAccount struct {
+	ID     string   `json:"client_id"`
+	Name   string   `json:"name"`
+	Secret string   `json:"-"`
+	Scopes []string `json:"scopes"`
+}
+
+// AccessToken is issued to service accounts, there is no refresh token
+type AccessToken struct {
+	SS        string `json:"access_token"`
+	Scope     string `json:"scope"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// ServicePrincipal are the verified claims of a service account access token
+type ServicePrincipal struct {
+	ClientID string
+	Scopes   []string
+}
+
+// HasScope reports whether the access token was granted the scope
+func (p *ServicePrincipal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
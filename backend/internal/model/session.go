@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a signed in device. It keeps its ID while
+// the refresh token is rotated
+type Session struct {
+	ID              string    `json:"id"`
+	UID             uuid.UUID `json:"-"`
+	TokenID         string    `json:"-"`
+	UserAgent       string    `json:"userAgent"`
+	IP              string    `json:"ip"`
+	ClientID        string    `json:"clientId,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+	LastRefreshedAt time.Time `json:"lastRefreshedAt"`
+	Current         bool      `json:"current"`
+}
+
+// SessionClient describes the client a token pair is issued to
+type SessionClient struct {
+	UserAgent string
+	IP        string
+	// ClientID is the OAuth client, empty for first party signin
+	ClientID string
+}
+
+// IDTokenClaims are the verified claims of an id token
+type IDTokenClaims struct {
+	User      *User
+	SessionID string
+	// ClientID is the oauth client the token was issued to, empty for first party tokens
+	ClientID string
+}
@@ -1,6 +1,10 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type RefreshToken struct {
 	ID  uuid.UUID `json:"-"`
@@ -16,3 +20,22 @@ type TokenPair struct {
 	IDToken
 	RefreshToken
 }
+
+// TokenIntrospection is the state of a token, https://www.rfc-editor.org/rfc/rfc7662#section-2.2
+type TokenIntrospection struct {
+	Active   bool   `json:"active"`
+	Sub      string `json:"sub,omitempty"`
+	Exp      int64  `json:"exp,omitempty"`
+	Iat      int64  `json:"iat,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// OpaqueRefreshToken is what an opaque refresh token was issued for,
+// it is stored under the sha256 hash of the token
+type OpaqueRefreshToken struct {
+	UID       uuid.UUID `json:"uid"`
+	SessionID string    `json:"sid"`
+	IssuedAt  time.Time `json:"iat"`
+	ExpiresAt time.Time `json:"exp"`
+}
@@ -1,11 +1,63 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// statuses of the account lifecycle, only active accounts
+// can sign in and use their tokens
+const (
+	UserStatusActive = "active"
+	// UserStatusPendingVerification accounts signed up but did not verify
+	// their email address yet, when verification is required
+	UserStatusPendingVerification = "pending_verification"
+	// UserStatusSuspended accounts are blocked by the admins
+	UserStatusSuspended = "suspended"
+	// UserStatusDeleted accounts are deleted by the user and purged
+	// after a grace period, signin reactivates them until then
+	UserStatusDeleted = "deleted"
+)
 
 type User struct {
-	UID      uuid.UUID `db:"uid" json:"uid"`
-	Email    string    `db:"email" json:"email"`
-	Password string    `db:"password" json:"-"`
-	Name     string    `db:"name" json:"name"`
-	ImageURL string    `db:"image_url" json:"imageURL"`
+	UID           uuid.UUID `db:"uid" json:"uid"`
+	Email         string    `db:"email" json:"email"`
+	Password      string    `db:"password" json:"-"`
+	Name          string    `db:"name" json:"name"`
+	ImageURL      string    `db:"image_url" json:"imageURL"`
+	EmailVerified bool      `db:"email_verified" json:"emailVerified"`
+	Status        string    `db:"status" json:"status"`
+	CreatedAt     time.Time `db:"created_at" json:"createdAt"`
+	// DeletedAt is when the user deleted the account, it is purged after the grace period
+	DeletedAt *time.Time `db:"deleted_at" json:"deletedAt,omitempty"`
+	// Roles and the Permissions they grant are not columns of users,
+	// they are loaded when tokens are issued and restored from the id token
+	Roles       []string `db:"-" json:"roles,omitempty"`
+	Permissions []string `db:"-" json:"permissions,omitempty"`
+}
+
+// UserFilter selects the users of the admin list, zero values do not filter
+type UserFilter struct {
+	// Query matches a part of the email or name, ignoring case
+	Query         string
+	Status        string
+	EmailVerified *bool
+	Role          string
+	Limit         int
+	Offset        int
+}
+
+// UserUpdate changes the fields of a user set by an admin, nil fields are kept
+type UserUpdate struct {
+	Name          *string
+	Email         *string
+	ImageURL      *string
+	EmailVerified *bool
+}
+
+// Active reports whether the account can sign in and use its tokens,
+// users without a status are from before the status lifecycle
+func (u *User) Active() bool {
+	return u.Status == "" || u.Status == UserStatusActive
 }
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+)
+
+type fileBreachedPasswordRepository struct {
+	Dir string
+}
+
+// NewBreachedPasswordRepository reads the ranges of a directory with a file per
+// hash prefix, named by the prefix, of SUFFIX:COUNT lines. It is the format of
+// the Pwned Passwords range api, https://haveibeenpwned.com/API/v3#PwnedPasswords
+func NewBreachedPasswordRepository(dir string) model.BreachedPasswordRepository {
+	return &fileBreachedPasswordRepository{
+		Dir: dir,
+	}
+}
+
+// FindRange returns the suffixes of the prefix file, a missing file is an empty range
+func (r *fileBreachedPasswordRepository) FindRange(ctx context.Context, prefix string) (map[string]int64, error) {
+	prefix = strings.ToUpper(prefix)
+	if len(prefix) != 5 || strings.Trim(prefix, "0123456789ABCDEF") != "" {
+		return nil, errors.New("hash prefix must be 5 hex characters")
+	}
+
+	f, err := os.Open(filepath.Join(r.Dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]int64{}, nil
+	}
+	if err != nil {
+		logger.Warn("could not open breached password range: %s: %v", prefix, err)
+		return nil, err
+	}
+	defer f.Close()
+
+	suffixes := map[string]int64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		// padding entries of the api have a count of 0
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || n <= 0 {
+			continue
+		}
+		suffixes[strings.ToUpper(parts[0])] = n
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.Warn("could not read breached password range: %s: %v", prefix, err)
+		return nil, err
+	}
+
+	return suffixes, nil
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+)
+
+// memoryRateLimitMinSweep is the number of buckets before full buckets are swept
+const memoryRateLimitMinSweep = 1024
+
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	sweepAt int
+}
+
+type memoryBucket struct {
+	tokens float64
+	ts     time.Time
+	rate   float64
+	burst  float64
+}
+
+// NewMemoryRateLimitStore keeps the buckets in process, for a single instance and tests
+func NewMemoryRateLimitStore() model.RateLimitStore {
+	return &memoryRateLimitStore{
+		buckets: map[string]*memoryBucket{},
+		sweepAt: memoryRateLimitMinSweep,
+	}
+}
+
+func (s *memoryRateLimitStore) Take(ctx context.Context, key string, l model.RateLimit, now time.Time) (*model.RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		s.sweep(now)
+		b = &memoryBucket{tokens: float64(l.Burst), ts: now}
+		s.buckets[key] = b
+	}
+
+	b.rate = l.Rate
+	b.burst = float64(l.Burst)
+	b.refill(now)
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	return l.Result(allowed, b.tokens), nil
+}
+
+func (b *memoryBucket) refill(now time.Time) {
+	if now.After(b.ts) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.ts).Seconds()*b.rate)
+		b.ts = now
+	}
+}
+
+// sweep drops buckets which are full again, they are the same as a new bucket
+func (s *memoryRateLimitStore) sweep(now time.Time) {
+	if len(s.buckets) < s.sweepAt {
+		return
+	}
+
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= b.burst {
+			delete(s.buckets, key)
+		}
+	}
+
+	s.sweepAt = 2 * len(s.buckets)
+	if s.sweepAt < memoryRateLimitMinSweep {
+		s.sweepAt = memoryRateLimitMinSweep
+	}
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type pgMFARepository struct {
+	DB *sqlx.DB
+}
+
+func NewMFARepository(db *sqlx.DB) model.MFARepository {
+	return &pgMFARepository{
+		DB: db,
+	}
+}
+
+func (r *pgMFARepository) FindTOTP(ctx context.Context, uid uuid.UUID) (*model.TOTP, error) {
+	t := new(model.TOTP)
+	query := "SELECT uid, secret, confirmed, last_used_step FROM user_totp WHERE uid = $1"
+
+	if err := r.DB.GetContext(ctx, t, query, uid); err != nil {
+		logger.Debug("unable to get totp for uid: %v, err: %v", uid.String(), err)
+		return nil, apperrors.NewNotFound("totp", uid.String())
+	}
+
+	return t, nil
+}
+
+// SaveTOTP creates an unconfirmed totp or replaces the secret of an unconfirmed one
+func (r *pgMFARepository) SaveTOTP(ctx context.Context, t *model.TOTP) error {
+	query := `
+		INSERT INTO user_totp (uid, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (uid) DO UPDATE
+		SET
+			secret = EXCLUDED.secret,
+			last_used_step = 0,
+			created_at = NOW()
+		WHERE
+			user_totp.confirmed = FALSE`
+
+	result, err := r.DB.ExecContext(ctx, query, t.UID, t.Secret)
+	if err != nil {
+		logger.Warn("unable to save totp for uid: %v, err: %v", t.UID.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	if n, _ := result.RowsAffected(); n < 1 {
+		logger.Warn("totp for uid: %v already confirmed", t.UID.String())
+		return apperrors.NewConflict("totp", t.UID.String())
+	}
+
+	return nil
+}
+
+// ConfirmTOTP enables the totp and replaces the recovery codes of the user
+func (r *pgMFARepository) ConfirmTOTP(ctx context.Context, uid uuid.UUID, recoveryCodeHashes []string) error {
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		logger.Warn("unable to begin confirm totp tx for uid: %v, err: %v", uid.String(), err)
+		return apperrors.NewInternal()
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE user_totp SET confirmed = TRUE WHERE uid = $1", uid); err != nil {
+		logger.Warn("unable to confirm totp for uid: %v, err: %v", uid.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE uid = $1", uid); err != nil {
+		logger.Warn("unable to delete recovery codes for uid: %v, err: %v", uid.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	for _, h := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO user_recovery_codes (uid, code_hash) VALUES ($1, $2)", uid, h); err != nil {
+			logger.Warn("unable to insert recovery code for uid: %v, err: %v", uid.String(), err)
+			return apperrors.NewInternal()
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Warn("unable to commit confirm totp tx for uid: %v, err: %v", uid.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	return nil
+}
+
+// UpdateTOTPLastUsedStep stores the time step of an accepted code,
+// so the same code can not be replayed
+func (r *pgMFARepository) UpdateTOTPLastUsedStep(ctx context.Context, uid uuid.UUID, step int64) error {
+	query := "UPDATE user_totp SET last_used_step = $2 WHERE uid = $1 AND last_used_step < $2"
+
+	result, err := r.DB.ExecContext(ctx, query, uid, step)
+	if err != nil {
+		logger.Warn("unable to update totp last used step for uid: %v, err: %v", uid.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	if n, _ := result.RowsAffected(); n < 1 {
+		logger.Warn("totp code step: %d for uid: %v already used", step, uid.String())
+		return apperrors.NewAuthorization("totp code already used")
+	}
+
+	return nil
+}
+
+func (r *pgMFARepository) UseRecoveryCode(ctx context.Context, uid uuid.UUID, codeHash string) error {
+	query := "UPDATE user_recovery_codes SET used_at = NOW() WHERE uid = $1 AND code_hash = $2 AND used_at IS NULL"
+
+	result, err := r.DB.ExecContext(ctx, query, uid, codeHash)
+	if err != nil {
+		logger.Warn("unable to use recovery code for uid: %v, err: %v", uid.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	if n, _ := result.RowsAffected(); n < 1 {
+		logger.Warn("recovery code for uid: %v not found or already used", uid.String())
+		return apperrors.NewNotFound("recovery code", uid.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type pgOAuthClientRepository struct {
+	DB *sqlx.DB
+}
+
+func NewOAuthClientRepository(db *sqlx.DB) model.OAuthClientRepository {
+	return &pgOAuthClientRepository{
+		DB: db,
+	}
+}
+
+type pgOAuthClient struct {
+	ID           string         `db:"id"`
+	Name         string         `db:"name"`
+	RedirectURIs pq.StringArray `db:"redirect_uris"`
+	Scopes       pq.StringArray `db:"scopes"`
+}
+
+func (r *pgOAuthClientRepository) FindByID(ctx context.Context, id string) (*model.OAuthClient, error) {
+	c := new(pgOAuthClient)
+	query := "SELECT id, name, redirect_uris, scopes FROM oauth_clients WHERE id = $1"
+
+	if err := r.DB.GetContext(ctx, c, query, id); err != nil {
+		logger.Warn("unable to get oauth client: %v, err: %v", id, err)
+		return nil, apperrors.NewNotFound("client", id)
+	}
+
+	return &model.OAuthClient{
+		ID:           c.ID,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectURIs,
+		Scopes:       c.Scopes,
+	}, nil
+}
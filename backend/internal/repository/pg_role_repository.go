@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type pgRoleRepository struct {
+	DB *sqlx.DB
+}
+
+func NewRoleRepository(db *sqlx.DB) model.RoleRepository {
+	return &pgRoleRepository{
+		DB: db,
+	}
+}
+
+type pgRole struct {
+	Name        string         `db:"name"`
+	Description string         `db:"description"`
+	Permissions pq.StringArray `db:"permissions"`
+}
+
+func (r *pgRoleRepository) FindByUser(ctx context.Context, uid uuid.UUID) ([]*model.Role, error) {
+	query := `
+		SELECT
+			r.name,
+			r.description,
+			COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}') AS permissions
+		FROM
+			user_roles ur
+			JOIN roles r ON r.name = ur.role
+			LEFT JOIN role_permissions rp ON rp.role = r.name
+		WHERE
+			ur.uid = $1
+		GROUP BY
+			r.name, r.description
+		ORDER BY
+			r.name;`
+
+	var rows []pgRole
+	if err := r.DB.SelectContext(ctx, &rows, query, uid); err != nil {
+		logger.Warn("unable to get roles of uid: %v, err: %v", uid.String(), err)
+		return nil, apperrors.NewInternal()
+	}
+
+	roles := make([]*model.Role, 0, len(rows))
+	for _, row := range rows {
+		roles = append(roles, &model.Role{
+			Name:        row.Name,
+			Description: row.Description,
+			Permissions: row.Permissions,
+		})
+	}
+	return roles, nil
+}
+
+func (r *pgRoleRepository) Assign(ctx context.Context, uid uuid.UUID, role string) error {
+	query := "INSERT INTO user_roles (uid, role) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+
+	if _, err := r.DB.ExecContext(ctx, query, uid, role); err != nil {
+		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "foreign_key_violation" {
+			logger.Warn("unable to assign role: %v to uid: %v, reason: %v", role, uid.String(), err.Detail)
+			return apperrors.NewNotFound("role", role)
+		}
+
+		logger.Warn("unable to assign role: %v to uid: %v, err: %v", role, uid.String(), err)
+		return apperrors.NewInternal()
+	}
+	return nil
+}
+
+func (r *pgRoleRepository) Unassign(ctx context.Context, uid uuid.UUID, role string) error {
+	query := "DELETE FROM user_roles WHERE uid = $1 AND role = $2"
+
+	if _, err := r.DB.ExecContext(ctx, query, uid, role); err != nil {
+		logger.Warn("unable to unassign role: %v of uid: %v, err: %v", role, uid.String(), err)
+		return apperrors.NewInternal()
+	}
+	return nil
+}
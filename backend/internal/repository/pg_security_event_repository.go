@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type pgSecurityEventRepository struct {
+	DB *sqlx.DB
+}
+
+func NewSecurityEventRepository(db *sqlx.DB) model.SecurityEventRepository {
+	return &pgSecurityEventRepository{
+		DB: db,
+	}
+}
+
+func (r *pgSecurityEventRepository) Create(ctx context.Context, e *model.SecurityEvent) error {
+	query := "INSERT INTO security_events (uid, type, ip, user_agent, client_id, created_at) VALUES ($1, $2, $3, $4, $5, $6)"
+
+	if _, err := r.DB.ExecContext(ctx, query, e.UID, e.Type, e.IP, e.UserAgent, e.ClientID, e.CreatedAt); err != nil {
+		logger.Warn("could not create security event: %s for uid: %v, reason: %v", e.Type, e.UID.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	return nil
+}
+
+func (r *pgSecurityEventRepository) FindByUID(ctx context.Context, uid uuid.UUID) ([]*model.SecurityEvent, error) {
+	events := []*model.SecurityEvent{}
+	query := "SELECT uid, type, ip, user_agent, client_id, created_at FROM security_events WHERE uid = $1 ORDER BY created_at, id"
+
+	if err := r.DB.SelectContext(ctx, &events, query, uid); err != nil {
+		logger.Warn("unable to get security events for uid: %v, err: %v", uid.String(), err)
+		return nil, apperrors.NewInternal()
+	}
+
+	return events, nil
+}
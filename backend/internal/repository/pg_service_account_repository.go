@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type pgServiceAccountRepository struct {
+	DB *sqlx.DB
+}
+
+func NewServiceAccountRepository(db *sqlx.DB) model.ServiceAccountRepository {
+	return &pgServiceAccountRepository{
+		DB: db,
+	}
+}
+
+type pgServiceAccount struct {
+	ID     string         `db:"id"`
+	Name   string         `db:"name"`
+	Secret string         `db:"secret"`
+	Scopes pq.StringArray `db:"scopes"`
+}
+
+func (r *pgServiceAccountRepository) FindByID(ctx context.Context, id string) (*model.ServiceAccount, error) {
+	sa := new(pgServiceAccount)
+	query := "SELECT id, name, secret, scopes FROM service_accounts WHERE id = $1"
+
+	if err := r.DB.GetContext(ctx, sa, query, id); err != nil {
+		logger.Warn("unable to get service account: %v, err: %v", id, err)
+		return nil, apperrors.NewNotFound("service_account", id)
+	}
+
+	return &model.ServiceAccount{
+		ID:     sa.ID,
+		Name:   sa.Name,
+		Secret: sa.Secret,
+		Scopes: sa.Scopes,
+	}, nil
+}
@@ -2,6 +2,9 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Kara4ev/go-web-tmp/internal/model"
 	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
@@ -49,8 +52,13 @@ func (r *pgUserRepository) FindByEmail(ctx context.Context, email string) (*mode
 }
 
 func (r *pgUserRepository) Create(ctx context.Context, u *model.User) error {
-	query := "INSERT INTO users (email, password) VALUES ($1, $2) RETURNING *"
-	if err := r.DB.GetContext(ctx, u, query, u.Email, u.Password); err != nil {
+	status := u.Status
+	if status == "" {
+		status = model.UserStatusActive
+	}
+
+	query := "INSERT INTO users (email, password, status) VALUES ($1, $2, $3) RETURNING *"
+	if err := r.DB.GetContext(ctx, u, query, u.Email, u.Password, status); err != nil {
 		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
 			logger.Warn("cloud not create a user with email: %v , reason: %v", u.Email, err.Code.Name())
 			return apperrors.NewConflict("email", u.Email)
@@ -87,3 +95,218 @@ func (r *pgUserRepository) Update(ctx context.Context, u *model.User) error {
 	return nil
 
 }
+
+// SetEmailVerified also activates an account pending verification
+func (r *pgUserRepository) SetEmailVerified(ctx context.Context, uid uuid.UUID) error {
+	query := `
+		UPDATE
+			users
+		SET
+			email_verified = TRUE,
+			status = CASE WHEN status = $2 THEN $3 ELSE status END
+		WHERE
+			uid = $1`
+
+	result, err := r.DB.ExecContext(ctx, query, uid, model.UserStatusPendingVerification, model.UserStatusActive)
+	if err != nil {
+		logger.Warn("unable to set email verified for uid: %v, err: %v", uid.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	if n, _ := result.RowsAffected(); n < 1 {
+		logger.Warn("unable to set email verified, user with uid: %v not found", uid.String())
+		return apperrors.NewNotFound("uid", uid.String())
+	}
+
+	return nil
+}
+
+func (r *pgUserRepository) UpdatePassword(ctx context.Context, uid uuid.UUID, password string) error {
+	query := "UPDATE users SET password = $2 WHERE uid = $1"
+
+	result, err := r.DB.ExecContext(ctx, query, uid, password)
+	if err != nil {
+		logger.Warn("unable to update password for uid: %v, err: %v", uid.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	if n, _ := result.RowsAffected(); n < 1 {
+		logger.Warn("unable to update password, user with uid: %v not found", uid.String())
+		return apperrors.NewNotFound("uid", uid.String())
+	}
+
+	return nil
+}
+
+// List returns a page of the users selected by the filter, newest first,
+// and the number of all selected users
+func (r *pgUserRepository) List(ctx context.Context, f *model.UserFilter) ([]*model.User, int64, error) {
+	var where []string
+	var args []interface{}
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.Query != "" {
+		p := arg("%" + escapeLike(f.Query) + "%")
+		where = append(where, fmt.Sprintf("(email ILIKE %s OR name ILIKE %s)", p, p))
+	}
+
+	if f.Status != "" {
+		where = append(where, "status = "+arg(f.Status))
+	}
+
+	if f.EmailVerified != nil {
+		where = append(where, "email_verified = "+arg(*f.EmailVerified))
+	}
+
+	if f.Role != "" {
+		where = append(where, "uid IN (SELECT uid FROM user_roles WHERE role = "+arg(f.Role)+")")
+	}
+
+	cond := ""
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int64
+	if err := r.DB.GetContext(ctx, &total, "SELECT COUNT(*) FROM users"+cond, args...); err != nil {
+		logger.Warn("unable to count users, err: %v", err)
+		return nil, 0, apperrors.NewInternal()
+	}
+
+	query := "SELECT * FROM users" + cond + " ORDER BY created_at DESC, uid LIMIT " + arg(f.Limit) + " OFFSET " + arg(f.Offset)
+
+	users := []*model.User{}
+	if err := r.DB.SelectContext(ctx, &users, query, args...); err != nil {
+		logger.Warn("unable to list users, err: %v", err)
+		return nil, 0, apperrors.NewInternal()
+	}
+
+	return users, total, nil
+}
+
+// Save writes every field of the user an admin can change
+func (r *pgUserRepository) Save(ctx context.Context, u *model.User) error {
+	query := `
+		UPDATE
+			users
+		SET
+			name=:name,
+			email=:email,
+			image_url=:image_url,
+			email_verified=:email_verified
+		WHERE
+			uid=:uid
+		RETURNING *;`
+
+	nstmt, err := r.DB.PrepareNamedContext(ctx, query)
+	if err != nil {
+		logger.Warn("unable to prepare user save query: %v", err)
+		return apperrors.NewInternal()
+	}
+
+	if err := nstmt.GetContext(ctx, u, u); err != nil {
+		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
+			logger.Warn("unable to save user uid: %v with email: %v, reason: %v", u.UID.String(), u.Email, err.Code.Name())
+			return apperrors.NewConflict("email", u.Email)
+		}
+
+		logger.Warn("unable to save user uid: %v, err: %v", u.UID.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	return nil
+}
+
+func (r *pgUserRepository) SetStatus(ctx context.Context, uid uuid.UUID, status string) error {
+	query := "UPDATE users SET status = $2 WHERE uid = $1"
+
+	result, err := r.DB.ExecContext(ctx, query, uid, status)
+	if err != nil {
+		logger.Warn("unable to set status: %v for uid: %v, err: %v", status, uid.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	if n, _ := result.RowsAffected(); n < 1 {
+		logger.Warn("unable to set status, user with uid: %v not found", uid.String())
+		return apperrors.NewNotFound("uid", uid.String())
+	}
+
+	return nil
+}
+
+// Delete removes the user, rows of the user in other tables are deleted by cascade
+func (r *pgUserRepository) Delete(ctx context.Context, uid uuid.UUID) error {
+	query := "DELETE FROM users WHERE uid = $1"
+
+	result, err := r.DB.ExecContext(ctx, query, uid)
+	if err != nil {
+		logger.Warn("unable to delete uid: %v, err: %v", uid.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	if n, _ := result.RowsAffected(); n < 1 {
+		logger.Warn("unable to delete, user with uid: %v not found", uid.String())
+		return apperrors.NewNotFound("uid", uid.String())
+	}
+
+	return nil
+}
+
+// ScheduleDeletion marks the user deleted at the time, the row is kept until it is purged
+func (r *pgUserRepository) ScheduleDeletion(ctx context.Context, uid uuid.UUID, at time.Time) error {
+	query := "UPDATE users SET status = $2, deleted_at = $3 WHERE uid = $1"
+
+	result, err := r.DB.ExecContext(ctx, query, uid, model.UserStatusDeleted, at)
+	if err != nil {
+		logger.Warn("unable to schedule deletion of uid: %v, err: %v", uid.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	if n, _ := result.RowsAffected(); n < 1 {
+		logger.Warn("unable to schedule deletion, user with uid: %v not found", uid.String())
+		return apperrors.NewNotFound("uid", uid.String())
+	}
+
+	return nil
+}
+
+// CancelDeletion reactivates a user marked deleted
+func (r *pgUserRepository) CancelDeletion(ctx context.Context, uid uuid.UUID) error {
+	query := "UPDATE users SET status = $2, deleted_at = NULL WHERE uid = $1 AND status = $3"
+
+	result, err := r.DB.ExecContext(ctx, query, uid, model.UserStatusActive, model.UserStatusDeleted)
+	if err != nil {
+		logger.Warn("unable to cancel deletion of uid: %v, err: %v", uid.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	if n, _ := result.RowsAffected(); n < 1 {
+		logger.Warn("unable to cancel deletion, deleted user with uid: %v not found", uid.String())
+		return apperrors.NewNotFound("uid", uid.String())
+	}
+
+	return nil
+}
+
+// PurgeDeleted deletes the users marked deleted before the time
+func (r *pgUserRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	query := "DELETE FROM users WHERE status = $1 AND deleted_at < $2"
+
+	result, err := r.DB.ExecContext(ctx, query, model.UserStatusDeleted, before)
+	if err != nil {
+		logger.Warn("unable to purge users deleted before: %v, err: %v", before, err)
+		return 0, apperrors.NewInternal()
+	}
+
+	n, _ := result.RowsAffected()
+	return n, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
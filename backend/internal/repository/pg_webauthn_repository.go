@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type pgWebAuthnRepository struct {
+	DB *sqlx.DB
+}
+
+func NewWebAuthnRepository(db *sqlx.DB) model.WebAuthnRepository {
+	return &pgWebAuthnRepository{
+		DB: db,
+	}
+}
+
+func (r *pgWebAuthnRepository) Create(ctx context.Context, c *model.WebAuthnCredential) error {
+	query := "INSERT INTO webauthn_credentials (id, uid, public_key, sign_count) VALUES ($1, $2, $3, $4)"
+
+	if _, err := r.DB.ExecContext(ctx, query, c.ID, c.UID, c.PublicKey, c.SignCount); err != nil {
+		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" {
+			logger.Warn("could not create webauthn credential: %v, reason: %v", c.ID, err.Code.Name())
+			return apperrors.NewConflict("credential", c.ID)
+		}
+
+		logger.Warn("could not create webauthn credential: %v, reason: %v", c.ID, err)
+		return apperrors.NewInternal()
+	}
+
+	return nil
+}
+
+func (r *pgWebAuthnRepository) FindByID(ctx context.Context, id string) (*model.WebAuthnCredential, error) {
+	c := new(model.WebAuthnCredential)
+	query := "SELECT id, uid, public_key, sign_count FROM webauthn_credentials WHERE id = $1"
+
+	if err := r.DB.GetContext(ctx, c, query, id); err != nil {
+		logger.Warn("unable to get webauthn credential: %v, err: %v", id, err)
+		return nil, apperrors.NewNotFound("credential", id)
+	}
+
+	return c, nil
+}
+
+func (r *pgWebAuthnRepository) FindByUID(ctx context.Context, uid uuid.UUID) ([]*model.WebAuthnCredential, error) {
+	credentials := []*model.WebAuthnCredential{}
+	query := "SELECT id, uid, public_key, sign_count FROM webauthn_credentials WHERE uid = $1 ORDER BY created_at"
+
+	if err := r.DB.SelectContext(ctx, &credentials, query, uid); err != nil {
+		logger.Warn("unable to get webauthn credentials for uid: %v, err: %v", uid.String(), err)
+		return nil, apperrors.NewInternal()
+	}
+
+	return credentials, nil
+}
+
+func (r *pgWebAuthnRepository) UpdateSignCount(ctx context.Context, id string, signCount int64) error {
+	query := "UPDATE webauthn_credentials SET sign_count = $2, last_used_at = NOW() WHERE id = $1"
+
+	if _, err := r.DB.ExecContext(ctx, query, id, signCount); err != nil {
+		logger.Warn("unable to update sign count of webauthn credential: %v, err: %v", id, err)
+		return apperrors.NewInternal()
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+type redisDataExportRepository struct {
+	Redis *redis.Client
+}
+
+func NewDataExportRepository(redisClient *redis.Client) model.DataExportRepository {
+	return &redisDataExportRepository{
+		Redis: redisClient,
+	}
+}
+
+func dataExportKey(uid uuid.UUID) string {
+	return fmt.Sprintf("data_export:%s", uid)
+}
+
+// archives are keyed by the user too, a user can not download the archive of another
+func dataExportArchiveKey(uid uuid.UUID, id string) string {
+	return fmt.Sprintf("data_export_archive:%s:%s", uid, id)
+}
+
+func (r *redisDataExportRepository) CreateExport(ctx context.Context, uid uuid.UUID, e *model.DataExport, expiresIn time.Duration) (bool, error) {
+	value, err := json.Marshal(e)
+	if err != nil {
+		logger.Warn("could not marshal data export of uid: %s: %v", uid, err)
+		return false, apperrors.NewInternal()
+	}
+
+	created, err := r.Redis.SetNX(ctx, dataExportKey(uid), value, expiresIn).Result()
+	if err != nil {
+		logger.Warn("could not SETNX data export to redis for uid: %s: %v", uid, err)
+		return false, apperrors.NewInternal()
+	}
+	return created, nil
+}
+
+func (r *redisDataExportRepository) GetExport(ctx context.Context, uid uuid.UUID) (*model.DataExport, error) {
+	value, err := r.Redis.Get(ctx, dataExportKey(uid)).Result()
+	if err == redis.Nil {
+		return nil, apperrors.NewNotFound("data_export", uid.String())
+	}
+
+	if err != nil {
+		logger.Warn("could not GET data export from redis for uid: %s: %v", uid, err)
+		return nil, apperrors.NewInternal()
+	}
+
+	e := new(model.DataExport)
+	if err := json.Unmarshal([]byte(value), e); err != nil {
+		logger.Warn("could not unmarshal data export of uid: %s: %v", uid, err)
+		return nil, apperrors.NewInternal()
+	}
+
+	return e, nil
+}
+
+func (r *redisDataExportRepository) SetExport(ctx context.Context, uid uuid.UUID, e *model.DataExport, expiresIn time.Duration) error {
+	value, err := json.Marshal(e)
+	if err != nil {
+		logger.Warn("could not marshal data export of uid: %s: %v", uid, err)
+		return apperrors.NewInternal()
+	}
+
+	if err := r.Redis.Set(ctx, dataExportKey(uid), value, expiresIn).Err(); err != nil {
+		logger.Warn("could not SET data export to redis for uid: %s: %v", uid, err)
+		return apperrors.NewInternal()
+	}
+	return nil
+}
+
+func (r *redisDataExportRepository) SetArchive(ctx context.Context, uid uuid.UUID, e *model.DataExport, archive []byte, expiresIn time.Duration) error {
+	value, err := json.Marshal(e)
+	if err != nil {
+		logger.Warn("could not marshal data export of uid: %s: %v", uid, err)
+		return apperrors.NewInternal()
+	}
+
+	pipe := r.Redis.TxPipeline()
+	pipe.Set(ctx, dataExportArchiveKey(uid, e.ID), archive, expiresIn)
+	pipe.Set(ctx, dataExportKey(uid), value, expiresIn)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Warn("could not SET data export archive to redis for uid: %s: %v", uid, err)
+		return apperrors.NewInternal()
+	}
+	return nil
+}
+
+func (r *redisDataExportRepository) GetArchive(ctx context.Context, uid uuid.UUID, id string) ([]byte, error) {
+	archive, err := r.Redis.Get(ctx, dataExportArchiveKey(uid, id)).Bytes()
+	if err == redis.Nil {
+		return nil, apperrors.NewNotFound("data_export", id)
+	}
+
+	if err != nil {
+		logger.Warn("could not GET data export archive from redis for uid: %s: %v", uid, err)
+		return nil, apperrors.NewInternal()
+	}
+
+	return archive, nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataExport(t *testing.T) {
+	ctx := context.TODO()
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	t.Cleanup(mr.Close)
+
+	r := NewDataExportRepository(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	uid := uuid.New()
+	otherUID := uuid.New()
+	e := &model.DataExport{ID: "export-id", Status: model.DataExportPending, CreatedAt: time.Now().UTC()}
+
+	_, err = r.GetExport(ctx, uid)
+	assert.Equal(t, http.StatusNotFound, apperrors.Status(err))
+
+	created, err := r.CreateExport(ctx, uid, e, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	// a second request does not start another export
+	created, err = r.CreateExport(ctx, uid, &model.DataExport{ID: "other-id"}, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	e.Status = model.DataExportReady
+	assert.NoError(t, r.SetArchive(ctx, uid, e, []byte("archive"), time.Hour))
+
+	actual, err := r.GetExport(ctx, uid)
+	assert.NoError(t, err)
+	assert.Equal(t, "export-id", actual.ID)
+	assert.Equal(t, model.DataExportReady, actual.Status)
+
+	archive, err := r.GetArchive(ctx, uid, "export-id")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("archive"), archive)
+
+	// archives belong to the user of the export
+	_, err = r.GetArchive(ctx, otherUID, "export-id")
+	assert.Equal(t, http.StatusNotFound, apperrors.Status(err))
+
+	mr.FastForward(time.Hour)
+	_, err = r.GetArchive(ctx, uid, "export-id")
+	assert.Equal(t, http.StatusNotFound, apperrors.Status(err))
+	_, err = r.GetExport(ctx, uid)
+	assert.Equal(t, http.StatusNotFound, apperrors.Status(err))
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+type redisLoginAttemptRepository struct {
+	Redis *redis.Client
+}
+
+func NewLoginAttemptRepository(redisClient *redis.Client) model.LoginAttemptRepository {
+	return &redisLoginAttemptRepository{
+		Redis: redisClient,
+	}
+}
+
+// Failures are a sorted set of the failure times, scored by unix milliseconds.
+// Failures older than the window are trimmed on every access, so the count
+// is of a sliding window
+func loginFailuresKey(key string) string {
+	return fmt.Sprintf("login_failures:%s", key)
+}
+
+func loginLockoutKey(key string) string {
+	return fmt.Sprintf("login_lockout:%s", key)
+}
+
+// AddFailure records a failed attempt and returns the failures within the window
+func (r *redisLoginAttemptRepository) AddFailure(ctx context.Context, key string, at time.Time, window time.Duration) (int64, error) {
+	k := loginFailuresKey(key)
+
+	// members have to be unique, concurrent failures may share a timestamp
+	member := fmt.Sprintf("%d:%s", at.UnixNano(), uuid.NewString())
+
+	pipe := r.Redis.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, k, "-inf", "("+strconv.FormatInt(at.Add(-window).UnixMilli(), 10))
+	pipe.ZAdd(ctx, k, &redis.Z{Score: float64(at.UnixMilli()), Member: member})
+	count := pipe.ZCard(ctx, k)
+	pipe.PExpire(ctx, k, window)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Warn("could not add login failure of: %s to redis: %v", key, err)
+		return 0, apperrors.NewInternal()
+	}
+
+	return count.Val(), nil
+}
+
+// Failures returns the failures within the window and the time of the last one
+func (r *redisLoginAttemptRepository) Failures(ctx context.Context, key string, now time.Time, window time.Duration) (int64, time.Time, error) {
+	k := loginFailuresKey(key)
+
+	pipe := r.Redis.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, k, "-inf", "("+strconv.FormatInt(now.Add(-window).UnixMilli(), 10))
+	count := pipe.ZCard(ctx, k)
+	last := pipe.ZRangeWithScores(ctx, k, -1, -1)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Warn("could not get login failures of: %s from redis: %v", key, err)
+		return 0, time.Time{}, apperrors.NewInternal()
+	}
+
+	var lastAt time.Time
+	if zs := last.Val(); len(zs) > 0 {
+		lastAt = time.UnixMilli(int64(zs[0].Score))
+	}
+
+	return count.Val(), lastAt, nil
+}
+
+// ResetFailures forgets the failures of the key
+func (r *redisLoginAttemptRepository) ResetFailures(ctx context.Context, key string) error {
+	if err := r.Redis.Del(ctx, loginFailuresKey(key)).Err(); err != nil {
+		logger.Warn("could not reset login failures of: %s in redis: %v", key, err)
+		return apperrors.NewInternal()
+	}
+	return nil
+}
+
+// Lock locks the key out for d
+func (r *redisLoginAttemptRepository) Lock(ctx context.Context, key string, d time.Duration) error {
+	if err := r.Redis.Set(ctx, loginLockoutKey(key), 1, d).Err(); err != nil {
+		logger.Warn("could not lock out: %s in redis: %v", key, err)
+		return apperrors.NewInternal()
+	}
+	return nil
+}
+
+// LockedFor returns how long the key is still locked out, 0 if it is not
+func (r *redisLoginAttemptRepository) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.Redis.PTTL(ctx, loginLockoutKey(key)).Result()
+	if err != nil {
+		logger.Warn("could not get lockout of: %s from redis: %v", key, err)
+		return 0, apperrors.NewInternal()
+	}
+
+	// negative for a missing key or a key without ttl
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
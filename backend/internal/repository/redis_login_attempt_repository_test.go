@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginAttempts(t *testing.T) {
+	ctx := context.TODO()
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	t.Cleanup(mr.Close)
+
+	r := NewLoginAttemptRepository(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	window := 10 * time.Minute
+	start := time.Now()
+
+	t.Run("Failures slide out of the window", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			count, err := r.AddFailure(ctx, "email:bob@bob.com", start.Add(time.Duration(i)*time.Minute), window)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(i+1), count)
+		}
+
+		count, last, err := r.Failures(ctx, "email:bob@bob.com", start.Add(2*time.Minute), window)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+		assert.Equal(t, start.Add(2*time.Minute).UnixMilli(), last.UnixMilli())
+
+		// the first failure is out of the window
+		count, err = r.AddFailure(ctx, "email:bob@bob.com", start.Add(window+30*time.Second), window)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+
+		assert.NoError(t, r.ResetFailures(ctx, "email:bob@bob.com"))
+		count, last, err = r.Failures(ctx, "email:bob@bob.com", start, window)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), count)
+		assert.True(t, last.IsZero())
+	})
+
+	t.Run("Lockout expires", func(t *testing.T) {
+		d, err := r.LockedFor(ctx, "ip:10.0.0.1")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Duration(0), d)
+
+		assert.NoError(t, r.Lock(ctx, "ip:10.0.0.1", time.Minute))
+		d, err = r.LockedFor(ctx, "ip:10.0.0.1")
+		assert.NoError(t, err)
+		assert.True(t, d > 0 && d <= time.Minute)
+
+		mr.FastForward(time.Minute)
+		d, err = r.LockedFor(ctx, "ip:10.0.0.1")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Duration(0), d)
+	})
+}
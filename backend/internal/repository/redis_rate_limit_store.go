@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/go-redis/redis/v8"
+)
+
+type redisRateLimitStore struct {
+	Redis *redis.Client
+}
+
+// NewRateLimitStore keeps the buckets in redis, shared by every instance
+func NewRateLimitStore(redisClient *redis.Client) model.RateLimitStore {
+	return &redisRateLimitStore{
+		Redis: redisClient,
+	}
+}
+
+// takeTokenScript refills the bucket for the time since it was last taken from
+// and takes a token. The bucket expires once it would be full again.
+// The clock is of the caller, the time never goes back on skewed instances
+var takeTokenScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+	ts = now
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(ts))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+func (s *redisRateLimitStore) Take(ctx context.Context, key string, l model.RateLimit, now time.Time) (*model.RateLimitResult, error) {
+	k := fmt.Sprintf("rate_limit:%s", key)
+
+	res, err := takeTokenScript.Run(ctx, s.Redis, []string{k}, l.Rate, l.Burst, now.UnixMilli()).Slice()
+	if err != nil || len(res) != 2 {
+		logger.Warn("could not take rate limit token of: %s from redis: %v", key, err)
+		return nil, apperrors.NewInternal()
+	}
+
+	allowed, _ := res[0].(int64)
+	value, _ := res[1].(string)
+
+	tokens, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		logger.Warn("invalid rate limit tokens of: %s in redis: %q", key, value)
+		return nil, apperrors.NewInternal()
+	}
+
+	return l.Result(allowed == 1, tokens), nil
+}
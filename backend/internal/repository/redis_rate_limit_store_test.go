@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitStore(t *testing.T) {
+	ctx := context.TODO()
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	t.Cleanup(mr.Close)
+
+	limit := model.RateLimit{Rate: 2, Burst: 3}
+	start := time.Now()
+
+	for name, s := range map[string]model.RateLimitStore{
+		"redis":  NewRateLimitStore(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+		"memory": NewMemoryRateLimitStore(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				res, err := s.Take(ctx, "ip:10.0.0.1", limit, start)
+				assert.NoError(t, err)
+				assert.True(t, res.Allowed)
+				assert.Equal(t, 2-i, res.Remaining)
+			}
+
+			res, err := s.Take(ctx, "ip:10.0.0.1", limit, start)
+			assert.NoError(t, err)
+			assert.False(t, res.Allowed)
+			assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+			assert.Equal(t, 1500*time.Millisecond, res.Reset)
+
+			// a token is refilled after 1/rate
+			res, err = s.Take(ctx, "ip:10.0.0.1", limit, start.Add(500*time.Millisecond))
+			assert.NoError(t, err)
+			assert.True(t, res.Allowed)
+			assert.Equal(t, 0, res.Remaining)
+
+			// the bucket is never more than full
+			res, err = s.Take(ctx, "ip:10.0.0.1", limit, start.Add(time.Hour))
+			assert.NoError(t, err)
+			assert.True(t, res.Allowed)
+			assert.Equal(t, 2, res.Remaining)
+		})
+	}
+}
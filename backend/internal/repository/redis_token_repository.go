@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
 	"github.com/Kara4ev/go-web-tmp/pkg/logger"
 	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 )
 
 type redisTokenRepository struct {
@@ -21,53 +23,409 @@ func NewTokenRepository(redisClient *redis.Client) model.TokenRepository {
 	}
 }
 
-func (r *redisTokenRepository) SetRefreshToken(ctx context.Context, userID, tokenID string, expiresIn time.Duration) error {
-	key := fmt.Sprintf("%s:%s", userID, tokenID)
-	if err := r.Redis.Set(ctx, key, 0, expiresIn).Err(); err != nil {
+// redisSession is the value stored with each refresh token
+type redisSession struct {
+	ID              string    `json:"id"`
+	UserAgent       string    `json:"ua"`
+	IP              string    `json:"ip"`
+	ClientID        string    `json:"client_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	LastRefreshedAt time.Time `json:"last_refreshed_at"`
+}
+
+// Refresh tokens are stored as userID:tokenID with the session as value. Every
+// user has a set of its token ids, so the tokens of a user are found without SCAN.
+// The set is updated with the token keys in a single transaction or script
+func refreshTokenKey(userID, tokenID string) string {
+	return fmt.Sprintf("%s:%s", userID, tokenID)
+}
+
+func refreshTokenSetKey(userID string) string {
+	return fmt.Sprintf("refresh_tokens:%s", userID)
+}
+
+func (r *redisTokenRepository) SetRefreshToken(ctx context.Context, userID, tokenID string, s *model.Session, expiresIn time.Duration) error {
+	value, err := json.Marshal(redisSession{
+		ID:              s.ID,
+		UserAgent:       s.UserAgent,
+		IP:              s.IP,
+		ClientID:        s.ClientID,
+		CreatedAt:       s.CreatedAt,
+		LastRefreshedAt: s.LastRefreshedAt,
+	})
+	if err != nil {
+		logger.Warn("could not marshal session for userID/tokenID: %s/%s: %v", userID, tokenID, err)
+		return apperrors.NewInternal()
+	}
+
+	// refresh tokens share one lifetime, the newest token outlives the others in the set
+	pipe := r.Redis.TxPipeline()
+	pipe.Set(ctx, refreshTokenKey(userID, tokenID), value, expiresIn)
+	pipe.SAdd(ctx, refreshTokenSetKey(userID), tokenID)
+	pipe.PExpire(ctx, refreshTokenSetKey(userID), expiresIn)
+
+	if _, err := pipe.Exec(ctx); err != nil {
 		logger.Warn("could not SET refresh token to redis for userID/tokenID: %s/%s: %v", userID, tokenID, err)
 		return apperrors.NewInternal()
 	}
 	return nil
 }
 
-func (r *redisTokenRepository) DeleteRefreshToken(ctx context.Context, userID, prevTokenID string) error {
-	key := fmt.Sprintf("%s:%s", userID, prevTokenID)
-	result := r.Redis.Del(ctx, key)
-	if err := result.Err(); err != nil {
-		logger.Warn("could not DEL refresh token to redis for userID/tokenID: %s/%s: %v", userID, prevTokenID, err)
+// GetRefreshToken returns the session stored with the refresh token
+func (r *redisTokenRepository) GetRefreshToken(ctx context.Context, userID, tokenID string) (*model.Session, error) {
+	value, err := r.Redis.Get(ctx, refreshTokenKey(userID, tokenID)).Result()
+	if err == redis.Nil {
+		logger.Warn("refresh token to redis for userID/tokenID: %s/%s does not exists", userID, tokenID)
+		return nil, apperrors.NewAuthorization("invalid refresh token")
+	}
+
+	if err != nil {
+		logger.Warn("could not GET refresh token from redis for userID/tokenID: %s/%s: %v", userID, tokenID, err)
+		return nil, apperrors.NewInternal()
+	}
+
+	return parseSession(userID, tokenID, value), nil
+}
+
+// Opaque refresh tokens are found by the hash of the token. The entry is kept until
+// the token expires, a rotated token is still resolved to its user to detect reuse
+func opaqueRefreshTokenKey(tokenHash string) string {
+	return fmt.Sprintf("opaque_refresh_token:%s", tokenHash)
+}
+
+// SetOpaqueRefreshToken stores what the opaque refresh token was issued for under its hash
+func (r *redisTokenRepository) SetOpaqueRefreshToken(ctx context.Context, tokenHash string, t *model.OpaqueRefreshToken, expiresIn time.Duration) error {
+	value, err := json.Marshal(t)
+	if err != nil {
+		logger.Warn("could not marshal opaque refresh token for userID: %s: %v", t.UID, err)
+		return apperrors.NewInternal()
+	}
+
+	if err := r.Redis.Set(ctx, opaqueRefreshTokenKey(tokenHash), value, expiresIn).Err(); err != nil {
+		logger.Warn("could not SET opaque refresh token to redis for userID: %s: %v", t.UID, err)
 		return apperrors.NewInternal()
 	}
+	return nil
+}
+
+// GetOpaqueRefreshToken returns what the opaque refresh token was issued for
+func (r *redisTokenRepository) GetOpaqueRefreshToken(ctx context.Context, tokenHash string) (*model.OpaqueRefreshToken, error) {
+	value, err := r.Redis.Get(ctx, opaqueRefreshTokenKey(tokenHash)).Result()
+	if err == redis.Nil {
+		logger.Warn("opaque refresh token does not exists")
+		return nil, apperrors.NewAuthorization("invalid refresh token")
+	}
+
+	if err != nil {
+		logger.Warn("could not GET opaque refresh token from redis: %v", err)
+		return nil, apperrors.NewInternal()
+	}
+
+	t := new(model.OpaqueRefreshToken)
+	if err := json.Unmarshal([]byte(value), t); err != nil {
+		logger.Warn("could not unmarshal opaque refresh token: %v", err)
+		return nil, apperrors.NewInternal()
+	}
+
+	return t, nil
+}
 
-	if result.Val() < 1 {
+// DeleteRefreshToken deletes the refresh token and returns the session stored with it
+func (r *redisTokenRepository) DeleteRefreshToken(ctx context.Context, userID, prevTokenID string) (*model.Session, error) {
+	pipe := r.Redis.TxPipeline()
+	getDel := pipe.GetDel(ctx, refreshTokenKey(userID, prevTokenID))
+	pipe.SRem(ctx, refreshTokenSetKey(userID), prevTokenID)
+
+	_, err := pipe.Exec(ctx)
+	if err == redis.Nil {
 		logger.Warn("refresh token to redis for userID/tokenID: %s/%s does not exists", userID, prevTokenID)
-		return apperrors.NewAuthorization("invalid refresh token")
+		return nil, apperrors.NewAuthorization("invalid refresh token")
 	}
 
-	return nil
+	if err != nil {
+		logger.Warn("could not DEL refresh token to redis for userID/tokenID: %s/%s: %v", userID, prevTokenID, err)
+		return nil, apperrors.NewInternal()
+	}
+
+	return parseSession(userID, prevTokenID, getDel.Val()), nil
 }
 
-func (r *redisTokenRepository) DeleteUserRefreshToken(ctx context.Context, userID string) error {
-	pattern := fmt.Sprintf("%s*", userID)
+// rotateRefreshTokenScript deletes the refresh token and keeps its session under
+// the rotated key. A token found only under the rotated key was already used
+var rotateRefreshTokenScript = redis.NewScript(`
+local session = redis.call('GET', KEYS[1])
+if session then
+	redis.call('DEL', KEYS[1])
+	redis.call('SREM', KEYS[3], ARGV[2])
+	redis.call('SET', KEYS[2], session, 'PX', ARGV[1])
+	return {1, session}
+end
+local rotated = redis.call('GET', KEYS[2])
+if rotated then
+	return {2, rotated}
+end
+return {0, ''}
+`)
+
+// RotateRefreshToken deletes the refresh token and remembers it as rotated for expiresIn.
+// It reports reused when the token was rotated before, the returned session is the family of the token
+func (r *redisTokenRepository) RotateRefreshToken(ctx context.Context, userID, prevTokenID string, expiresIn time.Duration) (*model.Session, bool, error) {
+	keys := []string{
+		refreshTokenKey(userID, prevTokenID),
+		fmt.Sprintf("rotated:%s:%s", userID, prevTokenID),
+		refreshTokenSetKey(userID),
+	}
 
-	iter := r.Redis.Scan(ctx, 0, pattern, 5).Iterator()
-	failCount := 0
+	res, err := rotateRefreshTokenScript.Run(ctx, r.Redis, keys, expiresIn.Milliseconds(), prevTokenID).Slice()
+	if err != nil || len(res) != 2 {
+		logger.Warn("could not rotate refresh token in redis for userID/tokenID: %s/%s: %v", userID, prevTokenID, err)
+		return nil, false, apperrors.NewInternal()
+	}
+
+	status, _ := res[0].(int64)
+	value, _ := res[1].(string)
+
+	switch status {
+	case 1:
+		return parseSession(userID, prevTokenID, value), false, nil
+	case 2:
+		return parseSession(userID, prevTokenID, value), true, nil
+	}
+
+	logger.Warn("refresh token to redis for userID/tokenID: %s/%s does not exists", userID, prevTokenID)
+	return nil, false, apperrors.NewAuthorization("invalid refresh token")
+}
+
+// ListSessions returns the sessions of every refresh token of the user.
+// Ids of expired tokens are removed from the set
+func (r *redisTokenRepository) ListSessions(ctx context.Context, userID string) ([]*model.Session, error) {
+	tokenIDs, err := r.Redis.SMembers(ctx, refreshTokenSetKey(userID)).Result()
+	if err != nil {
+		logger.Warn("could not SMEMBERS refresh tokens of userID: %s: %v", userID, err)
+		return nil, apperrors.NewInternal()
+	}
 
-	if iter.Next(ctx) {
-		if err := r.Redis.Del(ctx, iter.Val()).Err(); err != nil {
-			logger.Error("failes to delete found refrash token: %s, err: %v", iter.Val(), err)
-			failCount++
+	sessions := []*model.Session{}
+	if len(tokenIDs) == 0 {
+		return sessions, nil
+	}
+
+	keys := make([]string, 0, len(tokenIDs))
+	for _, tokenID := range tokenIDs {
+		keys = append(keys, refreshTokenKey(userID, tokenID))
+	}
+
+	values, err := r.Redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		logger.Warn("could not MGET refresh tokens of userID: %s: %v", userID, err)
+		return nil, apperrors.NewInternal()
+	}
+
+	expired := []interface{}{}
+	for i, value := range values {
+		v, ok := value.(string)
+		if !ok {
+			expired = append(expired, tokenIDs[i])
+			continue
 		}
+		sessions = append(sessions, parseSession(userID, tokenIDs[i], v))
 	}
 
-	if err := iter.Err(); err != nil {
-		logger.Warn("failes to delete refrash token: %s, err: %v", iter.Val(), err)
-		failCount++
+	if len(expired) > 0 {
+		if err := r.Redis.SRem(ctx, refreshTokenSetKey(userID), expired...).Err(); err != nil {
+			logger.Warn("could not SREM expired refresh tokens of userID: %s: %v", userID, err)
+		}
 	}
 
-	if failCount > 0 {
+	return sessions, nil
+}
+
+// DeleteUserRefreshToken deletes every refresh token in the set of the user in one
+// transaction. Only the ids read are removed from the set, a token set meanwhile stays indexed
+func (r *redisTokenRepository) DeleteUserRefreshToken(ctx context.Context, userID string) error {
+	tokenIDs, err := r.Redis.SMembers(ctx, refreshTokenSetKey(userID)).Result()
+	if err != nil {
+		logger.Error("failes to SMEMBERS refrash tokens of userID: %s, err: %v", userID, err)
 		return apperrors.NewInternal()
 	}
 
+	if len(tokenIDs) == 0 {
+		return nil
+	}
+
+	// a DEL for each key, the keys of the tokens are not in the slot of the set
+	pipe := r.Redis.TxPipeline()
+	members := make([]interface{}, 0, len(tokenIDs))
+	for _, tokenID := range tokenIDs {
+		pipe.Del(ctx, refreshTokenKey(userID, tokenID))
+		members = append(members, tokenID)
+	}
+	pipe.SRem(ctx, refreshTokenSetKey(userID), members...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Error("failes to delete refrash tokens of userID: %s, err: %v", userID, err)
+		return apperrors.NewInternal()
+	}
+
+	logger.Debug("deleted %d refresh tokens of userID: %s", len(tokenIDs), userID)
+	return nil
+}
+
+func (r *redisTokenRepository) SetOneTimeToken(ctx context.Context, purpose, tokenHash, userID string, expiresIn time.Duration) error {
+	key := fmt.Sprintf("%s:%s", purpose, tokenHash)
+	if err := r.Redis.Set(ctx, key, userID, expiresIn).Err(); err != nil {
+		logger.Warn("could not SET %s token to redis for userID: %s: %v", purpose, userID, err)
+		return apperrors.NewInternal()
+	}
+	return nil
+}
+
+// ConsumeOneTimeToken returns the userID the token was issued for and deletes
+// the token in the same command, so it can be used only once
+func (r *redisTokenRepository) ConsumeOneTimeToken(ctx context.Context, purpose, tokenHash string) (string, error) {
+	key := fmt.Sprintf("%s:%s", purpose, tokenHash)
+	userID, err := r.Redis.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		logger.Warn("%s token does not exists", purpose)
+		return "", apperrors.NewNotFound(purpose, "token")
+	}
+
+	if err != nil {
+		logger.Warn("could not GETDEL %s token from redis: %v", purpose, err)
+		return "", apperrors.NewInternal()
+	}
+
+	return userID, nil
+}
+
+// GetOneTimeToken returns the userID the token was issued for without deleting it
+func (r *redisTokenRepository) GetOneTimeToken(ctx context.Context, purpose, tokenHash string) (string, error) {
+	key := fmt.Sprintf("%s:%s", purpose, tokenHash)
+	userID, err := r.Redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		logger.Warn("%s token does not exists", purpose)
+		return "", apperrors.NewNotFound(purpose, "token")
+	}
+
+	if err != nil {
+		logger.Warn("could not GET %s token from redis: %v", purpose, err)
+		return "", apperrors.NewInternal()
+	}
+
+	return userID, nil
+}
+
+// IncrOneTimeTokenAttempts counts the attempts to use the token and returns the current count
+func (r *redisTokenRepository) IncrOneTimeTokenAttempts(ctx context.Context, purpose, tokenHash string, expiresIn time.Duration) (int64, error) {
+	key := fmt.Sprintf("%s:%s:attempts", purpose, tokenHash)
+
+	pipe := r.Redis.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, expiresIn)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Warn("could not INCR %s token attempts in redis: %v", purpose, err)
+		return 0, apperrors.NewInternal()
+	}
+
+	return incr.Val(), nil
+}
+
+// SetAuthorizationCode stores what the code was issued for under the hash of the code
+func (r *redisTokenRepository) SetAuthorizationCode(ctx context.Context, codeHash string, code *model.AuthorizationCode, expiresIn time.Duration) error {
+	key := fmt.Sprintf("authorization_code:%s", codeHash)
+
+	value, err := json.Marshal(code)
+	if err != nil {
+		logger.Warn("could not marshal authorization code for client: %s: %v", code.ClientID, err)
+		return apperrors.NewInternal()
+	}
+
+	if err := r.Redis.Set(ctx, key, value, expiresIn).Err(); err != nil {
+		logger.Warn("could not SET authorization code to redis for client: %s: %v", code.ClientID, err)
+		return apperrors.NewInternal()
+	}
 	return nil
+}
+
+// ConsumeAuthorizationCode returns and deletes the code in the same command, so it can be exchanged only once
+func (r *redisTokenRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*model.AuthorizationCode, error) {
+	key := fmt.Sprintf("authorization_code:%s", codeHash)
+	value, err := r.Redis.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		logger.Warn("authorization code does not exists")
+		return nil, apperrors.NewNotFound("authorization_code", "code")
+	}
+
+	if err != nil {
+		logger.Warn("could not GETDEL authorization code from redis: %v", err)
+		return nil, apperrors.NewInternal()
+	}
+
+	code := new(model.AuthorizationCode)
+	if err := json.Unmarshal([]byte(value), code); err != nil {
+		logger.Warn("could not unmarshal authorization code: %v", err)
+		return nil, apperrors.NewInternal()
+	}
+
+	return code, nil
+}
+
+// The denylist holds ids of revoked id tokens, a jti for a single token
+// or a session id for every token of the session
+func denylistKey(id string) string {
+	return fmt.Sprintf("denylist:%s", id)
+}
+
+// DenyTokens adds the ids to the denylist until expiresIn, when the tokens have expired
+func (r *redisTokenRepository) DenyTokens(ctx context.Context, ids []string, expiresIn time.Duration) error {
+	// an expired token needs no entry, redis would keep one without expiration forever
+	if len(ids) == 0 || expiresIn <= 0 {
+		return nil
+	}
+
+	pipe := r.Redis.Pipeline()
+	for _, id := range ids {
+		pipe.Set(ctx, denylistKey(id), 1, expiresIn)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Warn("could not SET denylist entries to redis: %v", err)
+		return apperrors.NewInternal()
+	}
+	return nil
+}
+
+// IsTokenDenied reports whether the id is in the denylist
+func (r *redisTokenRepository) IsTokenDenied(ctx context.Context, id string) (bool, error) {
+	n, err := r.Redis.Exists(ctx, denylistKey(id)).Result()
+	if err != nil {
+		logger.Warn("could not check denylist entry in redis: %v", err)
+		return false, apperrors.NewInternal()
+	}
+
+	return n > 0, nil
+}
+
+// parseSession decodes a stored session, refresh tokens issued before
+// sessions were stored have no metadata and use the token id as session id
+func parseSession(userID, tokenID, value string) *model.Session {
+	s := &model.Session{ID: tokenID, TokenID: tokenID}
+	if uid, err := uuid.Parse(userID); err == nil {
+		s.UID = uid
+	}
+
+	var rs redisSession
+	if err := json.Unmarshal([]byte(value), &rs); err != nil {
+		logger.Debug("refresh token: %s has no session data", tokenID)
+		return s
+	}
+
+	s.ID = rs.ID
+	s.UserAgent = rs.UserAgent
+	s.IP = rs.IP
+	s.ClientID = rs.ClientID
+	s.CreatedAt = rs.CreatedAt
+	s.LastRefreshedAt = rs.LastRefreshedAt
 
+	return s
 }
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTokenRepository(t *testing.T) (*miniredis.Miniredis, model.TokenRepository) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	t.Cleanup(mr.Close)
+
+	return mr, NewTokenRepository(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+}
+
+func TestRefreshTokenSet(t *testing.T) {
+	ctx := context.TODO()
+	exp := time.Hour
+
+	t.Run("Signout deletes every session", func(t *testing.T) {
+		mr, r := newTestTokenRepository(t)
+		userID := uuid.New().String()
+		otherUserID := uuid.New().String()
+
+		for i := 0; i < 20; i++ {
+			err := r.SetRefreshToken(ctx, userID, fmt.Sprintf("token-%d", i), &model.Session{ID: fmt.Sprintf("session-%d", i)}, exp)
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, r.SetRefreshToken(ctx, otherUserID, "other-token", &model.Session{ID: "other"}, exp))
+
+		sessions, err := r.ListSessions(ctx, userID)
+		assert.NoError(t, err)
+		assert.Len(t, sessions, 20)
+
+		assert.NoError(t, r.DeleteUserRefreshToken(ctx, userID))
+
+		sessions, err = r.ListSessions(ctx, userID)
+		assert.NoError(t, err)
+		assert.Empty(t, sessions)
+
+		for i := 0; i < 20; i++ {
+			assert.False(t, mr.Exists(fmt.Sprintf("%s:token-%d", userID, i)))
+		}
+		assert.False(t, mr.Exists(refreshTokenSetKey(userID)))
+
+		// tokens of other users are kept
+		assert.True(t, mr.Exists(otherUserID+":other-token"))
+
+		// signout without sessions
+		assert.NoError(t, r.DeleteUserRefreshToken(ctx, userID))
+	})
+
+	t.Run("Rotation keeps the set in sync", func(t *testing.T) {
+		mr, r := newTestTokenRepository(t)
+		userID := uuid.New().String()
+		session := &model.Session{ID: "session", UserAgent: "Mozilla/5.0", IP: "10.0.0.1"}
+
+		assert.NoError(t, r.SetRefreshToken(ctx, userID, "first", session, exp))
+
+		prev, reused, err := r.RotateRefreshToken(ctx, userID, "first", exp)
+		assert.NoError(t, err)
+		assert.False(t, reused)
+		assert.Equal(t, session.ID, prev.ID)
+		assert.Equal(t, session.UserAgent, prev.UserAgent)
+
+		assert.NoError(t, r.SetRefreshToken(ctx, userID, "second", session, exp))
+
+		members, err := mr.Members(refreshTokenSetKey(userID))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"second"}, members)
+
+		// the rotated token is reported as reused with its family
+		prev, reused, err = r.RotateRefreshToken(ctx, userID, "first", exp)
+		assert.NoError(t, err)
+		assert.True(t, reused)
+		assert.Equal(t, session.ID, prev.ID)
+
+		_, _, err = r.RotateRefreshToken(ctx, userID, "unknown", exp)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+	})
+
+	t.Run("Delete one session", func(t *testing.T) {
+		mr, r := newTestTokenRepository(t)
+		userID := uuid.New().String()
+
+		assert.NoError(t, r.SetRefreshToken(ctx, userID, "kept", &model.Session{ID: "kept"}, exp))
+		assert.NoError(t, r.SetRefreshToken(ctx, userID, "lost", &model.Session{ID: "lost"}, exp))
+
+		prev, err := r.DeleteRefreshToken(ctx, userID, "lost")
+		assert.NoError(t, err)
+		assert.Equal(t, "lost", prev.ID)
+
+		members, err := mr.Members(refreshTokenSetKey(userID))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"kept"}, members)
+
+		_, err = r.DeleteRefreshToken(ctx, userID, "lost")
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+	})
+
+	t.Run("Expired tokens are dropped from the set", func(t *testing.T) {
+		mr, r := newTestTokenRepository(t)
+		userID := uuid.New().String()
+
+		assert.NoError(t, r.SetRefreshToken(ctx, userID, "short", &model.Session{ID: "short"}, time.Minute))
+		assert.NoError(t, r.SetRefreshToken(ctx, userID, "long", &model.Session{ID: "long"}, exp))
+
+		mr.FastForward(2 * time.Minute)
+
+		sessions, err := r.ListSessions(ctx, userID)
+		assert.NoError(t, err)
+		assert.Len(t, sessions, 1)
+		assert.Equal(t, "long", sessions[0].ID)
+
+		members, err := mr.Members(refreshTokenSetKey(userID))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"long"}, members)
+	})
+}
+
+func TestDenylist(t *testing.T) {
+	ctx := context.TODO()
+	mr, r := newTestTokenRepository(t)
+
+	assert.NoError(t, r.DenyTokens(ctx, []string{"jti", "sid"}, time.Minute))
+	// an expired token is not added
+	assert.NoError(t, r.DenyTokens(ctx, []string{"expired"}, 0))
+
+	for id, want := range map[string]bool{"jti": true, "sid": true, "expired": false, "other": false} {
+		denied, err := r.IsTokenDenied(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, want, denied, id)
+	}
+
+	mr.FastForward(time.Minute)
+
+	denied, err := r.IsTokenDenied(ctx, "jti")
+	assert.NoError(t, err)
+	assert.False(t, denied)
+}
+
+func TestOpaqueRefreshToken(t *testing.T) {
+	ctx := context.TODO()
+	mr, r := newTestTokenRepository(t)
+
+	issued := &model.OpaqueRefreshToken{
+		UID:       uuid.New(),
+		SessionID: "session",
+		IssuedAt:  time.Now().UTC().Truncate(time.Second),
+		ExpiresAt: time.Now().UTC().Truncate(time.Second).Add(time.Hour),
+	}
+
+	assert.NoError(t, r.SetOpaqueRefreshToken(ctx, "hash", issued, time.Hour))
+
+	got, err := r.GetOpaqueRefreshToken(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, issued, got)
+
+	_, err = r.GetOpaqueRefreshToken(ctx, "other")
+	assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+
+	mr.FastForward(time.Hour)
+
+	_, err = r.GetOpaqueRefreshToken(ctx, "hash")
+	assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+)
+
+// denylistCacheMinSweep is the size of the cache before expired entries are swept
+const denylistCacheMinSweep = 1024
+
+// denylistCache remembers denylist lookups in process, so validating an id token
+// does not hit redis on every request. Denied ids are kept until the token expires,
+// allowed ids for ttl, a revocation on another instance is seen after at most ttl
+type denylistCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]denylistEntry
+	sweepAt int
+}
+
+type denylistEntry struct {
+	denied    bool
+	expiresAt time.Time
+}
+
+func newDenylistCache(ttl time.Duration) *denylistCache {
+	return &denylistCache{
+		ttl:     ttl,
+		entries: map[string]denylistEntry{},
+		sweepAt: denylistCacheMinSweep,
+	}
+}
+
+// get returns the cached state of the id, ok is false when it is not cached
+func (c *denylistCache) get(id string, now time.Time) (denied bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[id]
+	if !ok || now.After(e.expiresAt) {
+		return false, false
+	}
+	return e.denied, true
+}
+
+// allow caches the id as not denied for ttl
+func (c *denylistCache) allow(id string, now time.Time) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.set(id, denylistEntry{expiresAt: now.Add(c.ttl)}, now)
+}
+
+// deny caches the id as denied until expiresAt
+func (c *denylistCache) deny(id string, expiresAt, now time.Time) {
+	c.set(id, denylistEntry{denied: true, expiresAt: expiresAt}, now)
+}
+
+func (c *denylistCache) set(id string, e denylistEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[id] = e
+
+	if len(c.entries) < c.sweepAt {
+		return
+	}
+
+	for id, e := range c.entries {
+		if now.After(e.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+
+	c.sweepAt = 2 * len(c.entries)
+	if c.sweepAt < denylistCacheMinSweep {
+		c.sweepAt = denylistCacheMinSweep
+	}
+}
+
+// revokeUserSessions deletes every refresh token of the user and denies the
+// id tokens of its sessions for denyFor, the lifetime of id tokens.
+// It returns the denied session ids
+func revokeUserSessions(ctx context.Context, r model.TokenRepository, userID string, denyFor time.Duration) ([]string, error) {
+	sessions, err := r.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.DeleteUserRefreshToken(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	sids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		sids = append(sids, session.ID)
+	}
+
+	if err := r.DenyTokens(ctx, sids, denyFor); err != nil {
+		logger.Warn("unable to deny id tokens of uid: %s, err: %v", userID, err)
+		return nil, err
+	}
+
+	return sids, nil
+}
+
+// revokeOtherUserSessions is revokeUserSessions keeping the session keepSID signed in,
+// the refresh tokens of the other sessions are deleted one by one
+func revokeOtherUserSessions(ctx context.Context, r model.TokenRepository, userID, keepSID string, denyFor time.Duration) ([]string, error) {
+	sessions, err := r.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sids []string
+	for _, session := range sessions {
+		if session.ID == keepSID {
+			continue
+		}
+
+		// a token which expired or was rotated meanwhile is already gone
+		_, err := r.DeleteRefreshToken(ctx, userID, session.TokenID)
+		if err != nil && apperrors.Status(err) != http.StatusUnauthorized {
+			logger.Warn("error revoke session: %s, for uid: %s, error: %v", session.ID, userID, err)
+			return nil, err
+		}
+
+		if err == nil {
+			sids = append(sids, session.ID)
+		}
+	}
+
+	if err := r.DenyTokens(ctx, sids, denyFor); err != nil {
+		logger.Warn("unable to deny id tokens of uid: %s, err: %v", userID, err)
+		return nil, err
+	}
+
+	return sids, nil
+}
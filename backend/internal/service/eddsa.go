@@ -0,0 +1,50 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// signingMethodEdDSA signs tokens with Ed25519, https://www.rfc-editor.org/rfc/rfc8037#section-3.1.
+// jwt-go has no EdDSA method of its own
+var signingMethodEdDSA = &edDSASigningMethod{}
+
+type edDSASigningMethod struct{}
+
+func init() {
+	jwt.RegisterSigningMethod(signingMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return signingMethodEdDSA
+	})
+}
+
+func (m *edDSASigningMethod) Alg() string {
+	return "EdDSA"
+}
+
+func (m *edDSASigningMethod) Sign(signingString string, key interface{}) (string, error) {
+	k, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	return jwt.EncodeSegment(ed25519.Sign(k, []byte(signingString))), nil
+}
+
+func (m *edDSASigningMethod) Verify(signingString, signature string, key interface{}) error {
+	k, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(k, []byte(signingString), sig) {
+		return errors.New("eddsa signature is invalid")
+	}
+	return nil
+}
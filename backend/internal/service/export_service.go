@@ -0,0 +1,240 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	// exportTimeout bounds the generation of an archive, a pending export
+	// expires with it when the instance generating it goes away
+	exportTimeout = 5 * time.Minute
+	// exportFailedExpiration is how long a failed export is reported
+	// before the next request starts a new one
+	exportFailedExpiration = time.Minute
+)
+
+type exportService struct {
+	UserRepository          model.UserRepository
+	RoleRepository          model.RoleRepository
+	TokenRepository         model.TokenRepository
+	MFARepository           model.MFARepository
+	WebAuthnRepository      model.WebAuthnRepository
+	DataExportRepository    model.DataExportRepository
+	SecurityEventRepository model.SecurityEventRepository
+	Expiration              time.Duration
+}
+
+type ExportConfig struct {
+	UserRepository       model.UserRepository
+	RoleRepository       model.RoleRepository
+	TokenRepository      model.TokenRepository
+	MFARepository        model.MFARepository
+	WebAuthnRepository   model.WebAuthnRepository
+	DataExportRepository model.DataExportRepository
+	// SecurityEventRepository adds the login history and the audit events
+	SecurityEventRepository model.SecurityEventRepository
+	// ExpirationSecs is how long a ready archive can be downloaded
+	ExpirationSecs int64
+}
+
+func NewExportService(c *ExportConfig) model.ExportService {
+	return &exportService{
+		UserRepository:          c.UserRepository,
+		RoleRepository:          c.RoleRepository,
+		TokenRepository:         c.TokenRepository,
+		MFARepository:           c.MFARepository,
+		WebAuthnRepository:      c.WebAuthnRepository,
+		DataExportRepository:    c.DataExportRepository,
+		SecurityEventRepository: c.SecurityEventRepository,
+		Expiration:              time.Duration(c.ExpirationSecs) * time.Second,
+	}
+}
+
+// RequestExport returns the current export of the user, when there is none
+// a new one is started and its archive is generated in the background
+func (s *exportService) RequestExport(ctx context.Context, uid uuid.UUID) (*model.DataExport, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		logger.Warn("unable to generate data export id for uid: %s, err: %v", uid.String(), err)
+		return nil, apperrors.NewInternal()
+	}
+
+	e := &model.DataExport{
+		ID:        id.String(),
+		Status:    model.DataExportPending,
+		CreatedAt: time.Now(),
+	}
+
+	created, err := s.DataExportRepository.CreateExport(ctx, uid, e, exportTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if !created {
+		return s.DataExportRepository.GetExport(ctx, uid)
+	}
+
+	logger.Info("data export: %s requested by uid: %s", e.ID, uid.String())
+
+	// the request context ends with the response, the export is
+	// copied as the caller keeps using the returned one
+	generated := *e
+	go s.generate(context.Background(), uid, &generated)
+
+	return e, nil
+}
+
+// Archive returns the zip archive of a ready export of the user
+func (s *exportService) Archive(ctx context.Context, uid uuid.UUID, id string) ([]byte, error) {
+	return s.DataExportRepository.GetArchive(ctx, uid, id)
+}
+
+// generate builds the archive of the export and stores it with the export set ready,
+// or sets the export failed
+func (s *exportService) generate(ctx context.Context, uid uuid.UUID, e *model.DataExport) {
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	archive, err := s.archive(ctx, uid)
+	if err != nil {
+		logger.Error("unable to generate data export: %s of uid: %s, err: %v", e.ID, uid.String(), err)
+		e.Status = model.DataExportFailed
+		if err := s.DataExportRepository.SetExport(ctx, uid, e, exportFailedExpiration); err != nil {
+			logger.Warn("unable to set data export: %s failed, err: %v", e.ID, err)
+		}
+		return
+	}
+
+	expiresAt := time.Now().Add(s.Expiration)
+	e.Status = model.DataExportReady
+	e.ExpiresAt = &expiresAt
+
+	if err := s.DataExportRepository.SetArchive(ctx, uid, e, archive, s.Expiration); err != nil {
+		logger.Error("unable to store data export: %s of uid: %s, err: %v", e.ID, uid.String(), err)
+		return
+	}
+
+	logger.Info("data export: %s of uid: %s ready, %d bytes", e.ID, uid.String(), len(archive))
+}
+
+type exportedCredential struct {
+	ID        string `json:"id"`
+	SignCount int64  `json:"signCount"`
+}
+
+type exportedMFA struct {
+	TOTPEnabled bool `json:"totpEnabled"`
+}
+
+// archive is a zip of json files with everything held about the user.
+// Password hashes, totp secrets and public keys are left out
+func (s *exportService) archive(ctx context.Context, uid uuid.UUID) ([]byte, error) {
+	u, err := s.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.RoleRepository != nil {
+		roles, err := s.RoleRepository.FindByUser(ctx, uid)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range roles {
+			u.Roles = append(u.Roles, r.Name)
+		}
+	}
+
+	sessions, err := s.TokenRepository.ListSessions(ctx, uid.String())
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := []exportedCredential{}
+	if s.WebAuthnRepository != nil {
+		found, err := s.WebAuthnRepository.FindByUID(ctx, uid)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range found {
+			credentials = append(credentials, exportedCredential{ID: c.ID, SignCount: c.SignCount})
+		}
+	}
+
+	var mfa exportedMFA
+	if s.MFARepository != nil {
+		t, err := s.MFARepository.FindTOTP(ctx, uid)
+		if err != nil && apperrors.Status(err) != http.StatusNotFound {
+			return nil, err
+		}
+		mfa.TOTPEnabled = err == nil && t.Confirmed
+	}
+
+	logins := []*model.SecurityEvent{}
+	events := []*model.SecurityEvent{}
+	if s.SecurityEventRepository != nil {
+		found, err := s.SecurityEventRepository.FindByUID(ctx, uid)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range found {
+			if e.Signin() {
+				logins = append(logins, e)
+			} else {
+				events = append(events, e)
+			}
+		}
+	}
+
+	if sessions == nil {
+		sessions = []*model.Session{}
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"user.json", u},
+		{"sessions.json", sessions},
+		{"webauthn_credentials.json", credentials},
+		{"mfa.json", mfa},
+		{"login_history.json", logins},
+		{"audit_events.json", events},
+	}
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, f := range files {
+		data, err := json.MarshalIndent(f.data, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRequestExport(t *testing.T) {
+	uid, _ := uuid.NewRandom()
+
+	t.Run("Returns the current export", func(t *testing.T) {
+		current := &model.DataExport{ID: "export-id", Status: model.DataExportReady}
+		mockDataExportRepository := new(mocks.MockDataExportRepository)
+		mockDataExportRepository.On("CreateExport", mock.Anything, uid, mock.AnythingOfType("*model.DataExport"), exportTimeout).Return(false, nil)
+		mockDataExportRepository.On("GetExport", mock.Anything, uid).Return(current, nil)
+
+		es := NewExportService(&ExportConfig{
+			DataExportRepository: mockDataExportRepository,
+		})
+
+		e, err := es.RequestExport(context.TODO(), uid)
+
+		assert.NoError(t, err)
+		assert.Equal(t, current, e)
+		mockDataExportRepository.AssertExpectations(t)
+	})
+
+	t.Run("Starts a new export", func(t *testing.T) {
+		done := make(chan struct{})
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockUserRepository.On("FindByID", mock.Anything, uid).Return(nil, apperrors.NewInternal())
+		mockDataExportRepository := new(mocks.MockDataExportRepository)
+		mockDataExportRepository.On("CreateExport", mock.Anything, uid, mock.AnythingOfType("*model.DataExport"), exportTimeout).Return(true, nil)
+		mockDataExportRepository.
+			On("SetExport", mock.Anything, uid, mock.AnythingOfType("*model.DataExport"), exportFailedExpiration).
+			Run(func(mock.Arguments) { close(done) }).
+			Return(nil)
+
+		es := NewExportService(&ExportConfig{
+			UserRepository:       mockUserRepository,
+			DataExportRepository: mockDataExportRepository,
+		})
+
+		e, err := es.RequestExport(context.TODO(), uid)
+
+		assert.NoError(t, err)
+		assert.Equal(t, model.DataExportPending, e.Status)
+		assert.NotEmpty(t, e.ID)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("export was not generated")
+		}
+		mockDataExportRepository.AssertExpectations(t)
+
+		// the generation sets its own copy failed, run with -race
+		assert.Equal(t, model.DataExportPending, e.Status)
+	})
+}
+
+func TestExportArchive(t *testing.T) {
+	uid, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com", Password: "hashed-password", Name: "Bob"}
+
+	mockUserRepository := new(mocks.MockUserRepository)
+	mockUserRepository.On("FindByID", mock.Anything, uid).Return(u, nil)
+	mockRoleRepository := new(mocks.MockRoleRepository)
+	mockRoleRepository.On("FindByUser", mock.Anything, uid).Return([]*model.Role{{Name: model.RoleAdmin}}, nil)
+	mockTokenRepository := new(mocks.MockTokenRepository)
+	mockTokenRepository.On("ListSessions", mock.Anything, uid.String()).Return([]*model.Session{{ID: "session-id", IP: "127.0.0.1"}}, nil)
+	mockMFARepository := new(mocks.MockMFARepository)
+	mockMFARepository.On("FindTOTP", mock.Anything, uid).Return(&model.TOTP{UID: uid, Secret: "totp-secret", Confirmed: true}, nil)
+	mockWebAuthnRepository := new(mocks.MockWebAuthnRepository)
+	mockWebAuthnRepository.On("FindByUID", mock.Anything, uid).Return([]*model.WebAuthnCredential{{ID: "credential-id", PublicKey: []byte("public-key"), SignCount: 3}}, nil)
+	mockSecurityEventRepository := new(mocks.MockSecurityEventRepository)
+	mockSecurityEventRepository.On("FindByUID", mock.Anything, uid).Return([]*model.SecurityEvent{
+		{UID: uid, Type: model.EventSignin, IP: "127.0.0.1"},
+		{UID: uid, Type: model.EventSigninFailed, IP: "10.0.0.1"},
+		{UID: uid, Type: model.EventPasswordChanged},
+	}, nil)
+
+	es := &exportService{
+		UserRepository:          mockUserRepository,
+		RoleRepository:          mockRoleRepository,
+		TokenRepository:         mockTokenRepository,
+		MFARepository:           mockMFARepository,
+		WebAuthnRepository:      mockWebAuthnRepository,
+		SecurityEventRepository: mockSecurityEventRepository,
+	}
+
+	archive, err := es.archive(context.TODO(), uid)
+	assert.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	assert.NoError(t, err)
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		assert.NoError(t, err)
+		data, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		r.Close()
+		files[f.Name] = string(data)
+	}
+
+	assert.Len(t, files, 6)
+
+	var exported map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(files["user.json"]), &exported))
+	assert.Equal(t, "bob@bob.com", exported["email"])
+	assert.Equal(t, []interface{}{model.RoleAdmin}, exported["roles"])
+	assert.NotContains(t, files["user.json"], "hashed-password")
+
+	assert.Contains(t, files["sessions.json"], `"id": "session-id"`)
+	assert.Contains(t, files["webauthn_credentials.json"], `"id": "credential-id"`)
+	assert.NotContains(t, files["webauthn_credentials.json"], "publicKey")
+	assert.Contains(t, files["mfa.json"], `"totpEnabled": true`)
+	assert.NotContains(t, files["mfa.json"], "totp-secret")
+
+	var logins, events []map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(files["login_history.json"]), &logins))
+	assert.NoError(t, json.Unmarshal([]byte(files["audit_events.json"]), &events))
+	assert.Len(t, logins, 2)
+	assert.Equal(t, model.EventSignin, logins[0]["type"])
+	assert.Equal(t, "10.0.0.1", logins[1]["ip"])
+	assert.Len(t, events, 1)
+	assert.Equal(t, model.EventPasswordChanged, events[0]["type"])
+	assert.NotContains(t, files["audit_events.json"], uid.String())
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// keyRing holds the active id token signing key and the public keys
+// of retired signing keys, which still verify tokens signed before rotation
+type keyRing struct {
+	activeKID  string
+	privKey    crypto.PrivateKey
+	method     jwt.SigningMethod
+	verifyKeys map[string]*verifyKey
+	// order of kids in the jwks, the active key first
+	kids []string
+}
+
+// verifyKey is a public key and the only algorithm tokens signed by it may use
+type verifyKey struct {
+	key    crypto.PublicKey
+	method jwt.SigningMethod
+}
+
+// newKeyRing skips invalid keys, without a signing key no id token can be signed
+func newKeyRing(privKey crypto.PrivateKey, pubKey crypto.PublicKey, retired []crypto.PublicKey) *keyRing {
+	// a nil key pointer is not a nil interface, it is dropped before it is used
+	if nilKey(privKey) {
+		privKey = nil
+	}
+	if nilKey(pubKey) {
+		pubKey = nil
+	}
+
+	kr := &keyRing{
+		privKey:    privKey,
+		verifyKeys: map[string]*verifyKey{},
+	}
+
+	if signer, ok := privKey.(crypto.Signer); ok && pubKey == nil {
+		pubKey = signer.Public()
+	}
+
+	if privKey == nil {
+		logger.Warn("no id token signing key, id tokens can not be signed")
+	}
+
+	if pubKey != nil {
+		vk, err := kr.add(pubKey)
+		if err != nil {
+			logger.Warn("id token signing key is skipped: %v", err)
+		} else {
+			kr.activeKID = keyID(pubKey)
+			kr.method = vk.method
+		}
+	}
+
+	for _, k := range retired {
+		if _, err := kr.add(k); err != nil {
+			logger.Warn("id token verify key is skipped: %v", err)
+		}
+	}
+
+	return kr
+}
+
+func (kr *keyRing) add(k crypto.PublicKey) (*verifyKey, error) {
+	method, err := signingMethod(k)
+	if err != nil {
+		return nil, err
+	}
+
+	kid := keyID(k)
+	if vk, ok := kr.verifyKeys[kid]; ok {
+		return vk, nil
+	}
+
+	vk := &verifyKey{key: k, method: method}
+	kr.verifyKeys[kid] = vk
+	kr.kids = append(kr.kids, kid)
+	return vk, nil
+}
+
+// sign signs the claims with the active key, header is added to the jose header
+func (kr *keyRing) sign(claims jwt.Claims, header map[string]interface{}) (string, error) {
+	if kr.method == nil || kr.privKey == nil {
+		return "", fmt.Errorf("no signing key")
+	}
+
+	token := jwt.NewWithClaims(kr.method, claims)
+	for k, v := range header {
+		token.Header[k] = v
+	}
+	token.Header["kid"] = kr.activeKID
+
+	return token.SignedString(kr.privKey)
+}
+
+// keyFunc finds the key by kid. Tokens without kid were signed before kids
+// were stamped and are checked with the active key. The alg of the token must be
+// the algorithm of the key, so no token is verified by an algorithm it was not signed with
+func (kr *keyRing) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		kid = kr.activeKID
+	}
+
+	vk, ok := kr.verifyKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown token kid: %s", kid)
+	}
+
+	if t.Method == nil || t.Method.Alg() != vk.method.Alg() {
+		return nil, fmt.Errorf("token alg: %v does not match the key: %s", t.Header["alg"], kid)
+	}
+
+	return vk.key, nil
+}
+
+func (kr *keyRing) jwks() *model.JSONWebKeySet {
+	set := &model.JSONWebKeySet{Keys: make([]model.JSONWebKey, 0, len(kr.kids))}
+	for _, kid := range kr.kids {
+		vk := kr.verifyKeys[kid]
+
+		jwk := publicJWK(vk.key)
+		jwk.Use = "sig"
+		jwk.Alg = vk.method.Alg()
+		jwk.Kid = kid
+
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// signingMethod is the jwt algorithm of the key type
+func signingMethod(k crypto.PublicKey) (jwt.SigningMethod, error) {
+	if nilKey(k) {
+		return nil, fmt.Errorf("public key is nil: %T", k)
+	}
+
+	switch k := k.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ecdsa curve: %s, only P-256 is supported", k.Curve.Params().Name)
+		}
+		return jwt.SigningMethodES256, nil
+	case ed25519.PublicKey:
+		if len(k) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("ed25519 public key has invalid size: %d", len(k))
+		}
+		return signingMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported key type: %T", k)
+}
+
+// nilKey reports whether the key is nil, also when it is a nil pointer
+// of a key type, which passes a != nil check of the interface
+func nilKey(k interface{}) bool {
+	switch k := k.(type) {
+	case nil:
+		return true
+	case *rsa.PublicKey:
+		return k == nil || k.N == nil
+	case *rsa.PrivateKey:
+		return k == nil || k.N == nil
+	case *ecdsa.PublicKey:
+		return k == nil || k.Curve == nil || k.X == nil || k.Y == nil
+	case *ecdsa.PrivateKey:
+		return k == nil || k.Curve == nil || k.X == nil || k.Y == nil || k.D == nil
+	case ed25519.PublicKey:
+		return len(k) == 0
+	case ed25519.PrivateKey:
+		// Public slices the key, a short key would panic
+		return len(k) != ed25519.PrivateKeySize
+	}
+	return false
+}
+
+// publicJWK is the key type specific members of the key, https://www.rfc-editor.org/rfc/rfc7518#section-6
+// and https://www.rfc-editor.org/rfc/rfc8037#section-2
+func publicJWK(k crypto.PublicKey) model.JSONWebKey {
+	switch k := k.(type) {
+	case *rsa.PublicKey:
+		return model.JSONWebKey{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return model.JSONWebKey{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X:   base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, size))),
+			Y:   base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, size))),
+		}
+	case ed25519.PublicKey:
+		return model.JSONWebKey{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(k),
+		}
+	}
+	return model.JSONWebKey{}
+}
+
+// keyID is the JWK thumbprint of the key, https://www.rfc-editor.org/rfc/rfc7638
+func keyID(k crypto.PublicKey) string {
+	jwk := publicJWK(k)
+
+	// required members in lexicographic order, as required for the thumbprint
+	var b []byte
+	switch jwk.Kty {
+	case "RSA":
+		b, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N})
+	case "EC":
+		b, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y})
+	default:
+		b, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X})
+	}
+
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ParsePrivateKeyPEM parses an RSA, P-256 or Ed25519 private key,
+// the key type decides the signing algorithm of id tokens
+func ParsePrivateKeyPEM(b []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block found")
+	}
+
+	var key crypto.PrivateKey
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type: %T", key)
+	}
+
+	if _, err := signingMethod(signer.Public()); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// ParsePublicKeyPEM parses an RSA, P-256 or Ed25519 public key
+func ParsePublicKeyPEM(b []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block found")
+	}
+
+	var key crypto.PublicKey
+	var err error
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := signingMethod(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
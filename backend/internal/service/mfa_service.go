@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	recoveryCodesCount = 10
+	maxMFAAttempts     = 5
+)
+
+type mfaService struct {
+	MFARepository           model.MFARepository
+	TokenRepository         model.TokenRepository
+	Issuer                  string
+	SecretKey               []byte
+	ChallengeExpiration     time.Duration
+	UserRepository          model.UserRepository
+	SigninLimiter           *signinLimiter
+	SecurityEventRepository model.SecurityEventRepository
+}
+
+type MFAConfig struct {
+	MFARepository   model.MFARepository
+	TokenRepository model.TokenRepository
+	// Issuer is shown next to the account in authenticator apps
+	Issuer string
+	// SecretKey is the 32 byte aes key used to encrypt totp secrets at rest
+	SecretKey               []byte
+	ChallengeExpirationSecs int64
+
+	// LoginAttemptRepository counts invalid codes as signin failures of the email
+	// and the ip, with the limits of USConfig. The failures of the email are reset
+	// when the challenge passed. UserRepository looks up the email of the challenge
+	UserRepository          model.UserRepository
+	LoginAttemptRepository  model.LoginAttemptRepository
+	SigninMaxFailures       int64
+	SigninIPMaxFailures     int64
+	SigninFailureWindowSecs int64
+	SigninLockoutSecs       int64
+
+	// SecurityEventRepository records enabled totp in the audit log, nil disables it
+	SecurityEventRepository model.SecurityEventRepository
+}
+
+func NewMFAService(c *MFAConfig) model.MFAService {
+	return &mfaService{
+		MFARepository:       c.MFARepository,
+		TokenRepository:     c.TokenRepository,
+		Issuer:              c.Issuer,
+		SecretKey:           c.SecretKey,
+		ChallengeExpiration: time.Duration(c.ChallengeExpirationSecs) * time.Second,
+		UserRepository:      c.UserRepository,
+		SigninLimiter: newSigninLimiter(c.LoginAttemptRepository, c.SigninMaxFailures, c.SigninIPMaxFailures,
+			c.SigninFailureWindowSecs, c.SigninLockoutSecs),
+		SecurityEventRepository: c.SecurityEventRepository,
+	}
+}
+
+// SetupTOTP generates a new unconfirmed totp secret and returns its otpauth uri
+func (s *mfaService) SetupTOTP(ctx context.Context, u *model.User) (string, error) {
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		logger.Warn("unable to generate totp secret for uid: %v, err: %v", u.UID, err)
+		return "", apperrors.NewInternal()
+	}
+
+	encrypted, err := encryptSecret(s.SecretKey, secret)
+	if err != nil {
+		logger.Warn("unable to encrypt totp secret for uid: %v, err: %v", u.UID, err)
+		return "", apperrors.NewInternal()
+	}
+
+	if err := s.MFARepository.SaveTOTP(ctx, &model.TOTP{UID: u.UID, Secret: encrypted}); err != nil {
+		return "", err
+	}
+
+	return totpURI(s.Issuer, u.Email, secret), nil
+}
+
+// ConfirmTOTP enables the totp by the first valid code and returns
+// new recovery codes, they are shown to the user only once
+func (s *mfaService) ConfirmTOTP(ctx context.Context, uid uuid.UUID, code string) ([]string, error) {
+	t, err := s.MFARepository.FindTOTP(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Confirmed {
+		return nil, apperrors.NewConflict("totp", uid.String())
+	}
+
+	if err := s.checkTOTP(ctx, t, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes(recoveryCodesCount)
+	if err != nil {
+		logger.Warn("unable to generate recovery codes for uid: %v, err: %v", uid, err)
+		return nil, apperrors.NewInternal()
+	}
+
+	if err := s.MFARepository.ConfirmTOTP(ctx, uid, hashes); err != nil {
+		return nil, err
+	}
+
+	recordEvent(ctx, s.SecurityEventRepository, uid, model.EventTOTPEnabled, nil)
+	return codes, nil
+}
+
+func (s *mfaService) Enabled(ctx context.Context, uid uuid.UUID) (bool, error) {
+	return totpEnabled(ctx, s.MFARepository, uid)
+}
+
+// totpEnabled reports whether the user confirmed a totp
+func totpEnabled(ctx context.Context, repo model.MFARepository, uid uuid.UUID) (bool, error) {
+	t, err := repo.FindTOTP(ctx, uid)
+	if err != nil {
+		var e *apperrors.Error
+		if errors.As(err, &e) && e.Type == apperrors.NotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return t.Confirmed, nil
+}
+
+// NewChallenge issues a short lived token which proves the first factor passed
+func (s *mfaService) NewChallenge(ctx context.Context, uid uuid.UUID) (string, error) {
+	token, tokenHash, err := generateOneTimeToken()
+	if err != nil {
+		logger.Warn("unable to generate mfa challenge for uid: %v, err: %v", uid, err)
+		return "", apperrors.NewInternal()
+	}
+
+	if err := s.TokenRepository.SetOneTimeToken(ctx, purposeMFAChallenge, tokenHash, uid.String(), s.ChallengeExpiration); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// VerifyChallenge checks a totp or recovery code for the challenge
+// and returns the uid of the user who passed both factors. Invalid codes
+// are signin failures of the user and of ip, the client address
+func (s *mfaService) VerifyChallenge(ctx context.Context, challenge, code, ip string) (uuid.UUID, error) {
+	errInvalidChallenge := apperrors.NewAuthorization("invalid or expired mfa token")
+	tokenHash := hashOneTimeToken(challenge)
+
+	userID, err := s.TokenRepository.GetOneTimeToken(ctx, purposeMFAChallenge, tokenHash)
+	if err != nil {
+		return uuid.Nil, errInvalidChallenge
+	}
+
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		logger.Warn("mfa challenge holds invalid uid: %s, err: %v", userID, err)
+		return uuid.Nil, errInvalidChallenge
+	}
+
+	now := time.Now()
+	var email string
+	if s.SigninLimiter != nil {
+		u, err := s.UserRepository.FindByID(ctx, uid)
+		if err != nil {
+			logger.Warn("user of mfa challenge not found, uid: %s, err: %v", userID, err)
+			return uuid.Nil, errInvalidChallenge
+		}
+
+		email = u.Email
+		if err := s.SigninLimiter.check(ctx, email, ip, now); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	attempts, err := s.TokenRepository.IncrOneTimeTokenAttempts(ctx, purposeMFAChallenge, tokenHash, s.ChallengeExpiration)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if attempts > maxMFAAttempts {
+		logger.Warn("too many mfa attempts for uid: %s", userID)
+		if _, err := s.TokenRepository.ConsumeOneTimeToken(ctx, purposeMFAChallenge, tokenHash); err != nil {
+			logger.Warn("unable to consume mfa challenge of uid: %s, err: %v", userID, err)
+		}
+		return uuid.Nil, errInvalidChallenge
+	}
+
+	if err := s.checkCode(ctx, uid, code); err != nil {
+		if s.SigninLimiter != nil && s.SigninLimiter.fail(ctx, email, ip, now) {
+			recordEvent(ctx, s.SecurityEventRepository, uid, model.EventAccountLocked, &model.SessionClient{IP: ip})
+		}
+		return uuid.Nil, err
+	}
+
+	// consume on success, so a challenge can not be used twice
+	if _, err := s.TokenRepository.ConsumeOneTimeToken(ctx, purposeMFAChallenge, tokenHash); err != nil {
+		return uuid.Nil, errInvalidChallenge
+	}
+
+	if s.SigninLimiter != nil {
+		s.SigninLimiter.succeed(ctx, email)
+	}
+
+	return uid, nil
+}
+
+func (s *mfaService) checkCode(ctx context.Context, uid uuid.UUID, code string) error {
+	t, err := s.MFARepository.FindTOTP(ctx, uid)
+	if err != nil || !t.Confirmed {
+		logger.Warn("mfa challenge for uid: %v without confirmed totp", uid)
+		return apperrors.NewAuthorization("invalid mfa code")
+	}
+
+	if len(code) == totpDigits {
+		return s.checkTOTP(ctx, t, code)
+	}
+
+	if err := s.MFARepository.UseRecoveryCode(ctx, uid, hashOneTimeToken(normalizeRecoveryCode(code))); err != nil {
+		logger.Warn("invalid recovery code for uid: %v", uid)
+		return apperrors.NewAuthorization("invalid mfa code")
+	}
+
+	return nil
+}
+
+func (s *mfaService) checkTOTP(ctx context.Context, t *model.TOTP, code string) error {
+	secret, err := decryptSecret(s.SecretKey, t.Secret)
+	if err != nil {
+		logger.Error("unable to decrypt totp secret for uid: %v, err: %v", t.UID, err)
+		return apperrors.NewInternal()
+	}
+
+	step, ok := validateTOTP(secret, code, time.Now(), t.LastUsedStep)
+	if !ok {
+		logger.Warn("invalid totp code for uid: %v", t.UID)
+		return apperrors.NewAuthorization("invalid mfa code")
+	}
+
+	return s.MFARepository.UpdateTOTPLastUsedStep(ctx, t.UID, step)
+}
+
+// generateRecoveryCodes returns codes formatted as xxxxx-xxxxx and their hashes
+func generateRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, 0, n)
+	hashes := make([]string, 0, n)
+
+	for i := 0; i < n; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+		codes = append(codes, fmt.Sprintf("%s-%s", raw[:5], raw[5:]))
+		hashes = append(hashes, hashOneTimeToken(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestVerifyChallenge(t *testing.T) {
+	key := make([]byte, 32)
+	secret, _ := generateTOTPSecret()
+	encrypted, _ := encryptSecret(key, secret)
+	challenge := "challenge-token"
+
+	t.Run("Success with totp code", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		mockMFARepository := new(mocks.MockMFARepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+
+		ms := NewMFAService(&MFAConfig{
+			MFARepository:   mockMFARepository,
+			TokenRepository: mockTokenRepository,
+			SecretKey:       key,
+		})
+
+		code, _ := totpCode(secret, time.Now().Unix()/totpPeriod)
+
+		mockTokenRepository.On("GetOneTimeToken", mock.Anything, purposeMFAChallenge, hashOneTimeToken(challenge)).Return(uid.String(), nil)
+		mockTokenRepository.On("IncrOneTimeTokenAttempts", mock.Anything, purposeMFAChallenge, hashOneTimeToken(challenge), mock.Anything).Return(int64(1), nil)
+		mockTokenRepository.On("ConsumeOneTimeToken", mock.Anything, purposeMFAChallenge, hashOneTimeToken(challenge)).Return(uid.String(), nil)
+		mockMFARepository.On("FindTOTP", mock.Anything, uid).Return(&model.TOTP{UID: uid, Secret: encrypted, Confirmed: true}, nil)
+		mockMFARepository.On("UpdateTOTPLastUsedStep", mock.Anything, uid, mock.AnythingOfType("int64")).Return(nil)
+
+		actual, err := ms.VerifyChallenge(context.TODO(), challenge, code, "10.0.0.1")
+
+		assert.NoError(t, err)
+		assert.Equal(t, uid, actual)
+		mockTokenRepository.AssertExpectations(t)
+		mockMFARepository.AssertExpectations(t)
+	})
+
+	t.Run("Success with recovery code", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		mockMFARepository := new(mocks.MockMFARepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+
+		ms := NewMFAService(&MFAConfig{
+			MFARepository:   mockMFARepository,
+			TokenRepository: mockTokenRepository,
+			SecretKey:       key,
+		})
+
+		codes, hashes, err := generateRecoveryCodes(1)
+		assert.NoError(t, err)
+
+		mockTokenRepository.On("GetOneTimeToken", mock.Anything, purposeMFAChallenge, mock.Anything).Return(uid.String(), nil)
+		mockTokenRepository.On("IncrOneTimeTokenAttempts", mock.Anything, purposeMFAChallenge, mock.Anything, mock.Anything).Return(int64(1), nil)
+		mockTokenRepository.On("ConsumeOneTimeToken", mock.Anything, purposeMFAChallenge, mock.Anything).Return(uid.String(), nil)
+		mockMFARepository.On("FindTOTP", mock.Anything, uid).Return(&model.TOTP{UID: uid, Secret: encrypted, Confirmed: true}, nil)
+		mockMFARepository.On("UseRecoveryCode", mock.Anything, uid, hashes[0]).Return(nil)
+
+		actual, err := ms.VerifyChallenge(context.TODO(), challenge, " "+codes[0]+" ", "10.0.0.1")
+
+		assert.NoError(t, err)
+		assert.Equal(t, uid, actual)
+		mockMFARepository.AssertExpectations(t)
+	})
+
+	t.Run("Too many attempts revokes the challenge", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		mockMFARepository := new(mocks.MockMFARepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+
+		ms := NewMFAService(&MFAConfig{
+			MFARepository:   mockMFARepository,
+			TokenRepository: mockTokenRepository,
+			SecretKey:       key,
+		})
+
+		mockTokenRepository.On("GetOneTimeToken", mock.Anything, purposeMFAChallenge, mock.Anything).Return(uid.String(), nil)
+		mockTokenRepository.On("IncrOneTimeTokenAttempts", mock.Anything, purposeMFAChallenge, mock.Anything, mock.Anything).Return(int64(maxMFAAttempts+1), nil)
+		mockTokenRepository.On("ConsumeOneTimeToken", mock.Anything, purposeMFAChallenge, mock.Anything).Return(uid.String(), nil)
+
+		_, err := ms.VerifyChallenge(context.TODO(), challenge, "123456", "10.0.0.1")
+
+		assert.Error(t, err)
+		mockTokenRepository.AssertCalled(t, "ConsumeOneTimeToken", mock.Anything, purposeMFAChallenge, mock.Anything)
+		mockMFARepository.AssertNotCalled(t, "FindTOTP", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Invalid codes are signin failures", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		mockMFARepository := new(mocks.MockMFARepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockLoginAttemptRepository := new(mocks.MockLoginAttemptRepository)
+
+		ms := NewMFAService(&MFAConfig{
+			MFARepository:           mockMFARepository,
+			TokenRepository:         mockTokenRepository,
+			SecretKey:               key,
+			UserRepository:          mockUserRepository,
+			LoginAttemptRepository:  mockLoginAttemptRepository,
+			SigninMaxFailures:       5,
+			SigninIPMaxFailures:     100,
+			SigninFailureWindowSecs: 900,
+			SigninLockoutSecs:       900,
+		})
+
+		mockTokenRepository.On("GetOneTimeToken", mock.Anything, purposeMFAChallenge, mock.Anything).Return(uid.String(), nil)
+		mockTokenRepository.On("IncrOneTimeTokenAttempts", mock.Anything, purposeMFAChallenge, mock.Anything, mock.Anything).Return(int64(1), nil)
+		mockUserRepository.On("FindByID", mock.Anything, uid).Return(&model.User{UID: uid, Email: "bob@bob.com"}, nil)
+		mockMFARepository.On("FindTOTP", mock.Anything, uid).Return(&model.TOTP{UID: uid, Secret: encrypted, Confirmed: true}, nil)
+		mockLoginAttemptRepository.On("LockedFor", mock.Anything, mock.AnythingOfType("string")).Return(time.Duration(0), nil)
+		mockLoginAttemptRepository.On("Failures", mock.Anything, "email:bob@bob.com", mock.AnythingOfType("time.Time"), 900*time.Second).
+			Return(int64(4), time.Now().Add(-time.Minute), nil)
+		mockLoginAttemptRepository.On("AddFailure", mock.Anything, "email:bob@bob.com", mock.AnythingOfType("time.Time"), 900*time.Second).Return(int64(5), nil)
+		mockLoginAttemptRepository.On("AddFailure", mock.Anything, "ip:10.0.0.1", mock.AnythingOfType("time.Time"), 900*time.Second).Return(int64(5), nil)
+		mockLoginAttemptRepository.On("Lock", mock.Anything, "email:bob@bob.com", 900*time.Second).Return(nil)
+
+		_, err := ms.VerifyChallenge(context.TODO(), challenge, "000000", "10.0.0.1")
+
+		assert.Error(t, err)
+		mockLoginAttemptRepository.AssertExpectations(t)
+		mockLoginAttemptRepository.AssertNotCalled(t, "ResetFailures", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Locked out email is refused before the code is checked", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		mockMFARepository := new(mocks.MockMFARepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockLoginAttemptRepository := new(mocks.MockLoginAttemptRepository)
+
+		ms := NewMFAService(&MFAConfig{
+			MFARepository:          mockMFARepository,
+			TokenRepository:        mockTokenRepository,
+			SecretKey:              key,
+			UserRepository:         mockUserRepository,
+			LoginAttemptRepository: mockLoginAttemptRepository,
+		})
+
+		mockTokenRepository.On("GetOneTimeToken", mock.Anything, purposeMFAChallenge, mock.Anything).Return(uid.String(), nil)
+		mockUserRepository.On("FindByID", mock.Anything, uid).Return(&model.User{UID: uid, Email: "bob@bob.com"}, nil)
+		mockLoginAttemptRepository.On("LockedFor", mock.Anything, "email:bob@bob.com").Return(time.Minute, nil)
+
+		_, err := ms.VerifyChallenge(context.TODO(), challenge, "000000", "10.0.0.1")
+
+		assert.Equal(t, http.StatusTooManyRequests, apperrors.Status(err))
+		mockMFARepository.AssertNotCalled(t, "FindTOTP", mock.Anything, mock.Anything)
+		mockTokenRepository.AssertNotCalled(t, "IncrOneTimeTokenAttempts", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
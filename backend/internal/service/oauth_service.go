@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// defaultScope is granted when the client does not ask for a scope
+const defaultScope = "openid"
+
+// pkceValue matches code verifiers and S256 challenges, https://www.rfc-editor.org/rfc/rfc7636#section-4.1
+var pkceValue = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+type oauthService struct {
+	OAuthClientRepository     model.OAuthClientRepository
+	ServiceAccountRepository  model.ServiceAccountRepository
+	TokenRepository           model.TokenRepository
+	AuthorizationCodeDuration time.Duration
+}
+
+type OAuthConfig struct {
+	OAuthClientRepository           model.OAuthClientRepository
+	ServiceAccountRepository        model.ServiceAccountRepository
+	TokenRepository                 model.TokenRepository
+	AuthorizationCodeExpirationSecs int64
+}
+
+func NewOAuthService(c *OAuthConfig) model.OAuthService {
+	return &oauthService{
+		OAuthClientRepository:     c.OAuthClientRepository,
+		ServiceAccountRepository:  c.ServiceAccountRepository,
+		TokenRepository:           c.TokenRepository,
+		AuthorizationCodeDuration: time.Duration(c.AuthorizationCodeExpirationSecs) * time.Second,
+	}
+}
+
+// ValidateClient checks the client and the redirect uri and returns the redirect uri to use.
+// Errors must not be sent to the redirect uri
+func (s *oauthService) ValidateClient(ctx context.Context, clientID, redirectURI string) (*model.OAuthClient, string, error) {
+	client, err := s.OAuthClientRepository.FindByID(ctx, clientID)
+	if err != nil {
+		return nil, "", apperrors.NewBadRequest("unknown client_id")
+	}
+
+	// a client with a single redirect uri may omit it
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		return client, client.RedirectURIs[0], nil
+	}
+
+	for _, uri := range client.RedirectURIs {
+		if uri == redirectURI {
+			return client, redirectURI, nil
+		}
+	}
+
+	logger.Warn("redirect uri: %s is not registered for client: %s", redirectURI, clientID)
+	return nil, "", apperrors.NewBadRequest("redirect_uri is not registered for the client")
+}
+
+// Consent validates the authorization request and returns the client and the scope
+// the user is asked to grant
+func (s *oauthService) Consent(ctx context.Context, r *model.AuthorizationRequest) (*model.Consent, error) {
+	client, _, err := s.ValidateClient(ctx, r.ClientID, r.RedirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.ResponseType != "code" {
+		return nil, apperrors.NewOAuth(apperrors.OAuthUnsupportedResponseType, "only response_type code is supported")
+	}
+
+	if r.CodeChallengeMethod != "S256" {
+		return nil, apperrors.NewOAuth(apperrors.OAuthInvalidRequest, "code_challenge_method must be S256")
+	}
+
+	if !pkceValue.MatchString(r.CodeChallenge) {
+		return nil, apperrors.NewOAuth(apperrors.OAuthInvalidRequest, "code_challenge is invalid")
+	}
+
+	scope, err := allowedScope(client.Scopes, r.Scope, defaultScope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Consent{Client: client, Scope: scope}, nil
+}
+
+// Authorize issues an authorization code for the signed in user once they consented
+func (s *oauthService) Authorize(ctx context.Context, uid uuid.UUID, r *model.AuthorizationRequest) (string, error) {
+	consent, err := s.Consent(ctx, r)
+	if err != nil {
+		return "", err
+	}
+	client, scope := consent.Client, consent.Scope
+
+	code, codeHash, err := generateOneTimeToken()
+	if err != nil {
+		logger.Warn("unable to generate authorization code for client: %s, err: %v", r.ClientID, err)
+		return "", apperrors.NewOAuth(apperrors.OAuthServerError, "unable to issue authorization code")
+	}
+
+	err = s.TokenRepository.SetAuthorizationCode(ctx, codeHash, &model.AuthorizationCode{
+		ClientID:      client.ID,
+		UID:           uid,
+		RedirectURI:   r.RedirectURI,
+		Scope:         scope,
+		CodeChallenge: r.CodeChallenge,
+	}, s.AuthorizationCodeDuration)
+	if err != nil {
+		return "", apperrors.NewOAuth(apperrors.OAuthServerError, "unable to issue authorization code")
+	}
+
+	return code, nil
+}
+
+// ExchangeCode consumes the authorization code after checking the client,
+// the redirect uri and the PKCE verifier
+func (s *oauthService) ExchangeCode(ctx context.Context, clientID, code, redirectURI, codeVerifier string) (*model.AuthorizationCode, error) {
+	errInvalidGrant := apperrors.NewOAuth(apperrors.OAuthInvalidGrant, "invalid or expired authorization code")
+
+	if !pkceValue.MatchString(codeVerifier) {
+		return nil, apperrors.NewOAuth(apperrors.OAuthInvalidRequest, "code_verifier is invalid")
+	}
+
+	// the code is consumed before the checks, a failed exchange burns it
+	ac, err := s.TokenRepository.ConsumeAuthorizationCode(ctx, hashOneTimeToken(code))
+	if err != nil {
+		if apperrors.Status(err) == http.StatusNotFound {
+			return nil, errInvalidGrant
+		}
+		return nil, apperrors.NewOAuth(apperrors.OAuthServerError, "unable to exchange authorization code")
+	}
+
+	if ac.ClientID != clientID {
+		logger.Warn("authorization code of client: %s exchanged by client: %s", ac.ClientID, clientID)
+		return nil, errInvalidGrant
+	}
+
+	if ac.RedirectURI != redirectURI {
+		logger.Warn("authorization code of client: %s exchanged with another redirect uri", clientID)
+		return nil, errInvalidGrant
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(challenge[:])), []byte(ac.CodeChallenge)) != 1 {
+		logger.Warn("code verifier mismatch for client: %s, uid: %v", clientID, ac.UID)
+		return nil, errInvalidGrant
+	}
+
+	return ac, nil
+}
+
+// Client returns the registered client
+func (s *oauthService) Client(ctx context.Context, clientID string) (*model.OAuthClient, error) {
+	client, err := s.OAuthClientRepository.FindByID(ctx, clientID)
+	if err != nil {
+		return nil, apperrors.NewOAuth(apperrors.OAuthInvalidClient, "unknown client_id")
+	}
+	return client, nil
+}
+
+// AuthenticateServiceAccount checks the client credentials of the service account
+// and returns the granted scope, all scopes of the account when none is requested
+func (s *oauthService) AuthenticateServiceAccount(ctx context.Context, clientID, secret, scope string) (*model.ServiceAccount, string, error) {
+	errInvalidClient := apperrors.NewOAuth(apperrors.OAuthInvalidClient, "invalid client credentials")
+
+	if clientID == "" || secret == "" {
+		return nil, "", errInvalidClient
+	}
+
+	sa, err := s.ServiceAccountRepository.FindByID(ctx, clientID)
+	if err != nil {
+		if apperrors.Status(err) == http.StatusNotFound {
+			return nil, "", errInvalidClient
+		}
+		return nil, "", apperrors.NewOAuth(apperrors.OAuthServerError, "unable to authenticate client")
+	}
+
+	match, err := comparePassword(sa.Secret, secret)
+	if err != nil {
+		logger.Warn("unable to verify secret of service account: %s, err: %v", clientID, err)
+		return nil, "", apperrors.NewOAuth(apperrors.OAuthServerError, "unable to authenticate client")
+	}
+
+	if !match {
+		logger.Warn("invalid secret of service account: %s", clientID)
+		return nil, "", errInvalidClient
+	}
+
+	granted, err := allowedScope(sa.Scopes, scope, strings.Join(sa.Scopes, " "))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return sa, granted, nil
+}
+
+// allowedScope checks the requested scope is allowed, fallback is granted
+// when no scope is requested
+func allowedScope(allowedScopes []string, requested, fallback string) (string, error) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		scopes = strings.Fields(fallback)
+	}
+
+	allowed := map[string]bool{}
+	for _, s := range allowedScopes {
+		allowed[s] = true
+	}
+
+	for _, s := range scopes {
+		if !allowed[s] {
+			return "", apperrors.NewOAuth(apperrors.OAuthInvalidScope, "scope is not allowed for the client: "+s)
+		}
+	}
+
+	return strings.Join(scopes, " "), nil
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestOAuthAuthorizationCode(t *testing.T) {
+	ctx := context.Background()
+	uid, _ := uuid.NewRandom()
+
+	client := &model.OAuthClient{
+		ID:           "spa",
+		Name:         "SPA",
+		RedirectURIs: []string{"https://app.malcorp.test/callback"},
+		Scopes:       []string{"openid", "email"},
+	}
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	newRequest := func() *model.AuthorizationRequest {
+		return &model.AuthorizationRequest{
+			ResponseType:        "code",
+			ClientID:            client.ID,
+			RedirectURI:         client.RedirectURIs[0],
+			Scope:               "openid email",
+			State:               "xyz",
+			CodeChallenge:       challenge,
+			CodeChallengeMethod: "S256",
+		}
+	}
+
+	// authorize stores the code in the mock, exchange consumes it
+	authorize := func(t *testing.T, s model.OAuthService, mockTokenRepository *mocks.MockTokenRepository) (string, *model.AuthorizationCode) {
+		var stored *model.AuthorizationCode
+		var storedHash string
+		mockTokenRepository.
+			On("SetAuthorizationCode", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("*model.AuthorizationCode"), mock.Anything).
+			Run(func(args mock.Arguments) {
+				storedHash = args.String(1)
+				stored = args.Get(2).(*model.AuthorizationCode)
+			}).
+			Return(nil).Once()
+
+		code, err := s.Authorize(ctx, uid, newRequest())
+		assert.NoError(t, err)
+		assert.Equal(t, hashOneTimeToken(code), storedHash)
+
+		mockTokenRepository.On("ConsumeAuthorizationCode", mock.Anything, storedHash).Return(stored, nil).Once()
+		return code, stored
+	}
+
+	newService := func() (model.OAuthService, *mocks.MockTokenRepository) {
+		mockClientRepository := new(mocks.MockOAuthClientRepository)
+		mockClientRepository.On("FindByID", mock.Anything, client.ID).Return(client, nil)
+		mockClientRepository.On("FindByID", mock.Anything, mock.Anything).Return(nil, apperrors.NewNotFound("client", "unknown"))
+		mockTokenRepository := new(mocks.MockTokenRepository)
+
+		return NewOAuthService(&OAuthConfig{
+			OAuthClientRepository:           mockClientRepository,
+			TokenRepository:                 mockTokenRepository,
+			AuthorizationCodeExpirationSecs: 60,
+		}), mockTokenRepository
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		s, mockTokenRepository := newService()
+		code, _ := authorize(t, s, mockTokenRepository)
+
+		ac, err := s.ExchangeCode(ctx, client.ID, code, client.RedirectURIs[0], verifier)
+		assert.NoError(t, err)
+		assert.Equal(t, uid, ac.UID)
+		assert.Equal(t, "openid email", ac.Scope)
+		mockTokenRepository.AssertExpectations(t)
+	})
+
+	t.Run("Wrong code verifier", func(t *testing.T) {
+		s, mockTokenRepository := newService()
+		code, _ := authorize(t, s, mockTokenRepository)
+
+		_, err := s.ExchangeCode(ctx, client.ID, code, client.RedirectURIs[0], "M25iVXpKU3puUjFaYWg3T1NDTDQtcW1ROUY5YXlwalNoc0hhakxifmZHag")
+		assert.Equal(t, apperrors.OAuthInvalidGrant, apperrors.AsOAuth(err).Code)
+	})
+
+	t.Run("Code of another client", func(t *testing.T) {
+		s, mockTokenRepository := newService()
+		code, _ := authorize(t, s, mockTokenRepository)
+
+		_, err := s.ExchangeCode(ctx, "other", code, client.RedirectURIs[0], verifier)
+		assert.Equal(t, apperrors.OAuthInvalidGrant, apperrors.AsOAuth(err).Code)
+	})
+
+	t.Run("Another redirect uri", func(t *testing.T) {
+		s, mockTokenRepository := newService()
+		code, _ := authorize(t, s, mockTokenRepository)
+
+		_, err := s.ExchangeCode(ctx, client.ID, code, "https://evil.test/callback", verifier)
+		assert.Equal(t, apperrors.OAuthInvalidGrant, apperrors.AsOAuth(err).Code)
+	})
+
+	t.Run("Used or expired code", func(t *testing.T) {
+		s, mockTokenRepository := newService()
+		mockTokenRepository.On("ConsumeAuthorizationCode", mock.Anything, hashOneTimeToken("used")).
+			Return(nil, apperrors.NewNotFound("authorization_code", "code"))
+
+		_, err := s.ExchangeCode(ctx, client.ID, "used", client.RedirectURIs[0], verifier)
+		assert.Equal(t, apperrors.OAuthInvalidGrant, apperrors.AsOAuth(err).Code)
+	})
+
+	t.Run("Unregistered redirect uri", func(t *testing.T) {
+		s, _ := newService()
+
+		r := newRequest()
+		r.RedirectURI = "https://evil.test/callback"
+
+		_, _, err := s.ValidateClient(ctx, r.ClientID, r.RedirectURI)
+		assert.Equal(t, apperrors.NewBadRequest("redirect_uri is not registered for the client"), err)
+	})
+
+	t.Run("Consent", func(t *testing.T) {
+		s, mockTokenRepository := newService()
+
+		consent, err := s.Consent(ctx, newRequest())
+		assert.NoError(t, err)
+		assert.Equal(t, client, consent.Client)
+		assert.Equal(t, "openid email", consent.Scope)
+		mockTokenRepository.AssertNotCalled(t, "SetAuthorizationCode", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Plain challenge method", func(t *testing.T) {
+		s, mockTokenRepository := newService()
+
+		r := newRequest()
+		r.CodeChallengeMethod = "plain"
+
+		_, err := s.Authorize(ctx, uid, r)
+		assert.Equal(t, apperrors.OAuthInvalidRequest, apperrors.AsOAuth(err).Code)
+		mockTokenRepository.AssertNotCalled(t, "SetAuthorizationCode", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Scope not allowed", func(t *testing.T) {
+		s, _ := newService()
+
+		r := newRequest()
+		r.Scope = "openid admin"
+
+		_, err := s.Authorize(ctx, uid, r)
+		assert.Equal(t, apperrors.OAuthInvalidScope, apperrors.AsOAuth(err).Code)
+	})
+}
+
+func TestAuthenticateServiceAccount(t *testing.T) {
+	ctx := context.Background()
+
+	secret := "s3cr3t-of-the-billing-job"
+	hashed, err := hashPassword(secret)
+	assert.NoError(t, err)
+
+	sa := &model.ServiceAccount{ID: "billing-job", Secret: hashed, Scopes: []string{"users:read", "users:write"}}
+
+	mockServiceAccountRepository := new(mocks.MockServiceAccountRepository)
+	mockServiceAccountRepository.On("FindByID", mock.Anything, "billing-job").Return(sa, nil)
+	mockServiceAccountRepository.On("FindByID", mock.Anything, "unknown").Return(nil, apperrors.NewNotFound("service_account", "unknown"))
+
+	s := NewOAuthService(&OAuthConfig{
+		ServiceAccountRepository: mockServiceAccountRepository,
+	})
+
+	t.Run("All scopes by default", func(t *testing.T) {
+		got, scope, err := s.AuthenticateServiceAccount(ctx, "billing-job", secret, "")
+		assert.NoError(t, err)
+		assert.Equal(t, sa, got)
+		assert.Equal(t, "users:read users:write", scope)
+	})
+
+	t.Run("Requested scope", func(t *testing.T) {
+		_, scope, err := s.AuthenticateServiceAccount(ctx, "billing-job", secret, "users:read")
+		assert.NoError(t, err)
+		assert.Equal(t, "users:read", scope)
+	})
+
+	t.Run("Scope not allowed", func(t *testing.T) {
+		_, _, err := s.AuthenticateServiceAccount(ctx, "billing-job", secret, "admin")
+		assert.Equal(t, apperrors.OAuthInvalidScope, apperrors.AsOAuth(err).Code)
+	})
+
+	t.Run("Wrong secret", func(t *testing.T) {
+		_, _, err := s.AuthenticateServiceAccount(ctx, "billing-job", "wrong", "")
+		assert.Equal(t, apperrors.OAuthInvalidClient, apperrors.AsOAuth(err).Code)
+	})
+
+	t.Run("Unknown client", func(t *testing.T) {
+		_, _, err := s.AuthenticateServiceAccount(ctx, "unknown", secret, "")
+		assert.Equal(t, apperrors.OAuthInvalidClient, apperrors.AsOAuth(err).Code)
+	})
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+)
+
+// reasons a password is refused, the tags of the invalidArgs
+const (
+	passwordMinLength     = "min_length"
+	passwordMaxLength     = "max_length"
+	passwordContainsEmail = "contains_email"
+	passwordWeak          = "weak"
+	passwordBreached      = "breached"
+)
+
+// passwordPolicy decides which passwords users can set. Zero values disable a rule
+type passwordPolicy struct {
+	minLength int
+	maxLength int
+	// minStrength is the lowest passwordStrength score, 0 to 4
+	minStrength int
+	breached    model.BreachedPasswordRepository
+}
+
+// check returns a BadRequest error with every rule the password breaks,
+// field is the request field of the password
+func (p *passwordPolicy) check(ctx context.Context, field, password, email string) error {
+	var args []apperrors.InvalidArgument
+
+	length := utf8.RuneCountInString(password)
+	if p.minLength > 0 && length < p.minLength {
+		args = append(args, apperrors.InvalidArgument{Field: field, Tag: passwordMinLength, Param: strconv.Itoa(p.minLength)})
+	}
+
+	if p.maxLength > 0 && length > p.maxLength {
+		args = append(args, apperrors.InvalidArgument{Field: field, Tag: passwordMaxLength, Param: strconv.Itoa(p.maxLength)})
+	}
+
+	if containsEmail(password, email) {
+		args = append(args, apperrors.InvalidArgument{Field: field, Tag: passwordContainsEmail})
+	}
+
+	if p.minStrength > 0 && passwordStrength(password) < p.minStrength {
+		args = append(args, apperrors.InvalidArgument{Field: field, Tag: passwordWeak, Param: strconv.Itoa(p.minStrength)})
+	}
+
+	if p.breached != nil {
+		breached, err := isBreachedPassword(ctx, p.breached, password)
+		if err != nil {
+			return err
+		}
+
+		if breached {
+			args = append(args, apperrors.InvalidArgument{Field: field, Tag: passwordBreached})
+		}
+	}
+
+	if len(args) > 0 {
+		return apperrors.NewInvalidArgs("password does not meet the password policy, see invalidArgs", args)
+	}
+	return nil
+}
+
+// containsEmail reports whether the password contains the email, ignoring case
+func containsEmail(password, email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	return email != "" && strings.Contains(strings.ToLower(password), email)
+}
+
+// passwordStrength scores the password from 0 (guessed at once) to 4 (very hard to guess),
+// like zxcvbn scores. The guesses are estimated from the character classes used and
+// the length, characters repeating the previous one or continuing a sequence
+// like abc or 321 do not count
+func passwordStrength(password string) int {
+	var lower, upper, digit, symbol, other bool
+	var length int
+	var prev rune
+	var step rune
+
+	for i, r := range password {
+		switch {
+		case unicode.IsLower(r) && r < unicode.MaxASCII:
+			lower = true
+		case unicode.IsUpper(r) && r < unicode.MaxASCII:
+			upper = true
+		case unicode.IsDigit(r) && r < unicode.MaxASCII:
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+
+		d := r - prev
+		switch {
+		case i > 0 && d == 0:
+		case i > 0 && (d == 1 || d == -1) && d == step:
+		default:
+			length++
+		}
+
+		if i > 0 {
+			step = d
+		}
+		prev = r
+	}
+
+	pool := 0
+	for _, c := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.used {
+			pool += c.size
+		}
+	}
+
+	if pool == 0 {
+		return 0
+	}
+
+	bits := float64(length) * math.Log2(float64(pool))
+	switch {
+	case bits < 28:
+		return 0
+	case bits < 36:
+		return 1
+	case bits < 60:
+		return 2
+	case bits < 80:
+		return 3
+	}
+	return 4
+}
+
+// isBreachedPassword looks the password up by k-anonymity, only the first
+// 5 hex characters of its sha1 hash select the range of breached hashes
+func isBreachedPassword(ctx context.Context, r model.BreachedPasswordRepository, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := r.FindRange(ctx, hash[:5])
+	if err != nil {
+		logger.Warn("unable to look up breached password range: %s, err: %v", hash[:5], err)
+		return false, apperrors.NewInternal()
+	}
+
+	return suffixes[hash[5:]] > 0, nil
+}
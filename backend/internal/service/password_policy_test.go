@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	ctx := context.TODO()
+	email := "bob@bob.com"
+
+	tags := func(err error) []string {
+		var tags []string
+		for _, arg := range apperrors.InvalidArgs(err) {
+			assert.Equal(t, "password", arg.Field)
+			tags = append(tags, arg.Tag)
+		}
+		return tags
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		p := &passwordPolicy{minLength: 8, maxLength: 128, minStrength: 2}
+
+		err := p.check(ctx, "password", "correct horse battery staple", email)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Length", func(t *testing.T) {
+		p := &passwordPolicy{minLength: 8, maxLength: 12}
+
+		err := p.check(ctx, "password", "short", email)
+		assert.Equal(t, apperrors.BadRequest, err.(*apperrors.Error).Type)
+		assert.Equal(t, []string{passwordMinLength}, tags(err))
+		assert.Equal(t, "8", apperrors.InvalidArgs(err)[0].Param)
+
+		err = p.check(ctx, "password", "much-too-long-password", email)
+		assert.Equal(t, []string{passwordMaxLength}, tags(err))
+
+		// length counts characters, not bytes
+		err = p.check(ctx, "password", "пароль12", email)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Contains email", func(t *testing.T) {
+		p := &passwordPolicy{}
+
+		err := p.check(ctx, "password", "my-BOB@bob.com-password", email)
+		assert.Equal(t, []string{passwordContainsEmail}, tags(err))
+	})
+
+	t.Run("Weak", func(t *testing.T) {
+		p := &passwordPolicy{minLength: 8, minStrength: 2}
+
+		err := p.check(ctx, "password", "abcdefghijkl", email)
+		assert.Equal(t, []string{passwordWeak}, tags(err))
+	})
+
+	t.Run("All rules are reported", func(t *testing.T) {
+		p := &passwordPolicy{minLength: 16, minStrength: 4}
+
+		err := p.check(ctx, "password", "bob@bob.com", email)
+		assert.Equal(t, []string{passwordMinLength, passwordContainsEmail, passwordWeak}, tags(err))
+	})
+
+	t.Run("Breached", func(t *testing.T) {
+		mockBreached := new(mocks.MockBreachedPasswordRepository)
+		p := &passwordPolicy{breached: mockBreached}
+
+		// sha1("password") is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+		mockBreached.On("FindRange", mock.Anything, "5BAA6").Return(map[string]int64{
+			"1E4C9B93F3F0682250B6CF8331B7EE68FD8": 9545824,
+		}, nil)
+
+		err := p.check(ctx, "password", "password", email)
+		assert.Equal(t, []string{passwordBreached}, tags(err))
+		mockBreached.AssertExpectations(t)
+	})
+
+	t.Run("Error -> breached lookup fails", func(t *testing.T) {
+		mockBreached := new(mocks.MockBreachedPasswordRepository)
+		p := &passwordPolicy{breached: mockBreached}
+
+		mockBreached.On("FindRange", mock.Anything, mock.AnythingOfType("string")).Return(nil, fmt.Errorf("some error"))
+
+		err := p.check(ctx, "password", "password", email)
+		assert.Equal(t, apperrors.Internal, err.(*apperrors.Error).Type)
+	})
+}
+
+func TestPasswordStrength(t *testing.T) {
+	cases := []struct {
+		password string
+		strength int
+	}{
+		{"", 0},
+		{"aaaaaaaaaaaaaaaa", 0},
+		{"123456789", 0},
+		{"bob", 0},
+		{"qwerty", 1},
+		{"monkey12", 2},
+		{"Tr0ub4dor&3", 3},
+		{"correct horse battery staple", 4},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.strength, passwordStrength(c.password), c.password)
+	}
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// recordEvent adds a security event of the user. The action is done already,
+// a failure to record it is logged and does not fail the action
+func recordEvent(ctx context.Context, repo model.SecurityEventRepository, uid uuid.UUID, typ string, client *model.SessionClient) {
+	if repo == nil {
+		return
+	}
+
+	e := &model.SecurityEvent{UID: uid, Type: typ, CreatedAt: time.Now()}
+	if client != nil {
+		e.IP = client.IP
+		e.UserAgent = client.UserAgent
+		e.ClientID = client.ClientID
+	}
+
+	if err := repo.Create(ctx, e); err != nil {
+		logger.Warn("unable to record security event: %s of uid: %s, err: %v", typ, uid.String(), err)
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+)
+
+const (
+	// signinDelayAfter is the failures of an email before its attempts are delayed,
+	// the delay doubles with every further failure up to signinDelayMax
+	signinDelayAfter = 2
+	signinDelayBase  = time.Second
+	signinDelayMax   = 30 * time.Second
+)
+
+// signinLimiter guards Signin against password guessing. Failures are counted in
+// a sliding window per email and per client ip. Attempts are refused while a key is
+// locked out or sooner than the delay after the last failure of the email, before
+// the password hash is computed
+type signinLimiter struct {
+	repo model.LoginAttemptRepository
+	// failures within window before the email or ip is locked out
+	maxFailures   int64
+	ipMaxFailures int64
+	window        time.Duration
+	lockout       time.Duration
+}
+
+// newSigninLimiter returns nil without a repository, signin is not limited then
+func newSigninLimiter(repo model.LoginAttemptRepository, maxFailures, ipMaxFailures, windowSecs, lockoutSecs int64) *signinLimiter {
+	if repo == nil {
+		return nil
+	}
+
+	return &signinLimiter{
+		repo:          repo,
+		maxFailures:   maxFailures,
+		ipMaxFailures: ipMaxFailures,
+		window:        time.Duration(windowSecs) * time.Second,
+		lockout:       time.Duration(lockoutSecs) * time.Second,
+	}
+}
+
+func signinEmailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func signinIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// check returns a TooManyRequests error when the attempt is not allowed yet
+func (l *signinLimiter) check(ctx context.Context, email, ip string, now time.Time) error {
+	keys := []string{signinEmailKey(email)}
+	if ip != "" {
+		keys = append(keys, signinIPKey(ip))
+	}
+
+	for _, key := range keys {
+		d, err := l.repo.LockedFor(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if d > 0 {
+			logger.Warn("signin refused, %s is locked out for: %v", key, d)
+			return apperrors.NewTooManyRequests("too many failed signin attempts, try again later", d)
+		}
+	}
+
+	failures, last, err := l.repo.Failures(ctx, signinEmailKey(email), now, l.window)
+	if err != nil {
+		return err
+	}
+
+	if wait := signinDelay(failures) - now.Sub(last); failures > 0 && wait > 0 {
+		logger.Warn("signin refused, email: %s has to wait: %v after %d failures", email, wait, failures)
+		return apperrors.NewTooManyRequests("too many failed signin attempts, try again later", wait)
+	}
+
+	return nil
+}
+
+// fail records a failed attempt and locks the email or ip out once its failures
+// within the window reach the maximum. It reports whether the email was locked out
+func (l *signinLimiter) fail(ctx context.Context, email, ip string, now time.Time) bool {
+	locked := l.addFailure(ctx, signinEmailKey(email), l.maxFailures, ip, now)
+	if ip != "" {
+		l.addFailure(ctx, signinIPKey(ip), l.ipMaxFailures, ip, now)
+	}
+	return locked
+}
+
+func (l *signinLimiter) addFailure(ctx context.Context, key string, max int64, ip string, now time.Time) bool {
+	failures, err := l.repo.AddFailure(ctx, key, now, l.window)
+	if err != nil {
+		logger.Warn("unable to record signin failure of: %s, err: %v", key, err)
+		return false
+	}
+
+	if max <= 0 || failures < max {
+		return false
+	}
+
+	if err := l.repo.Lock(ctx, key, l.lockout); err != nil {
+		logger.Warn("unable to lock out: %s, err: %v", key, err)
+		return false
+	}
+
+	logger.Error("security event: signin locked out: %s, failures: %d within: %v, locked for: %v, last ip: %s",
+		key, failures, l.window, l.lockout, ip)
+	return true
+}
+
+// succeed forgets the failures of the email, failures of the ip are kept,
+// a valid password of one account must not unlock guessing at others
+func (l *signinLimiter) succeed(ctx context.Context, email string) {
+	if err := l.repo.ResetFailures(ctx, signinEmailKey(email)); err != nil {
+		logger.Warn("unable to reset signin failures of email: %s, err: %v", email, err)
+	}
+}
+
+// signinDelay is the time an email has to wait after its last failure
+func signinDelay(failures int64) time.Duration {
+	if failures < signinDelayAfter {
+		return 0
+	}
+
+	d := signinDelayBase
+	for i := int64(signinDelayAfter); i < failures && d < signinDelayMax; i++ {
+		d *= 2
+	}
+
+	if d > signinDelayMax {
+		return signinDelayMax
+	}
+	return d
+}
@@ -2,7 +2,10 @@ package service
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto"
+	"net/http"
+	"sort"
+	"time"
 
 	"github.com/Kara4ev/go-web-tmp/internal/model"
 	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
@@ -11,100 +14,567 @@ import (
 )
 
 type tokenService struct {
-	TokenRepository       model.TokenRepository
-	PrivKey               *rsa.PrivateKey
-	PubKey                *rsa.PublicKey
-	RefreshSecret         string
-	IDExpirationSecs      int64
-	RefrashExpirationSecs int64
+	TokenRepository         model.TokenRepository
+	RoleRepository          model.RoleRepository
+	Keys                    *keyRing
+	Issuer                  string
+	Audience                string
+	RefreshSecret           string
+	IDExpirationSecs        int64
+	RefrashExpirationSecs   int64
+	Denylist                *denylistCache
+	OpaqueRefreshTokens     bool
+	SecurityEventRepository model.SecurityEventRepository
 }
 
 type TSConfig struct {
-	TokenRepository       model.TokenRepository
-	PrivKey               *rsa.PrivateKey
-	PubKey                *rsa.PublicKey
+	TokenRepository model.TokenRepository
+	// RoleRepository loads the roles of users into their id tokens,
+	// without it id tokens carry no roles
+	RoleRepository model.RoleRepository
+	// PrivKey is an RSA, P-256 or Ed25519 key, id tokens are signed
+	// with RS256, ES256 or EdDSA accordingly
+	PrivKey crypto.PrivateKey
+	PubKey  crypto.PublicKey
+	// RetiredPubKeys verify id tokens signed by previous signing keys
+	RetiredPubKeys []crypto.PublicKey
+	// Issuer and Audience are the iss and aud claims of id tokens
+	Issuer                string
+	Audience              string
 	RefreshSecret         string
 	IDExpirationSecs      int64
 	RefrashExpirationSecs int64
+
+	// DenylistCacheTTLSecs is how long an id token is known not to be revoked
+	// without asking redis, revocations on other instances are seen after it
+	DenylistCacheTTLSecs int64
+
+	// OpaqueRefreshTokens issues random refresh tokens looked up by their hash
+	// instead of jwt signed with RefreshSecret
+	OpaqueRefreshTokens bool
+
+	// SecurityEventRepository records new sessions in the login history, nil disables it
+	SecurityEventRepository model.SecurityEventRepository
 }
 
 func NewTokenService(c *TSConfig) model.TokenService {
 	return &tokenService{
-		TokenRepository:       c.TokenRepository,
-		PrivKey:               c.PrivKey,
-		PubKey:                c.PubKey,
-		RefreshSecret:         c.RefreshSecret,
-		IDExpirationSecs:      c.IDExpirationSecs,
-		RefrashExpirationSecs: c.RefrashExpirationSecs,
+		TokenRepository:         c.TokenRepository,
+		RoleRepository:          c.RoleRepository,
+		Keys:                    newKeyRing(c.PrivKey, c.PubKey, c.RetiredPubKeys),
+		Issuer:                  c.Issuer,
+		Audience:                c.Audience,
+		RefreshSecret:           c.RefreshSecret,
+		IDExpirationSecs:        c.IDExpirationSecs,
+		RefrashExpirationSecs:   c.RefrashExpirationSecs,
+		Denylist:                newDenylistCache(time.Duration(c.DenylistCacheTTLSecs) * time.Second),
+		OpaqueRefreshTokens:     c.OpaqueRefreshTokens,
+		SecurityEventRepository: c.SecurityEventRepository,
 	}
 }
 
-func (s *tokenService) NewPairFromUser(ctx context.Context, u *model.User, prevTokenID string) (*model.TokenPair, error) {
+// NewPairFromUser issues a token pair. With a prevTokenID the previous refresh
+// token is rotated and the pair stays in its session, otherwise a new session is started.
+// A session is a rotation family, presenting an already rotated token revokes the session
+func (s *tokenService) NewPairFromUser(ctx context.Context, u *model.User, prevTokenID string, client *model.SessionClient) (*model.TokenPair, error) {
+	now := time.Now()
+	session := &model.Session{CreatedAt: now}
+	if client == nil {
+		client = &model.SessionClient{}
+	}
+
+	// every way of signing in or refreshing ends here, tokens are only issued to active accounts
+	if !u.Active() {
+		logger.Warn("tokens requested for account with status: %s, uid: %v", u.Status, u.UID)
+		return nil, apperrors.NewForbidden("account is not active")
+	}
 
 	if prevTokenID != "" {
-		if err := s.TokenRepository.DeleteRefreshToken(ctx, u.UID.String(), prevTokenID); err != nil {
+		// refresh tokens are bound to the client they were issued to. The client is
+		// checked before the rotation, another client must not burn the token
+		current, err := s.TokenRepository.GetRefreshToken(ctx, u.UID.String(), prevTokenID)
+		if err != nil && apperrors.Status(err) != http.StatusUnauthorized {
+			return nil, err
+		}
+
+		if current != nil && current.ClientID != client.ClientID {
+			logger.Warn("refresh token of client: %q presented by client: %q, uid: %v", current.ClientID, client.ClientID, u.UID)
+			return nil, apperrors.NewAuthorization("refresh token was issued to another client")
+		}
+
+		prev, reused, err := s.TokenRepository.RotateRefreshToken(ctx, u.UID.String(), prevTokenID, time.Duration(s.RefrashExpirationSecs)*time.Second)
+		if err != nil {
 			logger.Warn("error delete repository prev token: %v, for uid: %v, error: %v", prevTokenID, u.UID, err.Error())
 			return nil, err
 		}
+
+		if reused {
+			logger.Error("security event: reuse of rotated refresh token: %s, uid: %v, session: %s, ip: %s, user agent: %s",
+				prevTokenID, u.UID, prev.ID, client.IP, client.UserAgent)
+
+			if err := s.RevokeSession(ctx, u.UID, prev.ID); err != nil && apperrors.Status(err) != http.StatusNotFound {
+				return nil, err
+			}
+			return nil, apperrors.NewAuthorization("refresh token was already used, the session is revoked")
+		}
+
+		session.ID = prev.ID
+		if !prev.CreatedAt.IsZero() {
+			session.CreatedAt = prev.CreatedAt
+		}
 	}
 
-	idToken, err := generateIDToken(u, s.PrivKey, s.IDExpirationSecs)
+	if session.ID == "" {
+		sid, err := uuid.NewRandom()
+		if err != nil {
+			logger.Warn("error generating session id for uid: %v, error: %v", u.UID, err.Error())
+			return nil, apperrors.NewInternal()
+		}
+		session.ID = sid.String()
+	}
+
+	session.LastRefreshedAt = now
+	session.UserAgent = client.UserAgent
+	session.IP = client.IP
+	session.ClientID = client.ClientID
+
+	u, err := s.withRoles(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := generateIDToken(u, session.ID, client.ClientID, s.Issuer, s.Audience, s.Keys, s.IDExpirationSecs)
 
 	if err != nil {
 		logger.Warn("error generating id token for uid: %v, error: %v", u.UID, err.Error())
 		return nil, apperrors.NewInternal()
 	}
 
-	refreshToken, err := generateRefrashToken(u.UID, s.RefreshSecret, s.RefrashExpirationSecs)
+	var refreshToken *refreshTokenData
+	if s.OpaqueRefreshTokens {
+		refreshToken, err = generateOpaqueRefreshToken(s.RefrashExpirationSecs)
+	} else {
+		refreshToken, err = generateRefrashToken(u.UID, s.RefreshSecret, s.RefrashExpirationSecs)
+	}
 
 	if err != nil {
 		logger.Warn("error generating refresh token for uid: %v, error: %v", u.UID, err.Error())
 		return nil, apperrors.NewInternal()
 	}
 
-	if err := s.TokenRepository.SetRefreshToken(ctx, u.UID.String(), refreshToken.ID.String(), refreshToken.ExpiresIn); err != nil {
+	if refreshToken.Hash != "" {
+		err := s.TokenRepository.SetOpaqueRefreshToken(ctx, refreshToken.Hash, &model.OpaqueRefreshToken{
+			UID:       u.UID,
+			SessionID: session.ID,
+			IssuedAt:  now,
+			ExpiresAt: now.Add(refreshToken.ExpiresIn),
+		}, refreshToken.ExpiresIn)
+		if err != nil {
+			logger.Warn("error set repository opaque refresh token: %v, for uid: %v, error: %v", refreshToken.ID, u.UID, err.Error())
+			return nil, apperrors.NewInternal()
+		}
+	}
+
+	if err := s.TokenRepository.SetRefreshToken(ctx, u.UID.String(), refreshToken.ID.String(), session, refreshToken.ExpiresIn); err != nil {
 		logger.Warn("error set repository refresh token: %v,  for uid: %v, error: %v", refreshToken.ID, u.UID, err.Error())
 		return nil, apperrors.NewInternal()
 	}
 
+	// a new session is a signin of the login history, refreshes are not
+	if prevTokenID == "" {
+		recordEvent(ctx, s.SecurityEventRepository, u.UID, model.EventSignin, client)
+	}
+
 	return &model.TokenPair{
 		IDToken:      model.IDToken{SS: idToken},
 		RefreshToken: model.RefreshToken{ID: refreshToken.ID, UID: u.UID, SS: refreshToken.SS},
 	}, nil
 }
 
-func (s *tokenService) ValidateIDToken(tokenString string) (*model.User, error) {
+// withRoles is a copy of the user with its current roles and their permissions,
+// roles are read on every issue so changes apply with the next refresh
+func (s *tokenService) withRoles(ctx context.Context, u *model.User) (*model.User, error) {
+	if s.RoleRepository == nil {
+		return u, nil
+	}
+
+	roles, err := s.RoleRepository.FindByUser(ctx, u.UID)
+	if err != nil {
+		logger.Warn("error getting roles for uid: %v, error: %v", u.UID, err)
+		return nil, apperrors.NewInternal()
+	}
+
+	withRoles := *u
+	withRoles.Roles = make([]string, 0, len(roles))
+	withRoles.Permissions = nil
+
+	granted := make(map[string]bool)
+	for _, r := range roles {
+		withRoles.Roles = append(withRoles.Roles, r.Name)
+		for _, p := range r.Permissions {
+			if !granted[p] {
+				granted[p] = true
+				withRoles.Permissions = append(withRoles.Permissions, p)
+			}
+		}
+	}
+	sort.Strings(withRoles.Permissions)
+
+	return &withRoles, nil
+}
+
+func (s *tokenService) ValidateIDToken(tokenString string) (*model.IDTokenClaims, error) {
+
+	claims, err := validateIDToken(tokenString, s.Keys, s.Issuer, s.Audience)
+	if err != nil {
+		logger.Warn("id token is invalid: %s, err: %v", tokenString, err)
+		return nil, apperrors.NewAuthorization("unable to veryfy user from id token")
+	}
 
-	claims, err := validateIDToken(tokenString, s.PubKey)
+	u, err := claims.user()
 	if err != nil {
 		logger.Warn("id token is invalid: %s, err: %v", tokenString, err)
 		return nil, apperrors.NewAuthorization("unable to veryfy user from id token")
 	}
 
-	return claims.User, nil
+	denied, err := s.isDenied(context.Background(), claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if denied {
+		logger.Warn("id token is revoked, jti: %s, session: %s, uid: %v", claims.Id, claims.SessionID, u.UID)
+		return nil, apperrors.NewAuthorization("unable to veryfy user from id token")
+	}
+
+	return &model.IDTokenClaims{
+		User:      u,
+		SessionID: claims.SessionID,
+		ClientID:  claims.AuthorizedParty,
+	}, nil
+}
+
+// NewAccessToken issues an access token to the service account
+// for the already granted scope
+func (s *tokenService) NewAccessToken(ctx context.Context, sa *model.ServiceAccount, scope string) (*model.AccessToken, error) {
+	ss, err := generateAccessToken(sa, scope, s.Issuer, s.Audience, s.Keys, s.IDExpirationSecs)
+	if err != nil {
+		logger.Warn("error generating access token for client: %s, error: %v", sa.ID, err.Error())
+		return nil, apperrors.NewInternal()
+	}
+
+	return &model.AccessToken{
+		SS:        ss,
+		Scope:     scope,
+		ExpiresIn: s.IDExpirationSecs,
+	}, nil
+}
+
+func (s *tokenService) ValidateAccessToken(tokenString string) (*model.ServicePrincipal, error) {
+	claims, err := validateAccessToken(tokenString, s.Keys, s.Issuer, s.Audience)
+	if err != nil {
+		logger.Warn("access token is invalid: %s, err: %v", tokenString, err)
+		return nil, apperrors.NewAuthorization("unable to veryfy service account from access token")
+	}
+
+	p, err := claims.principal()
+	if err != nil {
+		logger.Warn("access token is invalid: %s, err: %v", tokenString, err)
+		return nil, apperrors.NewAuthorization("unable to veryfy service account from access token")
+	}
+
+	return p, nil
 }
 
 func (s *tokenService) ValidateRefreshToken(tokenString string) (*model.RefreshToken, error) {
-	claims, err := validateRefreshToken(tokenString, s.RefreshSecret)
+	info, err := s.parseRefreshToken(context.Background(), tokenString)
+	if err != nil {
+		if apperrors.Status(err) == http.StatusUnauthorized {
+			return nil, apperrors.NewAuthorization("unable to veryfy user from id token")
+		}
+		return nil, err
+	}
+
+	return &model.RefreshToken{
+		ID:  info.ID,
+		SS:  tokenString,
+		UID: info.UID,
+	}, nil
+}
+
+// parseRefreshToken verifies a refresh token. Opaque tokens are looked up by their hash,
+// jwt refresh tokens issued before opaque tokens were enabled stay valid until they expire
+func (s *tokenService) parseRefreshToken(ctx context.Context, tokenString string) (*refreshTokenInfo, error) {
+	if s.OpaqueRefreshTokens && !isJWT(tokenString) {
+		hash := hashOneTimeToken(tokenString)
+
+		t, err := s.TokenRepository.GetOpaqueRefreshToken(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
 
+		return &refreshTokenInfo{
+			ID:        opaqueRefreshTokenID(hash),
+			UID:       t.UID,
+			IssuedAt:  t.IssuedAt.Unix(),
+			ExpiresAt: t.ExpiresAt.Unix(),
+		}, nil
+	}
+
+	claims, err := validateRefreshToken(tokenString, s.RefreshSecret)
 	if err != nil {
 		logger.Warn("refresh token is invalid: %s, err: %v", tokenString, err)
-		return nil, apperrors.NewAuthorization("unable to veryfy user from id token")
+		return nil, apperrors.NewAuthorization("invalid refresh token")
 	}
 
 	tokensUUID, err := uuid.Parse(claims.Id)
 	if err != nil {
 		logger.Warn("claims ID could not be parsed as uuid: %s, err: %v", claims.Id, err)
-		return nil, apperrors.NewAuthorization("unable to veryfy user from id token")
+		return nil, apperrors.NewAuthorization("invalid refresh token")
 	}
 
-	return &model.RefreshToken{
-		ID:  tokensUUID,
-		SS:  tokenString,
-		UID: claims.UID,
+	return &refreshTokenInfo{
+		ID:        tokensUUID,
+		UID:       claims.UID,
+		IssuedAt:  claims.IssuedAt,
+		ExpiresAt: claims.ExpiresAt,
 	}, nil
 }
 
+// Introspect returns the state of an id, access or refresh token. Invalid,
+// expired and revoked tokens are inactive, only failures of the store are errors
+func (s *tokenService) Introspect(ctx context.Context, tokenString string) (*model.TokenIntrospection, error) {
+	if claims, err := validateIDToken(tokenString, s.Keys, s.Issuer, s.Audience); err == nil {
+		if _, err := claims.user(); err == nil {
+			denied, err := s.isDenied(ctx, claims)
+			if err != nil {
+				return nil, err
+			}
+
+			if denied {
+				return &model.TokenIntrospection{}, nil
+			}
+
+			return &model.TokenIntrospection{
+				Active:   true,
+				Sub:      claims.Subject,
+				Exp:      claims.ExpiresAt,
+				Iat:      claims.IssuedAt,
+				ClientID: claims.AuthorizedParty,
+			}, nil
+		}
+	}
+
+	if claims, err := validateAccessToken(tokenString, s.Keys, s.Issuer, s.Audience); err == nil {
+		if _, err := claims.principal(); err == nil {
+			return &model.TokenIntrospection{
+				Active:   true,
+				Sub:      claims.Subject,
+				Exp:      claims.ExpiresAt,
+				Iat:      claims.IssuedAt,
+				Scope:    claims.Scope,
+				ClientID: claims.ClientID,
+			}, nil
+		}
+	}
+
+	info, err := s.parseRefreshToken(ctx, tokenString)
+	if err != nil {
+		if apperrors.Status(err) == http.StatusUnauthorized {
+			return &model.TokenIntrospection{}, nil
+		}
+		return nil, err
+	}
+
+	// a rotated or revoked refresh token is still a valid jwt
+	session, err := s.TokenRepository.GetRefreshToken(ctx, info.UID.String(), info.ID.String())
+	if err != nil {
+		if apperrors.Status(err) == http.StatusUnauthorized {
+			return &model.TokenIntrospection{}, nil
+		}
+		return nil, err
+	}
+
+	return &model.TokenIntrospection{
+		Active:   true,
+		Sub:      info.UID.String(),
+		Exp:      info.ExpiresAt,
+		Iat:      info.IssuedAt,
+		ClientID: session.ClientID,
+	}, nil
+}
+
+// RevokeRefreshToken deletes a single refresh token of the client, the other
+// sessions of the user are kept. Invalid and unknown tokens are ignored
+func (s *tokenService) RevokeRefreshToken(ctx context.Context, tokenString, clientID string) error {
+	info, err := s.parseRefreshToken(ctx, tokenString)
+	if err != nil {
+		if apperrors.Status(err) == http.StatusUnauthorized {
+			logger.Debug("revoke of invalid refresh token: %v", err)
+			return nil
+		}
+		return err
+	}
+
+	userID := info.UID.String()
+	tokenID := info.ID.String()
+
+	session, err := s.TokenRepository.GetRefreshToken(ctx, userID, tokenID)
+	if err != nil {
+		if apperrors.Status(err) == http.StatusUnauthorized {
+			return nil
+		}
+		return err
+	}
+
+	if session.ClientID != clientID {
+		logger.Warn("refresh token of client: %q revoked by client: %q, uid: %s", session.ClientID, clientID, userID)
+		return apperrors.NewOAuth(apperrors.OAuthUnauthorizedClient, "refresh token was issued to another client")
+	}
+
+	if _, err := s.TokenRepository.DeleteRefreshToken(ctx, userID, tokenID); err != nil && apperrors.Status(err) != http.StatusUnauthorized {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeIDToken adds the id token to the denylist until it expires. Invalid tokens are ignored
+func (s *tokenService) RevokeIDToken(ctx context.Context, tokenString string) error {
+	claims, err := validateIDToken(tokenString, s.Keys, s.Issuer, s.Audience)
+	if err != nil || claims.Id == "" {
+		logger.Debug("revoke of invalid id token: %v", err)
+		return nil
+	}
+
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if err := s.TokenRepository.DenyTokens(ctx, []string{claims.Id}, time.Until(expiresAt)); err != nil {
+		return err
+	}
+
+	s.Denylist.deny(claims.Id, expiresAt, time.Now())
+	return nil
+}
+
+// Signout deletes every refresh token of the user and revokes the id tokens of its sessions
 func (s *tokenService) Signout(ctx context.Context, uid uuid.UUID) error {
-	return s.TokenRepository.DeleteUserRefreshToken(ctx, uid.String())
+	sids, err := revokeUserSessions(ctx, s.TokenRepository, uid.String(), s.idExpiration())
+	if err != nil {
+		return err
+	}
+
+	s.denySessionsInCache(sids)
+	return nil
+}
+
+// JWKS returns the public keys of the id token signing keys
+func (s *tokenService) JWKS() *model.JSONWebKeySet {
+	return s.Keys.jwks()
+}
+
+// ListSessions returns the sessions of the user, the session
+// with currentSessionID is marked as current
+func (s *tokenService) ListSessions(ctx context.Context, uid uuid.UUID, currentSessionID string) ([]*model.Session, error) {
+	sessions, err := s.TokenRepository.ListSessions(ctx, uid.String())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = currentSessionID != "" && session.ID == currentSessionID
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastRefreshedAt.After(sessions[j].LastRefreshedAt)
+	})
+
+	return sessions, nil
+}
+
+// RevokeSession deletes the refresh token of a single session
+func (s *tokenService) RevokeSession(ctx context.Context, uid uuid.UUID, sessionID string) error {
+	sessions, err := s.TokenRepository.ListSessions(ctx, uid.String())
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID != sessionID {
+			continue
+		}
+
+		if _, err := s.TokenRepository.DeleteRefreshToken(ctx, uid.String(), session.TokenID); err != nil {
+			logger.Warn("error revoke session: %s, for uid: %v, error: %v", sessionID, uid, err)
+			return err
+		}
+		return s.denySessions(ctx, []string{sessionID})
+	}
+
+	return apperrors.NewNotFound("session", sessionID)
+}
+
+// RevokeOtherSessions deletes the refresh tokens of every session but the current one
+func (s *tokenService) RevokeOtherSessions(ctx context.Context, uid uuid.UUID, currentSessionID string) error {
+	sids, err := revokeOtherUserSessions(ctx, s.TokenRepository, uid.String(), currentSessionID, s.idExpiration())
+	if err != nil {
+		return err
+	}
+
+	s.denySessionsInCache(sids)
+	return nil
+}
+
+// idExpiration is the lifetime of id tokens, how long a revoked session stays in the denylist
+func (s *tokenService) idExpiration() time.Duration {
+	return time.Duration(s.IDExpirationSecs) * time.Second
+}
+
+// denySessions revokes the id tokens of the sessions
+func (s *tokenService) denySessions(ctx context.Context, sids []string) error {
+	if err := s.TokenRepository.DenyTokens(ctx, sids, s.idExpiration()); err != nil {
+		return err
+	}
+
+	s.denySessionsInCache(sids)
+	return nil
+}
+
+func (s *tokenService) denySessionsInCache(sids []string) {
+	now := time.Now()
+	for _, sid := range sids {
+		s.Denylist.deny(sid, now.Add(s.idExpiration()), now)
+	}
+}
+
+// isDenied checks the jti and the session of the id token against the denylist
+func (s *tokenService) isDenied(ctx context.Context, claims *idTokenCustomClaims) (bool, error) {
+	now := time.Now()
+
+	for _, id := range []string{claims.Id, claims.SessionID} {
+		if id == "" {
+			continue
+		}
+
+		denied, ok := s.Denylist.get(id, now)
+		if !ok {
+			var err error
+			denied, err = s.TokenRepository.IsTokenDenied(ctx, id)
+			if err != nil {
+				logger.Warn("unable to check the denylist for id token: %s, err: %v", claims.Id, err)
+				return false, err
+			}
+
+			if denied {
+				s.Denylist.deny(id, time.Unix(claims.ExpiresAt, 0), now)
+			} else {
+				s.Denylist.allow(id, now)
+			}
+		}
+
+		if denied {
+			return true, nil
+		}
+	}
+
+	return false, nil
 }
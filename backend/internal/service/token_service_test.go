@@ -2,12 +2,22 @@ package service
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
 	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
@@ -21,6 +31,8 @@ func TestNewPairFromUser(t *testing.T) {
 	pub, _ := ioutil.ReadFile("../../rsa_public_test.pem")
 	pubKey, _ := jwt.ParseRSAPublicKeyFromPEM(pub)
 	secret := "randomtexttextsecret"
+	issuer := "http://malcorp.test"
+	audience := "malcorp"
 	idExpirationSecs := int64(900)
 	RefrashExpirationSecs := int64(25920)
 
@@ -30,6 +42,8 @@ func TestNewPairFromUser(t *testing.T) {
 		TokenRepository:       mockTokenRepository,
 		PrivKey:               privKey,
 		PubKey:                pubKey,
+		Issuer:                issuer,
+		Audience:              audience,
 		RefreshSecret:         secret,
 		IDExpirationSecs:      idExpirationSecs,
 		RefrashExpirationSecs: RefrashExpirationSecs,
@@ -49,11 +63,14 @@ func TestNewPairFromUser(t *testing.T) {
 		Password: "current-password",
 	}
 	prevID := "a_previous_tokenID"
+	prevSession := &model.Session{ID: "a_session_id", CreatedAt: time.Now().Add(-time.Hour)}
+	client := &model.SessionClient{UserAgent: "Mozilla/5.0", IP: "10.0.0.1"}
 
 	setSuccessArguments := mock.Arguments{
 		mock.AnythingOfType("*context.emptyCtx"),
 		u.UID.String(),
 		mock.AnythingOfType("string"),
+		mock.AnythingOfType("*model.Session"),
 		mock.AnythingOfType("time.Duration"),
 	}
 
@@ -61,26 +78,29 @@ func TestNewPairFromUser(t *testing.T) {
 		mock.AnythingOfType("*context.emptyCtx"),
 		uidErrorCase.String(),
 		mock.AnythingOfType("string"),
+		mock.AnythingOfType("*model.Session"),
 		mock.AnythingOfType("time.Duration"),
 	}
 
-	deleteWithPrevIDArguments := mock.Arguments{
+	rotateWithPrevIDArguments := mock.Arguments{
 		mock.AnythingOfType("*context.emptyCtx"),
 		u.UID.String(),
 		prevID,
+		time.Duration(RefrashExpirationSecs) * time.Second,
 	}
 
 	mockTokenRepository.On("SetRefreshToken", setSuccessArguments...).Return(nil)
 	mockTokenRepository.On("SetRefreshToken", setErrorArguments...).Return(fmt.Errorf("error setting refresh token"))
-	mockTokenRepository.On("DeleteRefreshToken", deleteWithPrevIDArguments...).Return(nil)
+	mockTokenRepository.On("GetRefreshToken", mock.Anything, u.UID.String(), prevID).Return(prevSession, nil)
+	mockTokenRepository.On("RotateRefreshToken", rotateWithPrevIDArguments...).Return(prevSession, false, nil)
 
 	t.Run("Returns a token pair with proper values", func(t *testing.T) {
 		ctx := context.Background()
-		tokenPair, err := tokenService.NewPairFromUser(ctx, u, prevID)
+		tokenPair, err := tokenService.NewPairFromUser(ctx, u, prevID, client)
 		assert.NoError(t, err)
 
 		mockTokenRepository.AssertCalled(t, "SetRefreshToken", setSuccessArguments...)
-		mockTokenRepository.AssertCalled(t, "DeleteRefreshToken", deleteWithPrevIDArguments...)
+		mockTokenRepository.AssertCalled(t, "RotateRefreshToken", rotateWithPrevIDArguments...)
 
 		var s string
 		assert.IsType(t, s, tokenPair.IDToken.SS)
@@ -93,6 +113,9 @@ func TestNewPairFromUser(t *testing.T) {
 
 		assert.NoError(t, err)
 
+		claimsUser, err := idTokenClaims.user()
+		assert.NoError(t, err)
+
 		expectClams := []interface{}{
 			u.UID,
 			u.Email,
@@ -101,14 +124,25 @@ func TestNewPairFromUser(t *testing.T) {
 		}
 
 		actualClams := []interface{}{
-			idTokenClaims.User.UID,
-			idTokenClaims.User.Email,
-			idTokenClaims.User.Name,
-			idTokenClaims.User.ImageURL,
+			claimsUser.UID,
+			claimsUser.Email,
+			claimsUser.Name,
+			claimsUser.ImageURL,
 		}
 
 		assert.ElementsMatch(t, expectClams, actualClams)
-		assert.Empty(t, idTokenClaims.User.Password)
+		assert.Empty(t, claimsUser.Password)
+		assert.Equal(t, issuer, idTokenClaims.Issuer)
+		assert.Equal(t, audience, idTokenClaims.Audience)
+		assert.Equal(t, u.UID.String(), idTokenClaims.Subject)
+
+		// the rotated pair stays in the session of the previous token
+		assert.Equal(t, prevSession.ID, idTokenClaims.SessionID)
+		session := mockTokenRepository.Calls[len(mockTokenRepository.Calls)-1].Arguments.Get(3).(*model.Session)
+		assert.Equal(t, prevSession.ID, session.ID)
+		assert.Equal(t, prevSession.CreatedAt, session.CreatedAt)
+		assert.Equal(t, client.UserAgent, session.UserAgent)
+		assert.Equal(t, client.IP, session.IP)
 
 		expiresAt := time.Unix(idTokenClaims.StandardClaims.ExpiresAt, 0)
 		expectedExpiresAt := time.Now().Add(time.Duration(idExpirationSecs) * time.Second)
@@ -133,27 +167,839 @@ func TestNewPairFromUser(t *testing.T) {
 
 	t.Run("Error setting refresh token", func(t *testing.T) {
 		ctx := context.Background()
-		_, err := tokenService.NewPairFromUser(ctx, uErrorCase, "")
+		_, err := tokenService.NewPairFromUser(ctx, uErrorCase, "", client)
 		assert.Error(t, err) // should return an error
 
 		// SetRefreshToken should be called with setErrorArguments
 		mockTokenRepository.AssertCalled(t, "SetRefreshToken", setErrorArguments...)
-		// DeleteRefreshToken should not be since SetRefreshToken causes method to return
-		mockTokenRepository.AssertNotCalled(t, "DeleteRefreshToken")
+		// RotateRefreshToken should not be since SetRefreshToken causes method to return
+		mockTokenRepository.AssertNotCalled(t, "RotateRefreshToken")
 	})
 
 	t.Run("Empty string provided for prevID", func(t *testing.T) {
 		ctx := context.Background()
-		_, err := tokenService.NewPairFromUser(ctx, u, "")
+		_, err := tokenService.NewPairFromUser(ctx, u, "", client)
 		assert.NoError(t, err)
 
 		// SetRefreshToken should be called with setSuccessArguments
 		mockTokenRepository.AssertCalled(t, "SetRefreshToken", setSuccessArguments...)
-		// DeleteRefreshToken should not be called since prevID is ""
-		mockTokenRepository.AssertNotCalled(t, "DeleteRefreshToken")
+		// RotateRefreshToken should not be called since prevID is ""
+		mockTokenRepository.AssertNotCalled(t, "RotateRefreshToken")
+	})
+
+	t.Run("Refresh token of another client is not rotated", func(t *testing.T) {
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		tokenService := NewTokenService(&TSConfig{
+			TokenRepository:       mockTokenRepository,
+			PrivKey:               privKey,
+			PubKey:                pubKey,
+			RefreshSecret:         secret,
+			IDExpirationSecs:      idExpirationSecs,
+			RefrashExpirationSecs: RefrashExpirationSecs,
+		})
+
+		spaSession := &model.Session{ID: "spa-session", ClientID: "spa"}
+		mockTokenRepository.On("GetRefreshToken", mock.Anything, u.UID.String(), prevID).Return(spaSession, nil)
+		mockTokenRepository.On("RotateRefreshToken", mock.Anything, u.UID.String(), prevID, mock.Anything).Return(spaSession, false, nil)
+		mockTokenRepository.On("SetRefreshToken", mock.Anything, u.UID.String(), mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+		_, err := tokenService.NewPairFromUser(context.TODO(), u, prevID, &model.SessionClient{ClientID: "other-client"})
+		assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+		mockTokenRepository.AssertNotCalled(t, "RotateRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+		// the token is still usable by its client
+		tokenPair, err := tokenService.NewPairFromUser(context.TODO(), u, prevID, &model.SessionClient{ClientID: "spa"})
+		assert.NoError(t, err)
+		assert.NotNil(t, tokenPair)
+		mockTokenRepository.AssertCalled(t, "RotateRefreshToken", mock.Anything, u.UID.String(), prevID, mock.Anything)
+	})
+
+	t.Run("Inactive account", func(t *testing.T) {
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		tokenService := NewTokenService(&TSConfig{
+			TokenRepository:       mockTokenRepository,
+			PrivKey:               privKey,
+			PubKey:                pubKey,
+			RefreshSecret:         secret,
+			IDExpirationSecs:      idExpirationSecs,
+			RefrashExpirationSecs: RefrashExpirationSecs,
+		})
+
+		for _, status := range []string{model.UserStatusSuspended, model.UserStatusDeleted, model.UserStatusPendingVerification} {
+			inactive := &model.User{UID: uid, Email: u.Email, Status: status}
+
+			_, err := tokenService.NewPairFromUser(context.TODO(), inactive, "", client)
+			assert.Equal(t, http.StatusForbidden, apperrors.Status(err), status)
+
+			_, err = tokenService.NewPairFromUser(context.TODO(), inactive, prevID, client)
+			assert.Equal(t, http.StatusForbidden, apperrors.Status(err), status)
+		}
+
+		mockTokenRepository.AssertNotCalled(t, "RotateRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockTokenRepository.AssertNotCalled(t, "SetRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("New sessions are recorded in the login history", func(t *testing.T) {
+		mockSecurityEventRepository := new(mocks.MockSecurityEventRepository)
+		mockSecurityEventRepository.On("Create", mock.Anything, mock.MatchedBy(func(e *model.SecurityEvent) bool {
+			return e.UID == uid && e.Type == model.EventSignin && e.IP == client.IP && e.UserAgent == client.UserAgent
+		})).Return(nil)
+
+		tokenService := NewTokenService(&TSConfig{
+			TokenRepository:         mockTokenRepository,
+			PrivKey:                 privKey,
+			PubKey:                  pubKey,
+			RefreshSecret:           secret,
+			IDExpirationSecs:        idExpirationSecs,
+			RefrashExpirationSecs:   RefrashExpirationSecs,
+			SecurityEventRepository: mockSecurityEventRepository,
+		})
+
+		_, err := tokenService.NewPairFromUser(context.TODO(), u, "", client)
+		assert.NoError(t, err)
+
+		_, err = tokenService.NewPairFromUser(context.TODO(), u, prevID, client)
+		assert.NoError(t, err)
+
+		// the refresh is not a signin
+		mockSecurityEventRepository.AssertNumberOfCalls(t, "Create", 1)
+	})
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	uid, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com"}
+	family := &model.Session{ID: "stolen-session", TokenID: "rotated-token"}
+
+	mockTokenRepository := new(mocks.MockTokenRepository)
+	tokenService := NewTokenService(&TSConfig{
+		TokenRepository:       mockTokenRepository,
+		RefrashExpirationSecs: 3600,
+	})
+
+	mockTokenRepository.
+		On("GetRefreshToken", mock.Anything, uid.String(), "rotated-token").
+		Return(nil, apperrors.NewAuthorization("invalid refresh token"))
+	mockTokenRepository.
+		On("RotateRefreshToken", mock.Anything, uid.String(), "rotated-token", time.Hour).
+		Return(family, true, nil)
+	mockTokenRepository.
+		On("ListSessions", mock.Anything, uid.String()).
+		Return([]*model.Session{{ID: "stolen-session", TokenID: "attacker-token"}, {ID: "other", TokenID: "other-token"}}, nil)
+	mockTokenRepository.
+		On("DeleteRefreshToken", mock.Anything, uid.String(), "attacker-token").
+		Return(&model.Session{ID: "stolen-session"}, nil)
+	mockTokenRepository.
+		On("DenyTokens", mock.Anything, []string{"stolen-session"}, mock.AnythingOfType("time.Duration")).
+		Return(nil)
+
+	tokenPair, err := tokenService.NewPairFromUser(context.TODO(), u, "rotated-token", &model.SessionClient{IP: "10.0.0.9"})
+	assert.Nil(t, tokenPair)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+
+	// the whole family is revoked, other sessions are kept
+	mockTokenRepository.AssertCalled(t, "DeleteRefreshToken", mock.Anything, uid.String(), "attacker-token")
+	mockTokenRepository.AssertNotCalled(t, "DeleteRefreshToken", mock.Anything, uid.String(), "other-token")
+	mockTokenRepository.AssertCalled(t, "DenyTokens", mock.Anything, []string{"stolen-session"}, mock.AnythingOfType("time.Duration"))
+	mockTokenRepository.AssertNotCalled(t, "SetRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	uid, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com"}
+
+	mockTokenRepository := new(mocks.MockTokenRepository)
+	mockTokenRepository.
+		On("SetRefreshToken", mock.Anything, uid.String(), mock.AnythingOfType("string"), mock.AnythingOfType("*model.Session"), mock.AnythingOfType("time.Duration")).
+		Return(nil)
+	mockTokenRepository.On("IsTokenDenied", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+
+	before := NewTokenService(&TSConfig{
+		TokenRepository:  mockTokenRepository,
+		PrivKey:          oldKey,
+		PubKey:           &oldKey.PublicKey,
+		IDExpirationSecs: 900,
+	})
+
+	after := NewTokenService(&TSConfig{
+		TokenRepository:  mockTokenRepository,
+		PrivKey:          newKey,
+		PubKey:           &newKey.PublicKey,
+		RetiredPubKeys:   []crypto.PublicKey{&oldKey.PublicKey},
+		IDExpirationSecs: 900,
+	})
+
+	oldPair, err := before.NewPairFromUser(context.TODO(), u, "", nil)
+	assert.NoError(t, err)
+	newPair, err := after.NewPairFromUser(context.TODO(), u, "", nil)
+	assert.NoError(t, err)
+
+	t.Run("kid is stamped", func(t *testing.T) {
+		token, _, err := new(jwt.Parser).ParseUnverified(newPair.IDToken.SS, new(idTokenCustomClaims))
+		assert.NoError(t, err)
+		assert.Equal(t, keyID(&newKey.PublicKey), token.Header["kid"])
+	})
+
+	t.Run("tokens of the retired key are valid", func(t *testing.T) {
+		claims, err := after.ValidateIDToken(oldPair.IDToken.SS)
+		assert.NoError(t, err)
+		assert.Equal(t, uid, claims.User.UID)
+
+		claims, err = after.ValidateIDToken(newPair.IDToken.SS)
+		assert.NoError(t, err)
+		assert.Equal(t, uid, claims.User.UID)
+	})
+
+	t.Run("unknown kid is rejected", func(t *testing.T) {
+		_, err := before.ValidateIDToken(newPair.IDToken.SS)
+		assert.Error(t, err)
+	})
+
+	t.Run("jwks lists active key first", func(t *testing.T) {
+		jwks := after.JWKS()
+		assert.Len(t, jwks.Keys, 2)
+		assert.Equal(t, keyID(&newKey.PublicKey), jwks.Keys[0].Kid)
+		assert.Equal(t, keyID(&oldKey.PublicKey), jwks.Keys[1].Kid)
+		assert.Equal(t, "RS256", jwks.Keys[0].Alg)
+		assert.Equal(t, "AQAB", jwks.Keys[0].E)
+	})
+}
+
+func TestNilKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	uid, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com"}
+
+	t.Run("nil pointer keys are rejected", func(t *testing.T) {
+		for _, k := range []crypto.PublicKey{nil, (*rsa.PublicKey)(nil), (*ecdsa.PublicKey)(nil), ed25519.PublicKey(nil)} {
+			_, err := signingMethod(k)
+			assert.Error(t, err)
+
+			_, err = newKeyRing(nil, nil, nil).add(k)
+			assert.Error(t, err)
+		}
+	})
+
+	t.Run("service without keys does not panic", func(t *testing.T) {
+		mockTokenRepository := new(mocks.MockTokenRepository)
+
+		var s model.TokenService
+		assert.NotPanics(t, func() {
+			s = NewTokenService(&TSConfig{
+				TokenRepository:  mockTokenRepository,
+				PrivKey:          (*rsa.PrivateKey)(nil),
+				PubKey:           (*rsa.PublicKey)(nil),
+				RetiredPubKeys:   []crypto.PublicKey{(*rsa.PublicKey)(nil)},
+				IDExpirationSecs: 900,
+			})
+		})
+
+		_, err := s.NewPairFromUser(context.TODO(), u, "", nil)
+		assert.Equal(t, http.StatusInternalServerError, apperrors.Status(err))
+		assert.Empty(t, s.JWKS().Keys)
+	})
+
+	t.Run("retired nil key is skipped", func(t *testing.T) {
+		s := NewTokenService(&TSConfig{
+			PrivKey:          key,
+			RetiredPubKeys:   []crypto.PublicKey{(*rsa.PublicKey)(nil)},
+			IDExpirationSecs: 900,
+		})
+
+		jwks := s.JWKS()
+		assert.Len(t, jwks.Keys, 1)
+		assert.Equal(t, keyID(&key.PublicKey), jwks.Keys[0].Kid)
+	})
+}
+
+func TestSigningAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	uid, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com"}
+
+	mockTokenRepository := new(mocks.MockTokenRepository)
+	mockTokenRepository.
+		On("SetRefreshToken", mock.Anything, uid.String(), mock.AnythingOfType("string"), mock.AnythingOfType("*model.Session"), mock.AnythingOfType("time.Duration")).
+		Return(nil)
+	mockTokenRepository.On("IsTokenDenied", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+
+	newService := func(key crypto.PrivateKey) model.TokenService {
+		return NewTokenService(&TSConfig{
+			TokenRepository:  mockTokenRepository,
+			PrivKey:          key,
+			IDExpirationSecs: 900,
+		})
+	}
+
+	cases := []struct {
+		alg string
+		kty string
+		crv string
+		key crypto.PrivateKey
+	}{
+		{alg: "RS256", kty: "RSA", key: rsaKey},
+		{alg: "ES256", kty: "EC", crv: "P-256", key: ecKey},
+		{alg: "EdDSA", kty: "OKP", crv: "Ed25519", key: edKey},
+	}
+
+	for _, c := range cases {
+		t.Run(c.alg, func(t *testing.T) {
+			s := newService(c.key)
+
+			pair, err := s.NewPairFromUser(context.TODO(), u, "", nil)
+			assert.NoError(t, err)
+
+			token, _, err := new(jwt.Parser).ParseUnverified(pair.IDToken.SS, new(idTokenCustomClaims))
+			assert.NoError(t, err)
+			assert.Equal(t, c.alg, token.Header["alg"])
+
+			claims, err := s.ValidateIDToken(pair.IDToken.SS)
+			assert.NoError(t, err)
+			assert.Equal(t, uid, claims.User.UID)
+
+			jwks := s.JWKS()
+			assert.Len(t, jwks.Keys, 1)
+			assert.Equal(t, c.alg, jwks.Keys[0].Alg)
+			assert.Equal(t, c.kty, jwks.Keys[0].Kty)
+			assert.Equal(t, c.crv, jwks.Keys[0].Crv)
+		})
+	}
+
+	t.Run("alg of another key type is rejected", func(t *testing.T) {
+		ecService := newService(ecKey)
+		kid := ecService.JWKS().Keys[0].Kid
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idTokenCustomClaims{
+			StandardClaims: jwt.StandardClaims{Subject: uid.String(), ExpiresAt: time.Now().Add(time.Minute).Unix()},
+		})
+		token.Header["kid"] = kid
+		ss, err := token.SignedString(rsaKey)
+		assert.NoError(t, err)
+
+		_, err = ecService.ValidateIDToken(ss)
+		assert.Error(t, err)
+	})
+
+	t.Run("hmac with the public key is rejected", func(t *testing.T) {
+		edService := newService(edKey)
+
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, idTokenCustomClaims{
+			StandardClaims: jwt.StandardClaims{Subject: uid.String(), ExpiresAt: time.Now().Add(time.Minute).Unix()},
+		})
+		ss, err := token.SignedString([]byte(edKey.Public().(ed25519.PublicKey)))
+		assert.NoError(t, err)
+
+		_, err = edService.ValidateIDToken(ss)
+		assert.Error(t, err)
+	})
+
+	t.Run("alg none is rejected", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodNone, idTokenCustomClaims{
+			StandardClaims: jwt.StandardClaims{Subject: uid.String(), ExpiresAt: time.Now().Add(time.Minute).Unix()},
+		})
+		ss, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		assert.NoError(t, err)
+
+		_, err = newService(rsaKey).ValidateIDToken(ss)
+		assert.Error(t, err)
 	})
 }
 
+func TestIDTokenIssuerAudience(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	uid, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com", EmailVerified: true, ImageURL: "http://malcorp.test/bob.png"}
+
+	mockTokenRepository := new(mocks.MockTokenRepository)
+	mockTokenRepository.
+		On("SetRefreshToken", mock.Anything, uid.String(), mock.AnythingOfType("string"), mock.AnythingOfType("*model.Session"), mock.AnythingOfType("time.Duration")).
+		Return(nil)
+	mockTokenRepository.On("IsTokenDenied", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+
+	newService := func(issuer, audience string) model.TokenService {
+		return NewTokenService(&TSConfig{
+			TokenRepository:  mockTokenRepository,
+			PrivKey:          key,
+			PubKey:           &key.PublicKey,
+			Issuer:           issuer,
+			Audience:         audience,
+			IDExpirationSecs: 900,
+		})
+	}
+
+	tokenService := newService("http://malcorp.test", "malcorp")
+	tokenPair, err := tokenService.NewPairFromUser(context.TODO(), u, "", nil)
+	assert.NoError(t, err)
+
+	claims, err := tokenService.ValidateIDToken(tokenPair.IDToken.SS)
+	assert.NoError(t, err)
+	assert.Equal(t, u.UID, claims.User.UID)
+	assert.True(t, claims.User.EmailVerified)
+	assert.Equal(t, u.ImageURL, claims.User.ImageURL)
+	assert.Empty(t, claims.ClientID)
+
+	_, err = newService("http://evil.test", "malcorp").ValidateIDToken(tokenPair.IDToken.SS)
+	assert.Error(t, err)
+
+	_, err = newService("http://malcorp.test", "other-service").ValidateIDToken(tokenPair.IDToken.SS)
+	assert.Error(t, err)
+
+	// tokens of oauth clients are issued for the client
+	clientPair, err := tokenService.NewPairFromUser(context.TODO(), u, "", &model.SessionClient{ClientID: "spa"})
+	assert.NoError(t, err)
+
+	var clientClaims idTokenCustomClaims
+	_, _, err = new(jwt.Parser).ParseUnverified(clientPair.IDToken.SS, &clientClaims)
+	assert.NoError(t, err)
+	assert.Equal(t, "spa", clientClaims.Audience)
+	assert.Equal(t, "spa", clientClaims.AuthorizedParty)
+
+	claims, err = tokenService.ValidateIDToken(clientPair.IDToken.SS)
+	assert.NoError(t, err)
+	assert.Equal(t, "spa", claims.ClientID)
+	assert.Equal(t, u.UID, claims.User.UID)
+}
+
+func TestAccessToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	uid, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com"}
+	sa := &model.ServiceAccount{ID: "billing-job", Scopes: []string{"users:read", "users:write"}}
+
+	mockTokenRepository := new(mocks.MockTokenRepository)
+	mockTokenRepository.
+		On("SetRefreshToken", mock.Anything, uid.String(), mock.AnythingOfType("string"), mock.AnythingOfType("*model.Session"), mock.AnythingOfType("time.Duration")).
+		Return(nil)
+	mockTokenRepository.On("IsTokenDenied", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+
+	tokenService := NewTokenService(&TSConfig{
+		TokenRepository:  mockTokenRepository,
+		PrivKey:          key,
+		PubKey:           &key.PublicKey,
+		Issuer:           "http://malcorp.test",
+		Audience:         "malcorp",
+		IDExpirationSecs: 900,
+	})
+
+	accessToken, err := tokenService.NewAccessToken(context.TODO(), sa, "users:read")
+	assert.NoError(t, err)
+	assert.Equal(t, "users:read", accessToken.Scope)
+	assert.Equal(t, int64(900), accessToken.ExpiresIn)
+
+	p, err := tokenService.ValidateAccessToken(accessToken.SS)
+	assert.NoError(t, err)
+	assert.Equal(t, "billing-job", p.ClientID)
+	assert.True(t, p.HasScope("users:read"))
+	assert.False(t, p.HasScope("users:write"))
+
+	// access tokens and id tokens are not interchangeable
+	_, err = tokenService.ValidateIDToken(accessToken.SS)
+	assert.Error(t, err)
+
+	tokenPair, err := tokenService.NewPairFromUser(context.TODO(), u, "", nil)
+	assert.NoError(t, err)
+
+	_, err = tokenService.ValidateAccessToken(tokenPair.IDToken.SS)
+	assert.Error(t, err)
+}
+
+func TestRolesClaims(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	uid, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com"}
+
+	mockTokenRepository := new(mocks.MockTokenRepository)
+	mockTokenRepository.
+		On("SetRefreshToken", mock.Anything, uid.String(), mock.AnythingOfType("string"), mock.AnythingOfType("*model.Session"), mock.AnythingOfType("time.Duration")).
+		Return(nil)
+	mockTokenRepository.On("IsTokenDenied", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+
+	newService := func(r model.RoleRepository) model.TokenService {
+		return NewTokenService(&TSConfig{
+			TokenRepository:  mockTokenRepository,
+			RoleRepository:   r,
+			PrivKey:          key,
+			PubKey:           &key.PublicKey,
+			Issuer:           "http://malcorp.test",
+			Audience:         "malcorp",
+			IDExpirationSecs: 900,
+		})
+	}
+
+	t.Run("Roles and permissions are claims", func(t *testing.T) {
+		mockRoleRepository := new(mocks.MockRoleRepository)
+		mockRoleRepository.On("FindByUser", mock.Anything, uid).Return([]*model.Role{
+			{Name: "admin", Permissions: []string{"users:write", "users:read"}},
+			{Name: "support", Permissions: []string{"users:read"}},
+		}, nil)
+		tokenService := newService(mockRoleRepository)
+
+		tokenPair, err := tokenService.NewPairFromUser(context.TODO(), u, "", nil)
+		assert.NoError(t, err)
+
+		claims, err := tokenService.ValidateIDToken(tokenPair.IDToken.SS)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"admin", "support"}, claims.User.Roles)
+		assert.Equal(t, []string{"users:read", "users:write"}, claims.User.Permissions)
+		assert.True(t, claims.User.HasPermission("users:write"))
+
+		// the user passed in is not changed
+		assert.Empty(t, u.Roles)
+	})
+
+	t.Run("No roles", func(t *testing.T) {
+		mockRoleRepository := new(mocks.MockRoleRepository)
+		mockRoleRepository.On("FindByUser", mock.Anything, uid).Return([]*model.Role{}, nil)
+		tokenService := newService(mockRoleRepository)
+
+		tokenPair, err := tokenService.NewPairFromUser(context.TODO(), u, "", nil)
+		assert.NoError(t, err)
+
+		claims, err := tokenService.ValidateIDToken(tokenPair.IDToken.SS)
+		assert.NoError(t, err)
+		assert.Empty(t, claims.User.Roles)
+		assert.False(t, claims.User.HasPermission("users:read"))
+	})
+
+	t.Run("Error loading roles", func(t *testing.T) {
+		mockRoleRepository := new(mocks.MockRoleRepository)
+		mockRoleRepository.On("FindByUser", mock.Anything, uid).Return(nil, fmt.Errorf("some error"))
+		tokenService := newService(mockRoleRepository)
+
+		_, err := tokenService.NewPairFromUser(context.TODO(), u, "", nil)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, apperrors.Status(err))
+	})
+}
+
+func TestIntrospectAndRevoke(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	uid, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com"}
+	sa := &model.ServiceAccount{ID: "billing-job"}
+
+	mockTokenRepository := new(mocks.MockTokenRepository)
+	mockTokenRepository.
+		On("SetRefreshToken", mock.Anything, uid.String(), mock.AnythingOfType("string"), mock.AnythingOfType("*model.Session"), mock.AnythingOfType("time.Duration")).
+		Return(nil)
+	mockTokenRepository.On("IsTokenDenied", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+
+	tokenService := NewTokenService(&TSConfig{
+		TokenRepository:       mockTokenRepository,
+		PrivKey:               key,
+		PubKey:                &key.PublicKey,
+		Issuer:                "http://malcorp.test",
+		Audience:              "malcorp",
+		RefreshSecret:         "secret",
+		IDExpirationSecs:      900,
+		RefrashExpirationSecs: 3600,
+	})
+
+	tokenPair, err := tokenService.NewPairFromUser(context.TODO(), u, "", &model.SessionClient{ClientID: "spa"})
+	assert.NoError(t, err)
+	tokenID := tokenPair.RefreshToken.ID.String()
+
+	accessToken, err := tokenService.NewAccessToken(context.TODO(), sa, "users:read")
+	assert.NoError(t, err)
+
+	t.Run("Id token", func(t *testing.T) {
+		i, err := tokenService.Introspect(context.TODO(), tokenPair.IDToken.SS)
+		assert.NoError(t, err)
+		assert.True(t, i.Active)
+		assert.Equal(t, uid.String(), i.Sub)
+		assert.NotZero(t, i.Exp)
+	})
+
+	t.Run("Access token", func(t *testing.T) {
+		i, err := tokenService.Introspect(context.TODO(), accessToken.SS)
+		assert.NoError(t, err)
+		assert.True(t, i.Active)
+		assert.Equal(t, "billing-job", i.Sub)
+		assert.Equal(t, "users:read", i.Scope)
+	})
+
+	t.Run("Refresh token", func(t *testing.T) {
+		mockTokenRepository.On("GetRefreshToken", mock.Anything, uid.String(), tokenID).Return(&model.Session{ClientID: "spa"}, nil).Once()
+
+		i, err := tokenService.Introspect(context.TODO(), tokenPair.RefreshToken.SS)
+		assert.NoError(t, err)
+		assert.True(t, i.Active)
+		assert.Equal(t, uid.String(), i.Sub)
+		assert.Equal(t, "spa", i.ClientID)
+	})
+
+	t.Run("Revoked refresh token", func(t *testing.T) {
+		mockTokenRepository.On("GetRefreshToken", mock.Anything, uid.String(), tokenID).Return(nil, apperrors.NewAuthorization("invalid refresh token")).Once()
+
+		i, err := tokenService.Introspect(context.TODO(), tokenPair.RefreshToken.SS)
+		assert.NoError(t, err)
+		assert.False(t, i.Active)
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		i, err := tokenService.Introspect(context.TODO(), "invalid")
+		assert.NoError(t, err)
+		assert.Equal(t, &model.TokenIntrospection{}, i)
+	})
+
+	t.Run("Revoke of another client", func(t *testing.T) {
+		mockTokenRepository.On("GetRefreshToken", mock.Anything, uid.String(), tokenID).Return(&model.Session{ClientID: "spa"}, nil).Once()
+
+		err := tokenService.RevokeRefreshToken(context.TODO(), tokenPair.RefreshToken.SS, "other")
+		assert.Error(t, err)
+		mockTokenRepository.AssertNotCalled(t, "DeleteRefreshToken", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		mockTokenRepository.On("GetRefreshToken", mock.Anything, uid.String(), tokenID).Return(&model.Session{ClientID: "spa"}, nil).Once()
+		mockTokenRepository.On("DeleteRefreshToken", mock.Anything, uid.String(), tokenID).Return(&model.Session{ClientID: "spa"}, nil).Once()
+
+		err := tokenService.RevokeRefreshToken(context.TODO(), tokenPair.RefreshToken.SS, "spa")
+		assert.NoError(t, err)
+		mockTokenRepository.AssertNotCalled(t, "DeleteUserRefreshToken", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Revoke of invalid token", func(t *testing.T) {
+		err := tokenService.RevokeRefreshToken(context.TODO(), "invalid", "spa")
+		assert.NoError(t, err)
+	})
+}
+
+func TestIDTokenDenylist(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	uid, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com"}
+
+	newService := func(mockTokenRepository *mocks.MockTokenRepository) model.TokenService {
+		mockTokenRepository.
+			On("SetRefreshToken", mock.Anything, uid.String(), mock.AnythingOfType("string"), mock.AnythingOfType("*model.Session"), mock.AnythingOfType("time.Duration")).
+			Return(nil)
+
+		return NewTokenService(&TSConfig{
+			TokenRepository:      mockTokenRepository,
+			PrivKey:              key,
+			PubKey:               &key.PublicKey,
+			IDExpirationSecs:     900,
+			DenylistCacheTTLSecs: 60,
+		})
+	}
+
+	t.Run("Lookups are cached", func(t *testing.T) {
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		tokenService := newService(mockTokenRepository)
+		mockTokenRepository.On("IsTokenDenied", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+
+		tokenPair, err := tokenService.NewPairFromUser(context.TODO(), u, "", nil)
+		assert.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			_, err := tokenService.ValidateIDToken(tokenPair.IDToken.SS)
+			assert.NoError(t, err)
+		}
+
+		// jti and sid are looked up once
+		mockTokenRepository.AssertNumberOfCalls(t, "IsTokenDenied", 2)
+	})
+
+	t.Run("Signout revokes the id tokens of every session", func(t *testing.T) {
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		tokenService := newService(mockTokenRepository)
+		mockTokenRepository.On("IsTokenDenied", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+
+		tokenPair, err := tokenService.NewPairFromUser(context.TODO(), u, "", nil)
+		assert.NoError(t, err)
+
+		claims, err := tokenService.ValidateIDToken(tokenPair.IDToken.SS)
+		assert.NoError(t, err)
+
+		mockTokenRepository.On("ListSessions", mock.Anything, uid.String()).Return([]*model.Session{{ID: claims.SessionID}}, nil)
+		mockTokenRepository.On("DeleteUserRefreshToken", mock.Anything, uid.String()).Return(nil)
+		mockTokenRepository.On("DenyTokens", mock.Anything, []string{claims.SessionID}, 900*time.Second).Return(nil)
+
+		assert.NoError(t, tokenService.Signout(context.TODO(), uid))
+
+		// rejected at once although the lookup was cached as allowed
+		_, err = tokenService.ValidateIDToken(tokenPair.IDToken.SS)
+		assert.Error(t, err)
+		mockTokenRepository.AssertExpectations(t)
+	})
+
+	t.Run("Revoked on another instance", func(t *testing.T) {
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		tokenService := newService(mockTokenRepository)
+
+		tokenPair, err := tokenService.NewPairFromUser(context.TODO(), u, "", nil)
+		assert.NoError(t, err)
+
+		mockTokenRepository.On("IsTokenDenied", mock.Anything, mock.AnythingOfType("string")).Return(true, nil)
+
+		_, err = tokenService.ValidateIDToken(tokenPair.IDToken.SS)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+
+		i, err := tokenService.Introspect(context.TODO(), tokenPair.IDToken.SS)
+		assert.NoError(t, err)
+		assert.False(t, i.Active)
+	})
+
+	t.Run("Revoke a single id token", func(t *testing.T) {
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		tokenService := newService(mockTokenRepository)
+		mockTokenRepository.On("IsTokenDenied", mock.Anything, mock.AnythingOfType("string")).Return(false, nil)
+
+		revoked, err := tokenService.NewPairFromUser(context.TODO(), u, "", nil)
+		assert.NoError(t, err)
+		other, err := tokenService.NewPairFromUser(context.TODO(), u, "", nil)
+		assert.NoError(t, err)
+
+		mockTokenRepository.On("DenyTokens", mock.Anything, mock.AnythingOfType("[]string"), mock.AnythingOfType("time.Duration")).Return(nil)
+
+		assert.NoError(t, tokenService.RevokeIDToken(context.TODO(), revoked.IDToken.SS))
+
+		_, err = tokenService.ValidateIDToken(revoked.IDToken.SS)
+		assert.Error(t, err)
+
+		_, err = tokenService.ValidateIDToken(other.IDToken.SS)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Denylist unavailable", func(t *testing.T) {
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		tokenService := newService(mockTokenRepository)
+		mockTokenRepository.On("IsTokenDenied", mock.Anything, mock.AnythingOfType("string")).Return(false, apperrors.NewInternal())
+
+		tokenPair, err := tokenService.NewPairFromUser(context.TODO(), u, "", nil)
+		assert.NoError(t, err)
+
+		_, err = tokenService.ValidateIDToken(tokenPair.IDToken.SS)
+		assert.Error(t, err)
+	})
+}
+
+func TestOpaqueRefreshToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	uid, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com"}
+
+	newService := func(mockTokenRepository *mocks.MockTokenRepository, opaque bool) model.TokenService {
+		return NewTokenService(&TSConfig{
+			TokenRepository:       mockTokenRepository,
+			PrivKey:               key,
+			PubKey:                &key.PublicKey,
+			RefreshSecret:         "secret",
+			IDExpirationSecs:      900,
+			RefrashExpirationSecs: 3600,
+			OpaqueRefreshTokens:   opaque,
+		})
+	}
+
+	mockTokenRepository := new(mocks.MockTokenRepository)
+	mockTokenRepository.
+		On("SetRefreshToken", mock.Anything, uid.String(), mock.AnythingOfType("string"), mock.AnythingOfType("*model.Session"), time.Hour).
+		Return(nil)
+
+	var storedHash string
+	var stored *model.OpaqueRefreshToken
+	mockTokenRepository.
+		On("SetOpaqueRefreshToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("*model.OpaqueRefreshToken"), time.Hour).
+		Run(func(args mock.Arguments) {
+			storedHash = args.String(1)
+			stored = args.Get(2).(*model.OpaqueRefreshToken)
+		}).
+		Return(nil)
+
+	tokenService := newService(mockTokenRepository, true)
+
+	tokenPair, err := tokenService.NewPairFromUser(context.TODO(), u, "", nil)
+	assert.NoError(t, err)
+
+	t.Run("Issued", func(t *testing.T) {
+		// random and url safe, nothing about the user is readable from it
+		assert.False(t, isJWT(tokenPair.RefreshToken.SS))
+		assert.NotContains(t, tokenPair.RefreshToken.SS, uid.String())
+		assert.Equal(t, hashOneTimeToken(tokenPair.RefreshToken.SS), storedHash)
+
+		assert.Equal(t, uid, stored.UID)
+		assert.NotEmpty(t, stored.SessionID)
+		assert.Equal(t, time.Hour, stored.ExpiresAt.Sub(stored.IssuedAt))
+
+		// the session is stored under the id derived from the hash
+		mockTokenRepository.AssertCalled(t, "SetRefreshToken", mock.Anything, uid.String(), opaqueRefreshTokenID(storedHash).String(), mock.AnythingOfType("*model.Session"), time.Hour)
+	})
+
+	t.Run("Validated by lookup", func(t *testing.T) {
+		mockTokenRepository.On("GetOpaqueRefreshToken", mock.Anything, storedHash).Return(stored, nil).Once()
+
+		refreshToken, err := tokenService.ValidateRefreshToken(tokenPair.RefreshToken.SS)
+		assert.NoError(t, err)
+		assert.Equal(t, uid, refreshToken.UID)
+		assert.Equal(t, tokenPair.RefreshToken.ID, refreshToken.ID)
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		mockTokenRepository.
+			On("GetOpaqueRefreshToken", mock.Anything, hashOneTimeToken("unknown")).
+			Return(nil, apperrors.NewAuthorization("invalid refresh token")).Once()
+
+		_, err := tokenService.ValidateRefreshToken("unknown")
+		assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+	})
+
+	t.Run("Jwt refresh tokens stay valid", func(t *testing.T) {
+		jwtPair, err := newService(mockTokenRepository, false).NewPairFromUser(context.TODO(), u, "", nil)
+		assert.NoError(t, err)
+		assert.True(t, isJWT(jwtPair.RefreshToken.SS))
+
+		refreshToken, err := tokenService.ValidateRefreshToken(jwtPair.RefreshToken.SS)
+		assert.NoError(t, err)
+		assert.Equal(t, uid, refreshToken.UID)
+	})
+
+	t.Run("Opaque token in jwt mode", func(t *testing.T) {
+		_, err := newService(mockTokenRepository, false).ValidateRefreshToken(tokenPair.RefreshToken.SS)
+		assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+	})
+}
+
+func TestKeyID(t *testing.T) {
+	// example key of RFC 7638 section 3.1
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	k := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", keyID(k))
+
+	// example key of RFC 8037 appendix A.3
+	x, _ := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+
+	assert.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", keyID(ed25519.PublicKey(x)))
+}
+
 func TestValidateIDToken(t *testing.T) {
 	// ToDo: implement
 }
@@ -165,3 +1011,78 @@ func ValidateRefreshToken(t *testing.T) {
 func Signout(t *testing.T) {
 	// ToDo: implement
 }
+
+func TestSessions(t *testing.T) {
+	uid, _ := uuid.NewRandom()
+	now := time.Now()
+
+	newSessions := func() []*model.Session {
+		return []*model.Session{
+			{ID: "old", TokenID: "old-token", LastRefreshedAt: now.Add(-time.Hour)},
+			{ID: "current", TokenID: "current-token", LastRefreshedAt: now},
+			{ID: "lost", TokenID: "lost-token", LastRefreshedAt: now.Add(-time.Minute)},
+		}
+	}
+
+	t.Run("List marks current and sorts by last refresh", func(t *testing.T) {
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		tokenService := NewTokenService(&TSConfig{TokenRepository: mockTokenRepository})
+
+		mockTokenRepository.On("ListSessions", mock.Anything, uid.String()).Return(newSessions(), nil)
+
+		sessions, err := tokenService.ListSessions(context.TODO(), uid, "current")
+		assert.NoError(t, err)
+
+		assert.Len(t, sessions, 3)
+		assert.Equal(t, "current", sessions[0].ID)
+		assert.True(t, sessions[0].Current)
+		assert.Equal(t, "lost", sessions[1].ID)
+		assert.False(t, sessions[1].Current)
+		assert.Equal(t, "old", sessions[2].ID)
+	})
+
+	t.Run("Revoke one", func(t *testing.T) {
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		tokenService := NewTokenService(&TSConfig{TokenRepository: mockTokenRepository})
+
+		mockTokenRepository.On("ListSessions", mock.Anything, uid.String()).Return(newSessions(), nil)
+		mockTokenRepository.On("DeleteRefreshToken", mock.Anything, uid.String(), "lost-token").Return(&model.Session{ID: "lost"}, nil)
+		mockTokenRepository.On("DenyTokens", mock.Anything, []string{"lost"}, mock.AnythingOfType("time.Duration")).Return(nil)
+
+		err := tokenService.RevokeSession(context.TODO(), uid, "lost")
+		assert.NoError(t, err)
+		mockTokenRepository.AssertNumberOfCalls(t, "DeleteRefreshToken", 1)
+		mockTokenRepository.AssertCalled(t, "DenyTokens", mock.Anything, []string{"lost"}, mock.AnythingOfType("time.Duration"))
+	})
+
+	t.Run("Revoke unknown", func(t *testing.T) {
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		tokenService := NewTokenService(&TSConfig{TokenRepository: mockTokenRepository})
+
+		mockTokenRepository.On("ListSessions", mock.Anything, uid.String()).Return(newSessions(), nil)
+
+		err := tokenService.RevokeSession(context.TODO(), uid, "unknown")
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, apperrors.Status(err))
+		mockTokenRepository.AssertNotCalled(t, "DeleteRefreshToken", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Revoke others", func(t *testing.T) {
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		tokenService := NewTokenService(&TSConfig{TokenRepository: mockTokenRepository})
+
+		mockTokenRepository.On("ListSessions", mock.Anything, uid.String()).Return(newSessions(), nil)
+		mockTokenRepository.On("DeleteRefreshToken", mock.Anything, uid.String(), "old-token").Return(&model.Session{ID: "old"}, nil)
+		// rotated meanwhile
+		mockTokenRepository.
+			On("DeleteRefreshToken", mock.Anything, uid.String(), "lost-token").
+			Return(nil, apperrors.NewAuthorization("invalid refresh token"))
+		mockTokenRepository.On("DenyTokens", mock.Anything, []string{"old"}, mock.AnythingOfType("time.Duration")).Return(nil)
+
+		err := tokenService.RevokeOtherSessions(context.TODO(), uid, "current")
+		assert.NoError(t, err)
+		mockTokenRepository.AssertCalled(t, "DenyTokens", mock.Anything, []string{"old"}, mock.AnythingOfType("time.Duration"))
+		mockTokenRepository.AssertNumberOfCalls(t, "DeleteRefreshToken", 2)
+		mockTokenRepository.AssertNotCalled(t, "DeleteRefreshToken", mock.Anything, uid.String(), "current-token")
+	})
+}
@@ -1,8 +1,9 @@
 package service
 
 import (
-	"crypto/rsa"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Kara4ev/go-web-tmp/internal/model"
@@ -11,15 +12,79 @@ import (
 	"github.com/google/uuid"
 )
 
+// idTokenCustomClaims are the OpenID Connect standard claims,
+// the subject is the uid of the user
 type idTokenCustomClaims struct {
-	User *model.User `json:"user"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+	SessionID     string `json:"sid,omitempty"`
+	// AuthorizedParty is the oauth client the token was issued to
+	AuthorizedParty string `json:"azp,omitempty"`
+	// Roles of the user and the Permissions they grant,
+	// downstream services authorize by permission
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
 	jwt.StandardClaims
 }
 
+// user restores the user from the claims
+func (c *idTokenCustomClaims) user() (*model.User, error) {
+	uid, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("id token subject is not an uid: %w", err)
+	}
+
+	return &model.User{
+		UID:           uid,
+		Email:         c.Email,
+		EmailVerified: c.EmailVerified,
+		Name:          c.Name,
+		ImageURL:      c.Picture,
+		Roles:         c.Roles,
+		Permissions:   c.Permissions,
+	}, nil
+}
+
+// accessTokenType is the typ header of service account access tokens,
+// it keeps them from being accepted as id tokens, https://www.rfc-editor.org/rfc/rfc9068
+const accessTokenType = "at+jwt"
+
+// accessTokenCustomClaims are the claims of service account access tokens,
+// the subject is the client id of the service account
+type accessTokenCustomClaims struct {
+	Scope    string `json:"scope"`
+	ClientID string `json:"client_id"`
+	jwt.StandardClaims
+}
+
+// principal restores the service principal from the claims
+func (c *accessTokenCustomClaims) principal() (*model.ServicePrincipal, error) {
+	if c.Subject == "" || c.Subject != c.ClientID {
+		return nil, fmt.Errorf("access token subject is not the client: %s", c.Subject)
+	}
+
+	return &model.ServicePrincipal{
+		ClientID: c.ClientID,
+		Scopes:   strings.Fields(c.Scope),
+	}, nil
+}
+
 type refreshTokenData struct {
 	SS        string
 	ID        uuid.UUID
 	ExpiresIn time.Duration
+	// Hash is the key of an opaque refresh token, empty for jwt refresh tokens
+	Hash string
+}
+
+// refreshTokenInfo is a verified refresh token of either format
+type refreshTokenInfo struct {
+	ID        uuid.UUID
+	UID       uuid.UUID
+	IssuedAt  int64
+	ExpiresAt int64
 }
 
 type refreshTokenCustomClaims struct {
@@ -27,19 +92,41 @@ type refreshTokenCustomClaims struct {
 	jwt.StandardClaims
 }
 
-func generateIDToken(u *model.User, key *rsa.PrivateKey, exp int64) (string, error) {
+// generateIDToken issues the id token of a session. The token of an oauth client is
+// issued for the client, its aud and azp are the client id instead of the audience
+func generateIDToken(u *model.User, sessionID, clientID, issuer, audience string, keys *keyRing, exp int64) (string, error) {
 	unixtime := time.Now().Unix()
 	tokenExp := unixtime + exp
+	tokenID, err := uuid.NewRandom()
+
+	if err != nil {
+		logger.Warn("failed to generate id token ID")
+		return "", err
+	}
+
+	if clientID != "" {
+		audience = clientID
+	}
 
 	clams := idTokenCustomClaims{
-		User: u,
+		Email:           u.Email,
+		EmailVerified:   u.EmailVerified,
+		Name:            u.Name,
+		Picture:         u.ImageURL,
+		SessionID:       sessionID,
+		AuthorizedParty: clientID,
+		Roles:           u.Roles,
+		Permissions:     u.Permissions,
 		StandardClaims: jwt.StandardClaims{
+			Issuer:    issuer,
+			Subject:   u.UID.String(),
+			Audience:  audience,
 			IssuedAt:  unixtime,
 			ExpiresAt: tokenExp,
+			Id:        tokenID.String(),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, clams)
-	ss, err := token.SignedString(key)
+	ss, err := keys.sign(clams, nil)
 
 	if err != nil {
 		logger.Warn("failed to sign id token string")
@@ -49,6 +136,37 @@ func generateIDToken(u *model.User, key *rsa.PrivateKey, exp int64) (string, err
 	return ss, nil
 }
 
+func generateAccessToken(sa *model.ServiceAccount, scope, issuer, audience string, keys *keyRing, exp int64) (string, error) {
+	unixtime := time.Now().Unix()
+	tokenID, err := uuid.NewRandom()
+
+	if err != nil {
+		logger.Warn("failed to generate access token ID")
+		return "", err
+	}
+
+	clams := accessTokenCustomClaims{
+		Scope:    scope,
+		ClientID: sa.ID,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    issuer,
+			Subject:   sa.ID,
+			Audience:  audience,
+			IssuedAt:  unixtime,
+			ExpiresAt: unixtime + exp,
+			Id:        tokenID.String(),
+		},
+	}
+	ss, err := keys.sign(clams, map[string]interface{}{"typ": accessTokenType})
+
+	if err != nil {
+		logger.Warn("failed to sign access token string")
+		return "", err
+	}
+
+	return ss, nil
+}
+
 func generateRefrashToken(uid uuid.UUID, key string, exp int64) (*refreshTokenData, error) {
 	currentTime := time.Now()
 	tokenExp := currentTime.Add(time.Duration(exp) * time.Second)
@@ -84,11 +202,45 @@ func generateRefrashToken(uid uuid.UUID, key string, exp int64) (*refreshTokenDa
 
 }
 
-func validateIDToken(tokenString string, key *rsa.PublicKey) (*idTokenCustomClaims, error) {
+// generateOpaqueRefreshToken returns a random refresh token, only its sha256 hash is stored.
+// The token id is derived from the hash, so the token is stored like a jwt refresh token
+func generateOpaqueRefreshToken(exp int64) (*refreshTokenData, error) {
+	ss, hash, err := generateOneTimeToken()
+	if err != nil {
+		logger.Warn("failed to generate opaque refrash token")
+		return nil, err
+	}
+
+	return &refreshTokenData{
+		SS:        ss,
+		ID:        opaqueRefreshTokenID(hash),
+		ExpiresIn: time.Duration(exp) * time.Second,
+		Hash:      hash,
+	}, nil
+}
+
+// opaqueRefreshTokenID is the token id of an opaque refresh token, the first 16 bytes of its hash
+func opaqueRefreshTokenID(hash string) uuid.UUID {
+	b, _ := hex.DecodeString(hash)
+	var id uuid.UUID
+	copy(id[:], b)
+	return id
+}
+
+// isJWT tells jwt refresh tokens from opaque ones, which have no dots
+func isJWT(tokenString string) bool {
+	return strings.Count(tokenString, ".") == 2
+}
+
+func validateIDToken(tokenString string, keys *keyRing, issuer, audience string) (*idTokenCustomClaims, error) {
 	claims := new(idTokenCustomClaims)
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return key, nil
+		if typ, _ := t.Header["typ"].(string); typ == accessTokenType {
+			return nil, fmt.Errorf("access token used as id token")
+		}
+
+		return keys.keyFunc(t)
 	})
 
 	if err != nil {
@@ -105,6 +257,45 @@ func validateIDToken(tokenString string, key *rsa.PublicKey) (*idTokenCustomClai
 		return nil, fmt.Errorf("id token invalid, but couldn't parse claims")
 	}
 
+	if claims.Issuer != issuer {
+		return nil, fmt.Errorf("id token issuer is invalid: %s", claims.Issuer)
+	}
+
+	// tokens of oauth clients are issued for the client they were authorized to
+	if claims.Audience != audience && (claims.AuthorizedParty == "" || claims.Audience != claims.AuthorizedParty) {
+		return nil, fmt.Errorf("id token audience is invalid: %s", claims.Audience)
+	}
+
+	return claims, nil
+}
+
+func validateAccessToken(tokenString string, keys *keyRing, issuer, audience string) (*accessTokenCustomClaims, error) {
+	claims := new(accessTokenCustomClaims)
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		if typ, _ := t.Header["typ"].(string); typ != accessTokenType {
+			return nil, fmt.Errorf("access token typ is invalid: %s", typ)
+		}
+
+		return keys.keyFunc(t)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("access token is invalid")
+	}
+
+	if claims.Issuer != issuer {
+		return nil, fmt.Errorf("access token issuer is invalid: %s", claims.Issuer)
+	}
+
+	if claims.Audience != audience {
+		return nil, fmt.Errorf("access token audience is invalid: %s", claims.Audience)
+	}
+
 	return claims, nil
 }
 
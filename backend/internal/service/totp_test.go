@@ -0,0 +1,75 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B, sha1 seed "12345678901234567890"
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	t.Run("RFC 6238 test vectors", func(t *testing.T) {
+		vectors := map[int64]string{
+			59:         "287082",
+			1111111109: "081804",
+			1234567890: "005924",
+			2000000000: "279037",
+		}
+
+		for unix, expected := range vectors {
+			code, err := totpCode(secret, unix/totpPeriod)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, code)
+		}
+	})
+
+	t.Run("Accepts previous step and rejects replay", func(t *testing.T) {
+		now := time.Unix(1234567890, 0)
+		prev, err := totpCode(secret, now.Unix()/totpPeriod-1)
+		assert.NoError(t, err)
+
+		step, ok := validateTOTP(secret, prev, now, 0)
+		assert.True(t, ok)
+		assert.Equal(t, now.Unix()/totpPeriod-1, step)
+
+		_, ok = validateTOTP(secret, prev, now, step)
+		assert.False(t, ok)
+	})
+
+	t.Run("Rejects code out of window", func(t *testing.T) {
+		now := time.Unix(1234567890, 0)
+		old, err := totpCode(secret, now.Unix()/totpPeriod-2)
+		assert.NoError(t, err)
+
+		_, ok := validateTOTP(secret, old, now, 0)
+		assert.False(t, ok)
+	})
+
+	t.Run("Key uri", func(t *testing.T) {
+		uri := totpURI("Go TDS", "bob@bob.com", secret)
+
+		assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Go%20TDS:bob@bob.com?"))
+		assert.Contains(t, uri, "secret="+secret)
+	})
+}
+
+func TestSecretBox(t *testing.T) {
+	key := make([]byte, 32)
+
+	encrypted, err := encryptSecret(key, "totp-secret")
+	assert.NoError(t, err)
+	assert.NotContains(t, encrypted, "totp-secret")
+
+	decrypted, err := decryptSecret(key, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "totp-secret", decrypted)
+
+	otherKey := make([]byte, 32)
+	otherKey[0] = 1
+	_, err = decryptSecret(otherKey, encrypted)
+	assert.Error(t, err)
+}
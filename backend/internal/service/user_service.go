@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/Kara4ev/go-web-tmp/internal/model"
 	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
@@ -9,17 +11,94 @@ import (
 	"github.com/google/uuid"
 )
 
+// mailTimeout bounds the mails sent in the background
+const mailTimeout = time.Minute
+
 type userService struct {
-	UserRepository model.UserRepository
+	UserRepository           model.UserRepository
+	TokenRepository          model.TokenRepository
+	MailSender               model.MailSender
+	RequireEmailVerification bool
+	VerifyEmailURL           string
+	VerifyEmailExpiration    time.Duration
+	ResetPasswordURL         string
+	ResetPasswordExpiration  time.Duration
+	IDTokenExpiration        time.Duration
+	SigninLimiter            *signinLimiter
+	MFARepository            model.MFARepository
+	PasswordPolicy           *passwordPolicy
+	DeletionGracePeriod      time.Duration
+	SecurityEventRepository  model.SecurityEventRepository
 }
 
 type USConfig struct {
-	UserRepository model.UserRepository
+	UserRepository  model.UserRepository
+	TokenRepository model.TokenRepository
+	MailSender      model.MailSender
+	// RequireEmailVerification refuses Signin until the email address is verified
+	RequireEmailVerification bool
+	// VerifyEmailURL is a format string with a single %s for the verification token
+	VerifyEmailURL            string
+	VerifyEmailExpirationSecs int64
+	// ResetPasswordURL is a format string with a single %s for the reset token
+	ResetPasswordURL            string
+	ResetPasswordExpirationSecs int64
+	// IDTokenExpirationSecs is how long id tokens of revoked sessions are denied
+	IDTokenExpirationSecs int64
+
+	// LoginAttemptRepository enables the signin lockout, an email is locked out
+	// after SigninMaxFailures failures within SigninFailureWindowSecs, an ip after
+	// SigninIPMaxFailures. Zero max failures disable the lockout of that key
+	LoginAttemptRepository  model.LoginAttemptRepository
+	SigninMaxFailures       int64
+	SigninIPMaxFailures     int64
+	SigninFailureWindowSecs int64
+	SigninLockoutSecs       int64
+	// MFARepository keeps the failures of an email with totp enabled after the password
+	// matched, they are reset when the challenge passed, see MFAConfig
+	MFARepository model.MFARepository
+
+	// password policy of Signup, ResetPassword and ChangePassword, zero values
+	// disable a rule. Strength is scored from 0 to 4. BreachedPasswordRepository
+	// refuses passwords of known breaches when set
+	PasswordMinLength          int
+	PasswordMaxLength          int
+	PasswordMinStrength        int
+	BreachedPasswordRepository model.BreachedPasswordRepository
+
+	// DeletionGracePeriodSecs is how long a deleted account can be
+	// reactivated by signin before it is purged
+	DeletionGracePeriodSecs int64
+
+	// SecurityEventRepository records failed signins and account changes
+	// in the audit log of the user, nil disables it
+	SecurityEventRepository model.SecurityEventRepository
 }
 
 func NewUserServices(c *USConfig) model.UserService {
+	limiter := newSigninLimiter(c.LoginAttemptRepository, c.SigninMaxFailures, c.SigninIPMaxFailures,
+		c.SigninFailureWindowSecs, c.SigninLockoutSecs)
+
 	return &userService{
-		UserRepository: c.UserRepository,
+		UserRepository:           c.UserRepository,
+		TokenRepository:          c.TokenRepository,
+		MailSender:               c.MailSender,
+		RequireEmailVerification: c.RequireEmailVerification,
+		VerifyEmailURL:           c.VerifyEmailURL,
+		VerifyEmailExpiration:    time.Duration(c.VerifyEmailExpirationSecs) * time.Second,
+		ResetPasswordURL:         c.ResetPasswordURL,
+		ResetPasswordExpiration:  time.Duration(c.ResetPasswordExpirationSecs) * time.Second,
+		IDTokenExpiration:        time.Duration(c.IDTokenExpirationSecs) * time.Second,
+		SigninLimiter:            limiter,
+		MFARepository:            c.MFARepository,
+		PasswordPolicy: &passwordPolicy{
+			minLength:   c.PasswordMinLength,
+			maxLength:   c.PasswordMaxLength,
+			minStrength: c.PasswordMinStrength,
+			breached:    c.BreachedPasswordRepository,
+		},
+		DeletionGracePeriod:     time.Duration(c.DeletionGracePeriodSecs) * time.Second,
+		SecurityEventRepository: c.SecurityEventRepository,
 	}
 }
 
@@ -30,6 +109,10 @@ func (s userService) Get(ctx context.Context, uid uuid.UUID) (*model.User, error
 
 func (s userService) Signup(ctx context.Context, u *model.User) error {
 
+	if err := s.PasswordPolicy.check(ctx, "password", u.Password, u.Email); err != nil {
+		return err
+	}
+
 	pw, err := hashPassword(u.Password)
 
 	if err != nil {
@@ -38,19 +121,38 @@ func (s userService) Signup(ctx context.Context, u *model.User) error {
 	}
 
 	u.Password = pw
+	u.Status = model.UserStatusActive
+	if s.RequireEmailVerification {
+		u.Status = model.UserStatusPendingVerification
+	}
 
 	if err := s.UserRepository.Create(ctx, u); err != nil {
 		return err
 	}
 
+	// the account is already created, the user can ask for a new mail
+	if err := s.sendVerification(ctx, u); err != nil {
+		logger.Warn("unable to send verification email to: %s, err: %v", u.Email, err)
+	}
+
 	return nil
 }
 
-func (s userService) Signin(ctx context.Context, u *model.User) error {
+// Signin checks the password of the user. Failed attempts
+// are counted by email and by ip, the client address
+func (s userService) Signin(ctx context.Context, u *model.User, ip string) error {
+	now := time.Now()
+	if s.SigninLimiter != nil {
+		if err := s.SigninLimiter.check(ctx, u.Email, ip, now); err != nil {
+			return err
+		}
+	}
+
 	uFetched, err := s.UserRepository.FindByEmail(ctx, u.Email)
 	errAuthorization := apperrors.NewAuthorization("invalid email and password combination")
 	if err != nil {
 		logger.Warn("user search error by mail: %s, err: %v", u.Email, err)
+		s.signinFailed(ctx, u.Email, ip, now)
 		return errAuthorization
 	}
 
@@ -63,14 +165,446 @@ func (s userService) Signin(ctx context.Context, u *model.User) error {
 
 	if !match {
 		logger.Warn("invalid password, user email: %s", u.Email)
+		locked := s.signinFailed(ctx, u.Email, ip, now)
+		recordEvent(ctx, s.SecurityEventRepository, uFetched.UID, model.EventSigninFailed, &model.SessionClient{IP: ip})
+		if locked {
+			recordEvent(ctx, s.SecurityEventRepository, uFetched.UID, model.EventAccountLocked, &model.SessionClient{IP: ip})
+		}
 		return errAuthorization
 	}
 
+	if s.SigninLimiter != nil && !s.secondFactor(ctx, uFetched.UID) {
+		s.SigninLimiter.succeed(ctx, u.Email)
+	}
+
+	switch uFetched.Status {
+	case model.UserStatusSuspended:
+		logger.Warn("signin of suspended account, email: %s", u.Email)
+		return apperrors.NewForbidden("account is suspended")
+	case model.UserStatusDeleted:
+		if uFetched.DeletedAt == nil || !now.Before(uFetched.DeletedAt.Add(s.DeletionGracePeriod)) {
+			logger.Warn("signin of deleted account, email: %s", u.Email)
+			return errAuthorization
+		}
+
+		if err := s.UserRepository.CancelDeletion(ctx, uFetched.UID); err != nil {
+			return err
+		}
+
+		logger.Info("account reactivated by signin within the deletion grace period, uid: %s", uFetched.UID.String())
+		uFetched.Status = model.UserStatusActive
+		uFetched.DeletedAt = nil
+	}
+
+	if (s.RequireEmailVerification && !uFetched.EmailVerified) || uFetched.Status == model.UserStatusPendingVerification {
+		logger.Warn("signin with unverified email: %s", u.Email)
+		return apperrors.NewForbidden("email address is not verified")
+	}
+
 	*u = *uFetched
 	return nil
 
 }
 
+// secondFactor reports whether the signin continues with a totp challenge,
+// when it can not be told the failures are kept like with a challenge
+func (s userService) secondFactor(ctx context.Context, uid uuid.UUID) bool {
+	if s.MFARepository == nil {
+		return false
+	}
+
+	enabled, err := totpEnabled(ctx, s.MFARepository, uid)
+	if err != nil {
+		logger.Warn("unable to get totp of uid: %s, err: %v", uid.String(), err)
+		return true
+	}
+	return enabled
+}
+
+// signinFailed counts the failure, it reports whether the email was locked out
+func (s userService) signinFailed(ctx context.Context, email, ip string, now time.Time) bool {
+	if s.SigninLimiter == nil {
+		return false
+	}
+	return s.SigninLimiter.fail(ctx, email, ip, now)
+}
+
 func (s *userService) UpdateDetails(ctx context.Context, u *model.User) error {
 	return s.UserRepository.Update(ctx, u)
 }
+
+func (s *userService) VerifyEmail(ctx context.Context, token string) error {
+	errInvalidToken := apperrors.NewBadRequest("invalid or expired verification token")
+
+	userID, err := s.TokenRepository.ConsumeOneTimeToken(ctx, purposeVerifyEmail, hashOneTimeToken(token))
+	if err != nil {
+		logger.Warn("unable to consume verification token, err: %v", err)
+		return errInvalidToken
+	}
+
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		logger.Warn("verification token holds invalid uid: %s, err: %v", userID, err)
+		return errInvalidToken
+	}
+
+	if err := s.UserRepository.SetEmailVerified(ctx, uid); err != nil {
+		return err
+	}
+
+	recordEvent(ctx, s.SecurityEventRepository, uid, model.EventEmailVerified, nil)
+	return nil
+}
+
+// ResendVerification sends a new verification email. It does not report
+// whether the account exists or is already verified
+func (s *userService) ResendVerification(ctx context.Context, email string) error {
+	u, err := s.UserRepository.FindByEmail(ctx, email)
+	if err != nil {
+		logger.Warn("resend verification for unknown email: %s", email)
+		return nil
+	}
+
+	if u.EmailVerified {
+		logger.Debug("resend verification for verified email: %s", email)
+		return nil
+	}
+
+	if err := s.sendVerification(ctx, u); err != nil {
+		logger.Warn("unable to send verification email to: %s, err: %v", email, err)
+		return apperrors.NewInternal()
+	}
+
+	return nil
+}
+
+// ForgotPassword mails a one time reset link. It does not report
+// whether the account exists
+func (s *userService) ForgotPassword(ctx context.Context, email string) error {
+	u, err := s.UserRepository.FindByEmail(ctx, email)
+	if err != nil {
+		logger.Warn("forgot password for unknown email: %s", email)
+		return nil
+	}
+
+	// the mail is sent in the background, known and unknown emails
+	// get the same response just as fast
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		body := "To set a new password follow the link: %s\n\nThe link expires in %v. If you did not ask to reset your password, ignore this email."
+		if err := s.sendPasswordReset(ctx, u, body); err != nil {
+			logger.Warn("forgot password email not sent to: %s, err: %v", email, err)
+		}
+	}()
+
+	return nil
+}
+
+// ResetPassword sets a new password by a reset token
+// and signs out every session of the user
+func (s *userService) ResetPassword(ctx context.Context, token, password string) error {
+	errInvalidToken := apperrors.NewBadRequest("invalid or expired reset password token")
+
+	// the token is consumed after the password passed the policy,
+	// so the user can choose another password with the same mail
+	userID, err := s.TokenRepository.GetOneTimeToken(ctx, purposeResetPassword, hashOneTimeToken(token))
+	if err != nil {
+		logger.Warn("unable to get reset password token, err: %v", err)
+		return errInvalidToken
+	}
+
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		logger.Warn("reset password token holds invalid uid: %s, err: %v", userID, err)
+		return errInvalidToken
+	}
+
+	u, err := s.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	if err := s.PasswordPolicy.check(ctx, "password", password, u.Email); err != nil {
+		return err
+	}
+
+	consumedID, err := s.TokenRepository.ConsumeOneTimeToken(ctx, purposeResetPassword, hashOneTimeToken(token))
+	if err != nil || consumedID != userID {
+		logger.Warn("unable to consume reset password token, err: %v", err)
+		return errInvalidToken
+	}
+
+	pw, err := hashPassword(password)
+	if err != nil {
+		logger.Warn("unable to hash password for uid: %s", userID)
+		return apperrors.NewInternal()
+	}
+
+	if err := s.UserRepository.UpdatePassword(ctx, uid, pw); err != nil {
+		return err
+	}
+
+	if _, err := revokeUserSessions(ctx, s.TokenRepository, userID, s.IDTokenExpiration); err != nil {
+		logger.Warn("unable to revoke sessions after password reset for uid: %s, err: %v", userID, err)
+		return err
+	}
+
+	recordEvent(ctx, s.SecurityEventRepository, uid, model.EventPasswordReset, nil)
+	return nil
+}
+
+// ChangePassword sets a new password for the signed in user after checking
+// the current one. Every session but sid, the one of the request, is signed out
+func (s *userService) ChangePassword(ctx context.Context, uid uuid.UUID, sid, currentPassword, newPassword string) error {
+	u, err := s.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	match, err := comparePassword(u.Password, currentPassword)
+	if err != nil {
+		logger.Error("error compare password, user uid: %s", uid.String())
+		return apperrors.NewInternal()
+	}
+
+	if !match {
+		logger.Warn("invalid current password, user uid: %s", uid.String())
+		return apperrors.NewAuthorization("invalid current password")
+	}
+
+	if err := s.PasswordPolicy.check(ctx, "new_password", newPassword, u.Email); err != nil {
+		return err
+	}
+
+	pw, err := hashPassword(newPassword)
+	if err != nil {
+		logger.Warn("unable to hash password for uid: %s", uid.String())
+		return apperrors.NewInternal()
+	}
+
+	if err := s.UserRepository.UpdatePassword(ctx, uid, pw); err != nil {
+		return err
+	}
+
+	if _, err := revokeOtherUserSessions(ctx, s.TokenRepository, uid.String(), sid, s.IDTokenExpiration); err != nil {
+		logger.Warn("unable to revoke sessions after password change for uid: %s, err: %v", uid.String(), err)
+		return err
+	}
+
+	recordEvent(ctx, s.SecurityEventRepository, uid, model.EventPasswordChanged, nil)
+	return nil
+}
+
+// DeleteAccount deletes the account of the user after checking the password. Every session
+// is signed out, the account is purged when the grace period is over, returned is when
+func (s *userService) DeleteAccount(ctx context.Context, uid uuid.UUID, password string) (time.Time, error) {
+	u, err := s.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	match, err := comparePassword(u.Password, password)
+	if err != nil {
+		logger.Error("error compare password, user uid: %s", uid.String())
+		return time.Time{}, apperrors.NewInternal()
+	}
+
+	if !match {
+		logger.Warn("invalid password for account deletion, user uid: %s", uid.String())
+		return time.Time{}, apperrors.NewAuthorization("invalid password")
+	}
+
+	now := time.Now()
+	if err := s.UserRepository.ScheduleDeletion(ctx, uid, now); err != nil {
+		return time.Time{}, err
+	}
+
+	if _, err := revokeUserSessions(ctx, s.TokenRepository, uid.String(), s.IDTokenExpiration); err != nil {
+		logger.Warn("unable to revoke sessions of deleted account uid: %s, err: %v", uid.String(), err)
+		return time.Time{}, err
+	}
+
+	recordEvent(ctx, s.SecurityEventRepository, uid, model.EventAccountDeleted, nil)
+	logger.Info("account deleted by the user, uid: %s, purged after: %v", uid.String(), s.DeletionGracePeriod)
+	return now.Add(s.DeletionGracePeriod), nil
+}
+
+// PurgeDeletedAccounts deletes the accounts whose grace period is over
+func (s *userService) PurgeDeletedAccounts(ctx context.Context) (int64, error) {
+	return s.UserRepository.PurgeDeleted(ctx, time.Now().Add(-s.DeletionGracePeriod))
+}
+
+// defaults of the admin user list
+const (
+	defaultUserListLimit = 20
+	maxUserListLimit     = 100
+)
+
+// ListUsers returns a page of the users selected by the filter and the number
+// of all selected users, the limit and offset of the filter are set to the ones used
+func (s *userService) ListUsers(ctx context.Context, f *model.UserFilter) ([]*model.User, int64, error) {
+	if f.Limit <= 0 {
+		f.Limit = defaultUserListLimit
+	}
+	if f.Limit > maxUserListLimit {
+		f.Limit = maxUserListLimit
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+
+	return s.UserRepository.List(ctx, f)
+}
+
+// UpdateUser changes the fields of the user set in upd. A new email is
+// not verified unless upd says so
+func (s *userService) UpdateUser(ctx context.Context, uid uuid.UUID, upd *model.UserUpdate) (*model.User, error) {
+	u, err := s.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if upd.Name != nil {
+		u.Name = *upd.Name
+	}
+
+	if upd.Email != nil && *upd.Email != u.Email {
+		u.Email = *upd.Email
+		u.EmailVerified = false
+	}
+
+	if upd.ImageURL != nil {
+		u.ImageURL = *upd.ImageURL
+	}
+
+	if upd.EmailVerified != nil {
+		u.EmailVerified = *upd.EmailVerified
+	}
+
+	if err := s.UserRepository.Save(ctx, u); err != nil {
+		return nil, err
+	}
+
+	recordEvent(ctx, s.SecurityEventRepository, uid, model.EventAccountUpdatedByAdmin, nil)
+	return u, nil
+}
+
+// ForcePasswordReset replaces the password of the user by a random one, signs out
+// every session and mails a reset link, the user has to set a new password
+func (s *userService) ForcePasswordReset(ctx context.Context, uid uuid.UUID) error {
+	u, err := s.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	random, _, err := generateOneTimeToken()
+	if err != nil {
+		logger.Warn("unable to generate password for uid: %s, err: %v", uid.String(), err)
+		return apperrors.NewInternal()
+	}
+
+	pw, err := hashPassword(random)
+	if err != nil {
+		logger.Warn("unable to hash password for uid: %s", uid.String())
+		return apperrors.NewInternal()
+	}
+
+	if err := s.UserRepository.UpdatePassword(ctx, uid, pw); err != nil {
+		return err
+	}
+
+	if _, err := revokeUserSessions(ctx, s.TokenRepository, uid.String(), s.IDTokenExpiration); err != nil {
+		logger.Warn("unable to revoke sessions after forced password reset for uid: %s, err: %v", uid.String(), err)
+		return err
+	}
+
+	recordEvent(ctx, s.SecurityEventRepository, uid, model.EventPasswordResetByAdmin, nil)
+
+	body := "Your password was reset by an administrator. To set a new password follow the link: %s\n\nThe link expires in %v."
+	return s.sendPasswordReset(ctx, u, body)
+}
+
+// Suspend refuses signin to the user and signs out every session
+func (s *userService) Suspend(ctx context.Context, uid uuid.UUID) error {
+	if err := s.UserRepository.SetStatus(ctx, uid, model.UserStatusSuspended); err != nil {
+		return err
+	}
+
+	if _, err := revokeUserSessions(ctx, s.TokenRepository, uid.String(), s.IDTokenExpiration); err != nil {
+		logger.Warn("unable to revoke sessions of suspended uid: %s, err: %v", uid.String(), err)
+		return err
+	}
+
+	recordEvent(ctx, s.SecurityEventRepository, uid, model.EventAccountSuspended, nil)
+	return nil
+}
+
+// Unsuspend activates a suspended user, accounts of other statuses are not changed
+func (s *userService) Unsuspend(ctx context.Context, uid uuid.UUID) error {
+	u, err := s.UserRepository.FindByID(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	if u.Status != model.UserStatusSuspended {
+		return apperrors.NewBadRequest("user is not suspended")
+	}
+
+	if err := s.UserRepository.SetStatus(ctx, uid, model.UserStatusActive); err != nil {
+		return err
+	}
+
+	recordEvent(ctx, s.SecurityEventRepository, uid, model.EventAccountUnsuspended, nil)
+	return nil
+}
+
+// Delete signs out every session of the user and deletes the account
+func (s *userService) Delete(ctx context.Context, uid uuid.UUID) error {
+	if _, err := revokeUserSessions(ctx, s.TokenRepository, uid.String(), s.IDTokenExpiration); err != nil {
+		logger.Warn("unable to revoke sessions of deleted uid: %s, err: %v", uid.String(), err)
+		return err
+	}
+
+	return s.UserRepository.Delete(ctx, uid)
+}
+
+// sendPasswordReset mails a one time reset link, body is a format string
+// with the link and the expiration
+func (s *userService) sendPasswordReset(ctx context.Context, u *model.User, body string) error {
+	token, tokenHash, err := generateOneTimeToken()
+	if err != nil {
+		logger.Warn("unable to generate reset password token for: %s, err: %v", u.Email, err)
+		return apperrors.NewInternal()
+	}
+
+	if err := s.TokenRepository.SetOneTimeToken(ctx, purposeResetPassword, tokenHash, u.UID.String(), s.ResetPasswordExpiration); err != nil {
+		return err
+	}
+
+	body = fmt.Sprintf(body, fmt.Sprintf(s.ResetPasswordURL, token), s.ResetPasswordExpiration)
+
+	if err := s.MailSender.Send(ctx, u.Email, "Reset your password", body); err != nil {
+		logger.Warn("unable to send reset password email to: %s, err: %v", u.Email, err)
+		return apperrors.NewInternal()
+	}
+
+	return nil
+}
+
+func (s *userService) sendVerification(ctx context.Context, u *model.User) error {
+	token, tokenHash, err := generateOneTimeToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.TokenRepository.SetOneTimeToken(ctx, purposeVerifyEmail, tokenHash, u.UID.String(), s.VerifyEmailExpiration); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Please confirm your email address by following the link: %s\n\nThe link expires in %v.",
+		fmt.Sprintf(s.VerifyEmailURL, token), s.VerifyEmailExpiration)
+
+	return s.MailSender.Send(ctx, u.Email, "Confirm your email address", body)
+}
@@ -3,7 +3,9 @@ package service
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/Kara4ev/go-web-tmp/internal/model"
 	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
@@ -72,8 +74,13 @@ func TestSignup(t *testing.T) {
 		}
 
 		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		mockMailSender := new(mocks.MockMailSender)
 		us := NewUserServices(&USConfig{
-			UserRepository: mockUserRepository,
+			UserRepository:  mockUserRepository,
+			TokenRepository: mockTokenRepository,
+			MailSender:      mockMailSender,
+			VerifyEmailURL:  "http://test/verify?token=%s",
 		})
 
 		mockUserRepository.
@@ -84,15 +91,53 @@ func TestSignup(t *testing.T) {
 			}).
 			Return(nil)
 
+		mockTokenRepository.
+			On("SetOneTimeToken", mock.Anything, purposeVerifyEmail, mock.AnythingOfType("string"), uid.String(), mock.AnythingOfType("time.Duration")).
+			Return(nil)
+
+		mockMailSender.
+			On("Send", mock.Anything, mockUser.Email, mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+			Return(nil)
+
 		ctx := context.TODO()
 		err := us.Signup(ctx, mockUser)
 
 		assert.NoError(t, err)
 		assert.Equal(t, uid, mockUser.UID)
+		assert.Equal(t, model.UserStatusActive, mockUser.Status)
 		mockUserRepository.AssertExpectations(t)
+		mockTokenRepository.AssertExpectations(t)
+		mockMailSender.AssertExpectations(t)
 
 	})
 
+	t.Run("Pending verification", func(t *testing.T) {
+		mockUser := &model.User{
+			Email:    "correct@email.com",
+			Password: "correct-password",
+		}
+
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		mockMailSender := new(mocks.MockMailSender)
+		us := NewUserServices(&USConfig{
+			UserRepository:           mockUserRepository,
+			TokenRepository:          mockTokenRepository,
+			MailSender:               mockMailSender,
+			RequireEmailVerification: true,
+			VerifyEmailURL:           "http://test/verify?token=%s",
+		})
+
+		mockUserRepository.On("Create", mock.Anything, mockUser).Return(nil)
+		mockTokenRepository.On("SetOneTimeToken", mock.Anything, purposeVerifyEmail, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		mockMailSender.On("Send", mock.Anything, mockUser.Email, mock.Anything, mock.Anything).Return(nil)
+
+		err := us.Signup(context.TODO(), mockUser)
+
+		assert.NoError(t, err)
+		assert.Equal(t, model.UserStatusPendingVerification, mockUser.Status)
+	})
+
 	t.Run("Error", func(t *testing.T) {
 		mockUser := &model.User{
 			Email:    "correct@email.com",
@@ -151,7 +196,7 @@ func TestSignin(t *testing.T) {
 		})
 
 		ctx := context.TODO()
-		err := us.Signin(ctx, mockUser)
+		err := us.Signin(ctx, mockUser, "127.0.0.1")
 		assert.NoError(t, err)
 		mockUserRepository.AssertExpectations(t)
 	})
@@ -176,7 +221,7 @@ func TestSignin(t *testing.T) {
 		})
 
 		ctx := context.TODO()
-		err := us.Signin(ctx, mockUser)
+		err := us.Signin(ctx, mockUser, "127.0.0.1")
 		assert.IsType(t, errAuthorization, err)
 		mockUserRepository.AssertExpectations(t)
 	})
@@ -201,14 +246,21 @@ func TestSignin(t *testing.T) {
 			On("FindByEmail", mock.AnythingOfType("*context.emptyCtx"), mockEmail).
 			Return(mockFetchUser, nil)
 
+		mockSecurityEventRepository := new(mocks.MockSecurityEventRepository)
+		mockSecurityEventRepository.On("Create", mock.Anything, mock.MatchedBy(func(e *model.SecurityEvent) bool {
+			return e.UID == mockFetchUser.UID && e.Type == model.EventSigninFailed && e.IP == "127.0.0.1"
+		})).Return(nil)
+
 		us := NewUserServices(&USConfig{
-			UserRepository: mockUserRepository,
+			UserRepository:          mockUserRepository,
+			SecurityEventRepository: mockSecurityEventRepository,
 		})
 
 		ctx := context.TODO()
-		err := us.Signin(ctx, mockUser)
+		err := us.Signin(ctx, mockUser, "127.0.0.1")
 		assert.IsType(t, errAuthorization, err)
 		mockUserRepository.AssertExpectations(t)
+		mockSecurityEventRepository.AssertExpectations(t)
 	})
 
 	t.Run("Error -> incorrect hash password", func(t *testing.T) {
@@ -235,9 +287,731 @@ func TestSignin(t *testing.T) {
 		})
 
 		ctx := context.TODO()
-		err := us.Signin(ctx, mockUser)
+		err := us.Signin(ctx, mockUser, "127.0.0.1")
 		assert.IsType(t, errInternal, err)
 		mockUserRepository.AssertExpectations(t)
 	})
 
 }
+
+func TestVerifyEmail(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		token := "verification-token"
+
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		us := NewUserServices(&USConfig{
+			UserRepository:  mockUserRepository,
+			TokenRepository: mockTokenRepository,
+		})
+
+		mockTokenRepository.
+			On("ConsumeOneTimeToken", mock.Anything, purposeVerifyEmail, hashOneTimeToken(token)).
+			Return(uid.String(), nil)
+		mockUserRepository.On("SetEmailVerified", mock.Anything, uid).Return(nil)
+
+		err := us.VerifyEmail(context.TODO(), token)
+
+		assert.NoError(t, err)
+		mockTokenRepository.AssertExpectations(t)
+		mockUserRepository.AssertExpectations(t)
+	})
+
+	t.Run("Error -> token consumed or expired", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		us := NewUserServices(&USConfig{
+			UserRepository:  mockUserRepository,
+			TokenRepository: mockTokenRepository,
+		})
+
+		mockTokenRepository.
+			On("ConsumeOneTimeToken", mock.Anything, purposeVerifyEmail, mock.AnythingOfType("string")).
+			Return("", apperrors.NewNotFound(purposeVerifyEmail, "token"))
+
+		err := us.VerifyEmail(context.TODO(), "used-token")
+
+		assert.Error(t, err)
+		assert.Equal(t, apperrors.BadRequest, err.(*apperrors.Error).Type)
+		mockUserRepository.AssertNotCalled(t, "SetEmailVerified", mock.Anything, mock.Anything)
+	})
+}
+
+func TestResendVerification(t *testing.T) {
+	email := "bob@bob.com"
+
+	t.Run("Unverified user gets a mail", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		mockMailSender := new(mocks.MockMailSender)
+		us := NewUserServices(&USConfig{
+			UserRepository:  mockUserRepository,
+			TokenRepository: mockTokenRepository,
+			MailSender:      mockMailSender,
+			VerifyEmailURL:  "http://test/verify?token=%s",
+		})
+
+		var sentBody string
+		mockUserRepository.On("FindByEmail", mock.Anything, email).Return(&model.User{UID: uid, Email: email}, nil)
+		mockTokenRepository.
+			On("SetOneTimeToken", mock.Anything, purposeVerifyEmail, mock.AnythingOfType("string"), uid.String(), mock.AnythingOfType("time.Duration")).
+			Return(nil)
+		mockMailSender.
+			On("Send", mock.Anything, email, mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+			Run(func(args mock.Arguments) {
+				sentBody = args.String(3)
+			}).
+			Return(nil)
+
+		err := us.ResendVerification(context.TODO(), email)
+
+		assert.NoError(t, err)
+		assert.Contains(t, sentBody, "http://test/verify?token=")
+		mockMailSender.AssertExpectations(t)
+	})
+
+	t.Run("Verified user does not get a mail", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockMailSender := new(mocks.MockMailSender)
+		us := NewUserServices(&USConfig{
+			UserRepository: mockUserRepository,
+			MailSender:     mockMailSender,
+		})
+
+		mockUserRepository.On("FindByEmail", mock.Anything, email).Return(&model.User{Email: email, EmailVerified: true}, nil)
+
+		err := us.ResendVerification(context.TODO(), email)
+
+		assert.NoError(t, err)
+		mockMailSender.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Unknown email is not reported", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		us := NewUserServices(&USConfig{
+			UserRepository: mockUserRepository,
+		})
+
+		mockUserRepository.On("FindByEmail", mock.Anything, email).Return(nil, fmt.Errorf("not found"))
+
+		err := us.ResendVerification(context.TODO(), email)
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		token := "reset-token"
+		newPassword := "new-password"
+
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		us := NewUserServices(&USConfig{
+			UserRepository:        mockUserRepository,
+			TokenRepository:       mockTokenRepository,
+			IDTokenExpirationSecs: 900,
+		})
+
+		var storedHash string
+		mockTokenRepository.
+			On("GetOneTimeToken", mock.Anything, purposeResetPassword, hashOneTimeToken(token)).
+			Return(uid.String(), nil)
+		mockUserRepository.On("FindByID", mock.Anything, uid).Return(&model.User{UID: uid, Email: "bob@bob.com"}, nil)
+		mockTokenRepository.
+			On("ConsumeOneTimeToken", mock.Anything, purposeResetPassword, hashOneTimeToken(token)).
+			Return(uid.String(), nil)
+		mockUserRepository.
+			On("UpdatePassword", mock.Anything, uid, mock.AnythingOfType("string")).
+			Run(func(args mock.Arguments) {
+				storedHash = args.String(2)
+			}).
+			Return(nil)
+		mockTokenRepository.On("ListSessions", mock.Anything, uid.String()).Return([]*model.Session{{ID: "laptop"}, {ID: "phone"}}, nil)
+		mockTokenRepository.On("DeleteUserRefreshToken", mock.Anything, uid.String()).Return(nil)
+		mockTokenRepository.On("DenyTokens", mock.Anything, []string{"laptop", "phone"}, 900*time.Second).Return(nil)
+
+		err := us.ResetPassword(context.TODO(), token, newPassword)
+		assert.NoError(t, err)
+		mockTokenRepository.AssertExpectations(t)
+
+		match, err := comparePassword(storedHash, newPassword)
+		assert.NoError(t, err)
+		assert.True(t, match)
+
+		mockUserRepository.AssertExpectations(t)
+		mockTokenRepository.AssertExpectations(t)
+	})
+
+	t.Run("Error -> invalid token", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		us := NewUserServices(&USConfig{
+			UserRepository:  mockUserRepository,
+			TokenRepository: mockTokenRepository,
+		})
+
+		mockTokenRepository.
+			On("GetOneTimeToken", mock.Anything, purposeResetPassword, mock.AnythingOfType("string")).
+			Return("", apperrors.NewNotFound(purposeResetPassword, "token"))
+
+		err := us.ResetPassword(context.TODO(), "invalid-token", "new-password")
+
+		assert.Error(t, err)
+		assert.Equal(t, apperrors.BadRequest, err.(*apperrors.Error).Type)
+		mockUserRepository.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+		mockTokenRepository.AssertNotCalled(t, "DeleteUserRefreshToken", mock.Anything, mock.Anything)
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	uid, _ := uuid.NewRandom()
+	hash := "2232269800b344a31f9a5b5ca6c91775dc30c5d856d1a89c011076c6437236a5.52fdfc072182654f163f5f0f9a621d729566c74d10037c4d7bbb0407d1e2c649"
+
+	t.Run("Success", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		mockSecurityEventRepository := new(mocks.MockSecurityEventRepository)
+		us := NewUserServices(&USConfig{
+			UserRepository:          mockUserRepository,
+			TokenRepository:         mockTokenRepository,
+			IDTokenExpirationSecs:   900,
+			SecurityEventRepository: mockSecurityEventRepository,
+		})
+
+		// every session but the current one is signed out
+		mockTokenRepository.On("ListSessions", mock.Anything, uid.String()).Return([]*model.Session{
+			{ID: "current-sid", TokenID: "current-token"},
+			{ID: "other-sid", TokenID: "other-token"},
+		}, nil)
+		mockTokenRepository.On("DeleteRefreshToken", mock.Anything, uid.String(), "other-token").Return(&model.Session{ID: "other-sid"}, nil)
+		mockTokenRepository.On("DenyTokens", mock.Anything, []string{"other-sid"}, 900*time.Second).Return(nil)
+
+		mockUserRepository.On("FindByID", mock.Anything, uid).Return(&model.User{UID: uid, Email: "bob@bob.com", Password: hash}, nil)
+		mockUserRepository.On("UpdatePassword", mock.Anything, uid, mock.MatchedBy(func(pw string) bool {
+			match, err := comparePassword(pw, "Tr0ub4dor&3-new")
+			return err == nil && match
+		})).Return(nil)
+		mockSecurityEventRepository.On("Create", mock.Anything, mock.MatchedBy(func(e *model.SecurityEvent) bool {
+			return e.UID == uid && e.Type == model.EventPasswordChanged
+		})).Return(nil)
+
+		err := us.ChangePassword(context.TODO(), uid, "current-sid", "correct-password", "Tr0ub4dor&3-new")
+
+		assert.NoError(t, err)
+		mockUserRepository.AssertExpectations(t)
+		mockTokenRepository.AssertExpectations(t)
+		mockTokenRepository.AssertNotCalled(t, "DeleteRefreshToken", mock.Anything, uid.String(), "current-token")
+		mockSecurityEventRepository.AssertExpectations(t)
+	})
+
+	t.Run("Wrong current password", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		us := NewUserServices(&USConfig{
+			UserRepository: mockUserRepository,
+		})
+
+		mockUserRepository.On("FindByID", mock.Anything, uid).Return(&model.User{UID: uid, Email: "bob@bob.com", Password: hash}, nil)
+
+		err := us.ChangePassword(context.TODO(), uid, "current-sid", "wrong-password", "Tr0ub4dor&3-new")
+
+		assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+		mockUserRepository.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestForgotPassword(t *testing.T) {
+	t.Run("Unknown email is not reported", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockMailSender := new(mocks.MockMailSender)
+		us := NewUserServices(&USConfig{
+			UserRepository: mockUserRepository,
+			MailSender:     mockMailSender,
+		})
+
+		mockUserRepository.On("FindByEmail", mock.Anything, "nobody@bob.com").Return(nil, fmt.Errorf("not found"))
+
+		err := us.ForgotPassword(context.TODO(), "nobody@bob.com")
+
+		assert.NoError(t, err)
+		mockMailSender.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Mail errors of known email are not reported", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		sent := make(chan struct{})
+
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		mockMailSender := new(mocks.MockMailSender)
+		us := NewUserServices(&USConfig{
+			UserRepository:   mockUserRepository,
+			TokenRepository:  mockTokenRepository,
+			MailSender:       mockMailSender,
+			ResetPasswordURL: "https://app.test/reset?token=%s",
+		})
+
+		mockUserRepository.On("FindByEmail", mock.Anything, "bob@bob.com").Return(&model.User{UID: uid, Email: "bob@bob.com"}, nil)
+		mockTokenRepository.On("SetOneTimeToken", mock.Anything, purposeResetPassword, mock.Anything, uid.String(), mock.Anything).Return(nil)
+		mockMailSender.
+			On("Send", mock.Anything, "bob@bob.com", "Reset your password", mock.Anything).
+			Run(func(mock.Arguments) { close(sent) }).
+			Return(fmt.Errorf("smtp is down"))
+
+		err := us.ForgotPassword(context.TODO(), "bob@bob.com")
+		assert.NoError(t, err)
+
+		// the mail is sent in the background
+		select {
+		case <-sent:
+		case <-time.After(time.Second):
+			t.Fatal("reset password email was not sent")
+		}
+		mockTokenRepository.AssertExpectations(t)
+	})
+}
+
+func TestAdminUsers(t *testing.T) {
+	ctx := context.TODO()
+	uid, _ := uuid.NewRandom()
+
+	newService := func(ur *mocks.MockUserRepository, tr *mocks.MockTokenRepository, ms *mocks.MockMailSender) model.UserService {
+		return NewUserServices(&USConfig{
+			UserRepository:              ur,
+			TokenRepository:             tr,
+			MailSender:                  ms,
+			ResetPasswordURL:            "https://app.test/reset?token=%s",
+			ResetPasswordExpirationSecs: 3600,
+			IDTokenExpirationSecs:       900,
+		})
+	}
+
+	revokes := func(tr *mocks.MockTokenRepository) {
+		tr.On("ListSessions", mock.Anything, uid.String()).Return([]*model.Session{{ID: "laptop"}}, nil)
+		tr.On("DeleteUserRefreshToken", mock.Anything, uid.String()).Return(nil)
+		tr.On("DenyTokens", mock.Anything, []string{"laptop"}, 900*time.Second).Return(nil)
+	}
+
+	t.Run("List clamps the page", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		us := newService(mockUserRepository, nil, nil)
+
+		mockUserRepository.On("List", mock.Anything, &model.UserFilter{Query: "bob", Limit: 100}).Return([]*model.User{}, int64(0), nil)
+
+		f := &model.UserFilter{Query: "bob", Limit: 1000, Offset: -1}
+		_, _, err := us.ListUsers(ctx, f)
+		assert.NoError(t, err)
+		assert.Equal(t, 100, f.Limit)
+		assert.Equal(t, 0, f.Offset)
+
+		f = &model.UserFilter{Query: "bob"}
+		mockUserRepository.On("List", mock.Anything, &model.UserFilter{Query: "bob", Limit: 20}).Return([]*model.User{}, int64(0), nil)
+		_, _, err = us.ListUsers(ctx, f)
+		assert.NoError(t, err)
+		assert.Equal(t, 20, f.Limit)
+	})
+
+	t.Run("Update keeps unset fields", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		us := newService(mockUserRepository, nil, nil)
+
+		mockUserRepository.On("FindByID", mock.Anything, uid).Return(&model.User{UID: uid, Email: "bob@bob.com", Name: "Bob", EmailVerified: true}, nil)
+		mockUserRepository.On("Save", mock.Anything, mock.AnythingOfType("*model.User")).Return(nil)
+
+		name := "Bobby"
+		u, err := us.UpdateUser(ctx, uid, &model.UserUpdate{Name: &name})
+		assert.NoError(t, err)
+		assert.Equal(t, "Bobby", u.Name)
+		assert.Equal(t, "bob@bob.com", u.Email)
+		assert.True(t, u.EmailVerified)
+	})
+
+	t.Run("Update of the email is not verified", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		us := newService(mockUserRepository, nil, nil)
+
+		mockUserRepository.On("FindByID", mock.Anything, uid).Return(&model.User{UID: uid, Email: "bob@bob.com", EmailVerified: true}, nil)
+		mockUserRepository.On("Save", mock.Anything, mock.AnythingOfType("*model.User")).Return(nil)
+
+		email := "new@bob.com"
+		u, err := us.UpdateUser(ctx, uid, &model.UserUpdate{Email: &email})
+		assert.NoError(t, err)
+		assert.Equal(t, email, u.Email)
+		assert.False(t, u.EmailVerified)
+	})
+
+	t.Run("Force password reset", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		mockMailSender := new(mocks.MockMailSender)
+		us := newService(mockUserRepository, mockTokenRepository, mockMailSender)
+
+		mockUserRepository.On("FindByID", mock.Anything, uid).Return(&model.User{UID: uid, Email: "bob@bob.com"}, nil)
+		mockUserRepository.On("UpdatePassword", mock.Anything, uid, mock.AnythingOfType("string")).Return(nil)
+		revokes(mockTokenRepository)
+		mockTokenRepository.On("SetOneTimeToken", mock.Anything, purposeResetPassword, mock.AnythingOfType("string"), uid.String(), time.Hour).Return(nil)
+		mockMailSender.On("Send", mock.Anything, "bob@bob.com", "Reset your password", mock.AnythingOfType("string")).Return(nil)
+
+		err := us.ForcePasswordReset(ctx, uid)
+		assert.NoError(t, err)
+		mockUserRepository.AssertExpectations(t)
+		mockTokenRepository.AssertExpectations(t)
+		mockMailSender.AssertExpectations(t)
+		assert.Contains(t, mockMailSender.Calls[0].Arguments.String(3), "https://app.test/reset?token=")
+	})
+
+	t.Run("Suspend signs out every session", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		us := newService(mockUserRepository, mockTokenRepository, nil)
+
+		mockUserRepository.On("SetStatus", mock.Anything, uid, model.UserStatusSuspended).Return(nil)
+		revokes(mockTokenRepository)
+
+		err := us.Suspend(ctx, uid)
+		assert.NoError(t, err)
+		mockUserRepository.AssertExpectations(t)
+		mockTokenRepository.AssertExpectations(t)
+	})
+
+	t.Run("Suspend of unknown user", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		us := newService(mockUserRepository, mockTokenRepository, nil)
+
+		mockUserRepository.On("SetStatus", mock.Anything, uid, model.UserStatusSuspended).Return(apperrors.NewNotFound("uid", uid.String()))
+
+		err := us.Suspend(ctx, uid)
+		assert.Equal(t, http.StatusNotFound, apperrors.Status(err))
+		mockTokenRepository.AssertNotCalled(t, "DeleteUserRefreshToken", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Delete signs out every session", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		us := newService(mockUserRepository, mockTokenRepository, nil)
+
+		revokes(mockTokenRepository)
+		mockUserRepository.On("Delete", mock.Anything, uid).Return(nil)
+
+		err := us.Delete(ctx, uid)
+		assert.NoError(t, err)
+		mockUserRepository.AssertExpectations(t)
+		mockTokenRepository.AssertExpectations(t)
+	})
+
+	t.Run("Unsuspend", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		us := newService(mockUserRepository, nil, nil)
+
+		mockUserRepository.On("FindByID", mock.Anything, uid).Return(&model.User{UID: uid, Status: model.UserStatusSuspended}, nil)
+		mockUserRepository.On("SetStatus", mock.Anything, uid, model.UserStatusActive).Return(nil)
+
+		err := us.Unsuspend(ctx, uid)
+		assert.NoError(t, err)
+		mockUserRepository.AssertExpectations(t)
+	})
+
+	t.Run("Unsuspend keeps other statuses", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		us := newService(mockUserRepository, nil, nil)
+
+		mockUserRepository.On("FindByID", mock.Anything, uid).Return(&model.User{UID: uid, Status: model.UserStatusPendingVerification}, nil)
+
+		err := us.Unsuspend(ctx, uid)
+		assert.Equal(t, http.StatusBadRequest, apperrors.Status(err))
+		mockUserRepository.AssertNotCalled(t, "SetStatus", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestDeleteAccount(t *testing.T) {
+	ctx := context.TODO()
+	uid, _ := uuid.NewRandom()
+	hash := "2232269800b344a31f9a5b5ca6c91775dc30c5d856d1a89c011076c6437236a5.52fdfc072182654f163f5f0f9a621d729566c74d10037c4d7bbb0407d1e2c649"
+	grace := 30 * 24 * time.Hour
+
+	newService := func(ur *mocks.MockUserRepository, tr *mocks.MockTokenRepository) model.UserService {
+		return NewUserServices(&USConfig{
+			UserRepository:          ur,
+			TokenRepository:         tr,
+			IDTokenExpirationSecs:   900,
+			DeletionGracePeriodSecs: int64(grace / time.Second),
+		})
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		us := newService(mockUserRepository, mockTokenRepository)
+
+		mockUserRepository.On("FindByID", mock.Anything, uid).Return(&model.User{UID: uid, Password: hash}, nil)
+		mockUserRepository.On("ScheduleDeletion", mock.Anything, uid, mock.AnythingOfType("time.Time")).Return(nil)
+		mockTokenRepository.On("ListSessions", mock.Anything, uid.String()).Return([]*model.Session{{ID: "laptop"}}, nil)
+		mockTokenRepository.On("DeleteUserRefreshToken", mock.Anything, uid.String()).Return(nil)
+		mockTokenRepository.On("DenyTokens", mock.Anything, []string{"laptop"}, 900*time.Second).Return(nil)
+
+		deleteAt, err := us.DeleteAccount(ctx, uid, "correct-password")
+		assert.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(grace), deleteAt, 5*time.Second)
+		mockUserRepository.AssertExpectations(t)
+		mockTokenRepository.AssertExpectations(t)
+	})
+
+	t.Run("Error -> invalid password", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		mockTokenRepository := new(mocks.MockTokenRepository)
+		us := newService(mockUserRepository, mockTokenRepository)
+
+		mockUserRepository.On("FindByID", mock.Anything, uid).Return(&model.User{UID: uid, Password: hash}, nil)
+
+		_, err := us.DeleteAccount(ctx, uid, "incorrect-password")
+		assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+		mockUserRepository.AssertNotCalled(t, "ScheduleDeletion", mock.Anything, mock.Anything, mock.Anything)
+		mockTokenRepository.AssertNotCalled(t, "DeleteUserRefreshToken", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Signin within the grace period reactivates", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		us := newService(mockUserRepository, nil)
+
+		deletedAt := time.Now().Add(-grace + time.Hour)
+		mockUserRepository.On("FindByEmail", mock.Anything, "bob@bob.com").Return(&model.User{
+			UID:       uid,
+			Email:     "bob@bob.com",
+			Password:  hash,
+			Status:    model.UserStatusDeleted,
+			DeletedAt: &deletedAt,
+		}, nil)
+		mockUserRepository.On("CancelDeletion", mock.Anything, uid).Return(nil)
+
+		u := &model.User{Email: "bob@bob.com", Password: "correct-password"}
+		err := us.Signin(ctx, u, "10.0.0.1")
+		assert.NoError(t, err)
+		assert.Equal(t, model.UserStatusActive, u.Status)
+		assert.Nil(t, u.DeletedAt)
+		mockUserRepository.AssertExpectations(t)
+	})
+
+	t.Run("Signin after the grace period", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		us := newService(mockUserRepository, nil)
+
+		deletedAt := time.Now().Add(-grace - time.Hour)
+		mockUserRepository.On("FindByEmail", mock.Anything, "bob@bob.com").Return(&model.User{
+			UID:       uid,
+			Email:     "bob@bob.com",
+			Password:  hash,
+			Status:    model.UserStatusDeleted,
+			DeletedAt: &deletedAt,
+		}, nil)
+
+		err := us.Signin(ctx, &model.User{Email: "bob@bob.com", Password: "correct-password"}, "10.0.0.1")
+		assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+		mockUserRepository.AssertNotCalled(t, "CancelDeletion", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Purge after the grace period", func(t *testing.T) {
+		mockUserRepository := new(mocks.MockUserRepository)
+		us := newService(mockUserRepository, nil)
+
+		mockUserRepository.On("PurgeDeleted", mock.Anything, mock.AnythingOfType("time.Time")).Return(int64(2), nil)
+
+		n, err := us.PurgeDeletedAccounts(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+
+		before := mockUserRepository.Calls[0].Arguments.Get(1).(time.Time)
+		assert.WithinDuration(t, time.Now().Add(-grace), before, 5*time.Second)
+	})
+}
+
+func TestSigninStatus(t *testing.T) {
+	hash := "2232269800b344a31f9a5b5ca6c91775dc30c5d856d1a89c011076c6437236a5.52fdfc072182654f163f5f0f9a621d729566c74d10037c4d7bbb0407d1e2c649"
+
+	cases := []struct {
+		status string
+		code   int
+	}{
+		{model.UserStatusActive, http.StatusOK},
+		{model.UserStatusPendingVerification, http.StatusForbidden},
+		{model.UserStatusSuspended, http.StatusForbidden},
+		// deleted accounts look like unknown ones
+		{model.UserStatusDeleted, http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		mockUserRepository := new(mocks.MockUserRepository)
+		us := NewUserServices(&USConfig{UserRepository: mockUserRepository})
+
+		mockUserRepository.On("FindByEmail", mock.Anything, "bob@bob.com").Return(&model.User{
+			Email:    "bob@bob.com",
+			Password: hash,
+			Status:   c.status,
+		}, nil)
+
+		u := &model.User{Email: "bob@bob.com", Password: "correct-password"}
+		err := us.Signin(context.TODO(), u, "10.0.0.1")
+
+		if c.code == http.StatusOK {
+			assert.NoError(t, err, c.status)
+			assert.Equal(t, c.status, u.Status)
+			continue
+		}
+		assert.Equal(t, c.code, apperrors.Status(err), c.status)
+	}
+}
+
+func TestSigninLockout(t *testing.T) {
+	ctx := context.TODO()
+	email := "bob@bob.com"
+	ip := "10.0.0.1"
+	password := "correct-password"
+	hash := "2232269800b344a31f9a5b5ca6c91775dc30c5d856d1a89c011076c6437236a5.52fdfc072182654f163f5f0f9a621d729566c74d10037c4d7bbb0407d1e2c649"
+
+	newService := func(r *mocks.MockLoginAttemptRepository, ur *mocks.MockUserRepository) model.UserService {
+		return NewUserServices(&USConfig{
+			UserRepository:          ur,
+			LoginAttemptRepository:  r,
+			SigninMaxFailures:       5,
+			SigninIPMaxFailures:     100,
+			SigninFailureWindowSecs: 900,
+			SigninLockoutSecs:       900,
+		})
+	}
+
+	t.Run("Locked out email is refused before the password is checked", func(t *testing.T) {
+		r := new(mocks.MockLoginAttemptRepository)
+		ur := new(mocks.MockUserRepository)
+		r.On("LockedFor", mock.Anything, "email:bob@bob.com").Return(90*time.Second, nil)
+
+		err := newService(r, ur).Signin(ctx, &model.User{Email: "Bob@Bob.com", Password: password}, ip)
+
+		assert.Equal(t, http.StatusTooManyRequests, apperrors.Status(err))
+		retryAfter, ok := apperrors.RetryAfter(err)
+		assert.True(t, ok)
+		assert.Equal(t, 90, retryAfter)
+		ur.AssertNotCalled(t, "FindByEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Attempt within the delay is refused", func(t *testing.T) {
+		r := new(mocks.MockLoginAttemptRepository)
+		ur := new(mocks.MockUserRepository)
+		r.On("LockedFor", mock.Anything, mock.AnythingOfType("string")).Return(time.Duration(0), nil)
+		r.On("Failures", mock.Anything, "email:bob@bob.com", mock.AnythingOfType("time.Time"), 900*time.Second).
+			Return(int64(3), time.Now(), nil)
+
+		err := newService(r, ur).Signin(ctx, &model.User{Email: email, Password: password}, ip)
+
+		assert.Equal(t, http.StatusTooManyRequests, apperrors.Status(err))
+		ur.AssertNotCalled(t, "FindByEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Failure reaching the maximum locks the email out", func(t *testing.T) {
+		r := new(mocks.MockLoginAttemptRepository)
+		ur := new(mocks.MockUserRepository)
+		r.On("LockedFor", mock.Anything, mock.AnythingOfType("string")).Return(time.Duration(0), nil)
+		r.On("Failures", mock.Anything, "email:bob@bob.com", mock.AnythingOfType("time.Time"), 900*time.Second).
+			Return(int64(4), time.Now().Add(-time.Minute), nil)
+		r.On("AddFailure", mock.Anything, "email:bob@bob.com", mock.AnythingOfType("time.Time"), 900*time.Second).Return(int64(5), nil)
+		r.On("AddFailure", mock.Anything, "ip:10.0.0.1", mock.AnythingOfType("time.Time"), 900*time.Second).Return(int64(5), nil)
+		r.On("Lock", mock.Anything, "email:bob@bob.com", 900*time.Second).Return(nil)
+		ur.On("FindByEmail", mock.Anything, email).Return(&model.User{Email: email, Password: hash}, nil)
+
+		err := newService(r, ur).Signin(ctx, &model.User{Email: email, Password: "incorrect-password"}, ip)
+
+		assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+		r.AssertExpectations(t)
+		r.AssertNotCalled(t, "Lock", mock.Anything, "ip:10.0.0.1", mock.Anything)
+	})
+
+	t.Run("Lockout is recorded in the audit log", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		r := new(mocks.MockLoginAttemptRepository)
+		ur := new(mocks.MockUserRepository)
+		er := new(mocks.MockSecurityEventRepository)
+		r.On("LockedFor", mock.Anything, mock.AnythingOfType("string")).Return(time.Duration(0), nil)
+		r.On("Failures", mock.Anything, "email:bob@bob.com", mock.AnythingOfType("time.Time"), 900*time.Second).
+			Return(int64(4), time.Now().Add(-time.Minute), nil)
+		r.On("AddFailure", mock.Anything, "email:bob@bob.com", mock.AnythingOfType("time.Time"), 900*time.Second).Return(int64(5), nil)
+		r.On("AddFailure", mock.Anything, "ip:10.0.0.1", mock.AnythingOfType("time.Time"), 900*time.Second).Return(int64(5), nil)
+		r.On("Lock", mock.Anything, "email:bob@bob.com", 900*time.Second).Return(nil)
+		ur.On("FindByEmail", mock.Anything, email).Return(&model.User{UID: uid, Email: email, Password: hash}, nil)
+		er.On("Create", mock.Anything, mock.AnythingOfType("*model.SecurityEvent")).Return(nil)
+
+		us := NewUserServices(&USConfig{
+			UserRepository:          ur,
+			LoginAttemptRepository:  r,
+			SigninMaxFailures:       5,
+			SigninIPMaxFailures:     100,
+			SigninFailureWindowSecs: 900,
+			SigninLockoutSecs:       900,
+			SecurityEventRepository: er,
+		})
+
+		err := us.Signin(ctx, &model.User{Email: email, Password: "incorrect-password"}, ip)
+
+		assert.Equal(t, http.StatusUnauthorized, apperrors.Status(err))
+		er.AssertCalled(t, "Create", mock.Anything, mock.MatchedBy(func(e *model.SecurityEvent) bool {
+			return e.UID == uid && e.Type == model.EventAccountLocked && e.IP == ip
+		}))
+	})
+
+	t.Run("Success resets the failures of the email", func(t *testing.T) {
+		r := new(mocks.MockLoginAttemptRepository)
+		ur := new(mocks.MockUserRepository)
+		r.On("LockedFor", mock.Anything, mock.AnythingOfType("string")).Return(time.Duration(0), nil)
+		r.On("Failures", mock.Anything, "email:bob@bob.com", mock.AnythingOfType("time.Time"), 900*time.Second).
+			Return(int64(1), time.Now(), nil)
+		r.On("ResetFailures", mock.Anything, "email:bob@bob.com").Return(nil)
+		ur.On("FindByEmail", mock.Anything, email).Return(&model.User{Email: email, Password: hash}, nil)
+
+		err := newService(r, ur).Signin(ctx, &model.User{Email: email, Password: password}, ip)
+
+		assert.NoError(t, err)
+		r.AssertExpectations(t)
+	})
+
+	t.Run("Failures are kept until the totp challenge passed", func(t *testing.T) {
+		uid, _ := uuid.NewRandom()
+		r := new(mocks.MockLoginAttemptRepository)
+		ur := new(mocks.MockUserRepository)
+		mr := new(mocks.MockMFARepository)
+		r.On("LockedFor", mock.Anything, mock.AnythingOfType("string")).Return(time.Duration(0), nil)
+		r.On("Failures", mock.Anything, "email:bob@bob.com", mock.AnythingOfType("time.Time"), 900*time.Second).
+			Return(int64(1), time.Now(), nil)
+		ur.On("FindByEmail", mock.Anything, email).Return(&model.User{UID: uid, Email: email, Password: hash}, nil)
+		mr.On("FindTOTP", mock.Anything, uid).Return(&model.TOTP{UID: uid, Confirmed: true}, nil)
+
+		us := NewUserServices(&USConfig{
+			UserRepository:          ur,
+			LoginAttemptRepository:  r,
+			SigninMaxFailures:       5,
+			SigninIPMaxFailures:     100,
+			SigninFailureWindowSecs: 900,
+			SigninLockoutSecs:       900,
+			MFARepository:           mr,
+		})
+
+		err := us.Signin(ctx, &model.User{Email: email, Password: password}, ip)
+
+		assert.NoError(t, err)
+		r.AssertNotCalled(t, "ResetFailures", mock.Anything, mock.Anything)
+	})
+}
+
+func TestSigninDelay(t *testing.T) {
+	for failures, want := range map[int64]time.Duration{
+		0:  0,
+		1:  0,
+		2:  time.Second,
+		3:  2 * time.Second,
+		5:  8 * time.Second,
+		40: 30 * time.Second,
+	} {
+		assert.Equal(t, want, signinDelay(failures), failures)
+	}
+}
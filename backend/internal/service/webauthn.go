@@ -0,0 +1,205 @@
+package service
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// authenticator data flags, https://www.w3.org/TR/webauthn-2/#sctn-authenticator-data
+const (
+	authDataFlagUserPresent  = 0x01
+	authDataFlagUserVerified = 0x04
+	authDataFlagAttested     = 0x40
+)
+
+// COSE algorithms supported for credential public keys
+const (
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+// COSE key parameters
+const (
+	coseKeyKty     = 1
+	coseKeyAlg     = 3
+	coseKeyCrv     = -1
+	coseKeyX       = -2
+	coseKeyY       = -3
+	coseKeyRSAN    = -1
+	coseKeyRSAE    = -2
+	coseKtyOKP     = 1
+	coseKtyEC2     = 2
+	coseKtyRSA     = 3
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+type webAuthnClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type webAuthnAttestationObject struct {
+	Fmt      string          `cbor:"fmt"`
+	AttStmt  cbor.RawMessage `cbor:"attStmt"`
+	AuthData []byte          `cbor:"authData"`
+}
+
+type webAuthnAuthData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+type webAuthnPublicKey struct {
+	Alg int
+	Key crypto.PublicKey
+}
+
+// decodeBase64URL accepts base64url with or without padding as sent by browsers
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func parseClientData(raw []byte) (*webAuthnClientData, error) {
+	cd := new(webAuthnClientData)
+	if err := json.Unmarshal(raw, cd); err != nil {
+		return nil, fmt.Errorf("invalid client data: %w", err)
+	}
+	return cd, nil
+}
+
+// parseAuthData parses authenticator data, the attested credential data
+// is read when the attested flag is set
+func parseAuthData(b []byte) (*webAuthnAuthData, error) {
+	if len(b) < 37 {
+		return nil, fmt.Errorf("authenticator data is too short")
+	}
+
+	ad := &webAuthnAuthData{
+		RPIDHash:  b[:32],
+		Flags:     b[32],
+		SignCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+
+	if ad.Flags&authDataFlagAttested == 0 {
+		return ad, nil
+	}
+
+	rest := b[37:]
+	// aaguid (16) and credential id length (2)
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("attested credential data is too short")
+	}
+
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return nil, fmt.Errorf("credential id is too short")
+	}
+
+	ad.CredentialID = rest[:idLen]
+
+	// the public key is followed by optional extensions, decode one cbor item
+	var key cbor.RawMessage
+	if err := cbor.NewDecoder(bytes.NewReader(rest[idLen:])).Decode(&key); err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %w", err)
+	}
+	ad.PublicKey = key
+
+	return ad, nil
+}
+
+func parseCOSEKey(raw []byte) (*webAuthnPublicKey, error) {
+	var m map[int]interface{}
+	if err := cbor.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("invalid cose key: %w", err)
+	}
+
+	kty, _ := coseInt(m[coseKeyKty])
+	alg, _ := coseInt(m[coseKeyAlg])
+
+	switch {
+	case kty == coseKtyEC2 && alg == coseAlgES256:
+		crv, _ := coseInt(m[coseKeyCrv])
+		x, _ := m[coseKeyX].([]byte)
+		y, _ := m[coseKeyY].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid ec2 cose key")
+		}
+
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("ec2 cose key is not on curve")
+		}
+		return &webAuthnPublicKey{Alg: alg, Key: pub}, nil
+
+	case kty == coseKtyRSA && alg == coseAlgRS256:
+		n, _ := m[coseKeyRSAN].([]byte)
+		e, _ := m[coseKeyRSAE].([]byte)
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid rsa cose key")
+		}
+
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		return &webAuthnPublicKey{Alg: alg, Key: pub}, nil
+
+	case kty == coseKtyOKP && alg == coseAlgEdDSA:
+		crv, _ := coseInt(m[coseKeyCrv])
+		x, _ := m[coseKeyX].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid okp cose key")
+		}
+		return &webAuthnPublicKey{Alg: alg, Key: ed25519.PublicKey(x)}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported cose key kty: %d, alg: %d", kty, alg)
+}
+
+func coseInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int64:
+		return int(n), true
+	case uint64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+func (k *webAuthnPublicKey) verify(data, sig []byte) bool {
+	switch pub := k.Key.(type) {
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(pub, sum[:], sig)
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, data, sig)
+	}
+	return false
+}
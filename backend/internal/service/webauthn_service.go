@@ -0,0 +1,348 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"time"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	purposeWebAuthnRegister = "webauthn_register"
+	purposeWebAuthnLogin    = "webauthn_login"
+)
+
+type webAuthnService struct {
+	WebAuthnRepository      model.WebAuthnRepository
+	UserRepository          model.UserRepository
+	TokenRepository         model.TokenRepository
+	RPID                    string
+	RPName                  string
+	Origin                  string
+	Timeout                 time.Duration
+	SecurityEventRepository model.SecurityEventRepository
+}
+
+type WebAuthnConfig struct {
+	WebAuthnRepository model.WebAuthnRepository
+	UserRepository     model.UserRepository
+	TokenRepository    model.TokenRepository
+	// RPID is the relying party id, the effective domain of the Origin
+	RPID        string
+	RPName      string
+	Origin      string
+	TimeoutSecs int64
+	// SecurityEventRepository records registered passkeys in the audit log, nil disables it
+	SecurityEventRepository model.SecurityEventRepository
+}
+
+func NewWebAuthnService(c *WebAuthnConfig) model.WebAuthnService {
+	return &webAuthnService{
+		WebAuthnRepository:      c.WebAuthnRepository,
+		UserRepository:          c.UserRepository,
+		TokenRepository:         c.TokenRepository,
+		RPID:                    c.RPID,
+		RPName:                  c.RPName,
+		Origin:                  c.Origin,
+		Timeout:                 time.Duration(c.TimeoutSecs) * time.Second,
+		SecurityEventRepository: c.SecurityEventRepository,
+	}
+}
+
+// BeginRegistration creates options for registering a new credential of the signed in user
+func (s *webAuthnService) BeginRegistration(ctx context.Context, u *model.User) (*model.WebAuthnCreationOptions, error) {
+	challenge, err := s.newChallenge(ctx, purposeWebAuthnRegister, u.UID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := s.descriptors(ctx, u.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.WebAuthnCreationOptions{
+		Challenge: challenge,
+		RP: model.WebAuthnRelyingParty{
+			ID:   s.RPID,
+			Name: s.RPName,
+		},
+		User: model.WebAuthnUserEntity{
+			ID:          base64.RawURLEncoding.EncodeToString(u.UID[:]),
+			Name:        u.Email,
+			DisplayName: u.Name,
+		},
+		PubKeyCredParams: []model.WebAuthnCredentialParameter{
+			{Type: "public-key", Alg: coseAlgES256},
+			{Type: "public-key", Alg: coseAlgEdDSA},
+			{Type: "public-key", Alg: coseAlgRS256},
+		},
+		Timeout:            s.Timeout.Milliseconds(),
+		Attestation:        "none",
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: model.WebAuthnAuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "required",
+		},
+	}, nil
+}
+
+// FinishRegistration verifies the attestation and stores the credential.
+// Attestation statements are not verified, as "none" conveyance is requested
+func (s *webAuthnService) FinishRegistration(ctx context.Context, uid uuid.UUID, a *model.WebAuthnAttestation) error {
+	errVerification := apperrors.NewBadRequest("webauthn registration verification failed")
+
+	clientDataJSON, err := decodeBase64URL(a.ClientDataJSON)
+	if err != nil {
+		logger.Warn("webauthn registration, invalid client data encoding: %v", err)
+		return errVerification
+	}
+
+	if err := s.checkClientData(ctx, clientDataJSON, "webauthn.create", purposeWebAuthnRegister, uid.String()); err != nil {
+		logger.Warn("webauthn registration for uid: %v, err: %v", uid, err)
+		return errVerification
+	}
+
+	rawAttestation, err := decodeBase64URL(a.AttestationObject)
+	if err != nil {
+		logger.Warn("webauthn registration, invalid attestation encoding: %v", err)
+		return errVerification
+	}
+
+	var attestation webAuthnAttestationObject
+	if err := cbor.Unmarshal(rawAttestation, &attestation); err != nil {
+		logger.Warn("webauthn registration, invalid attestation object: %v", err)
+		return errVerification
+	}
+
+	ad, err := parseAuthData(attestation.AuthData)
+	if err != nil {
+		logger.Warn("webauthn registration, invalid authenticator data: %v", err)
+		return errVerification
+	}
+
+	if err := s.checkAuthData(ad); err != nil {
+		logger.Warn("webauthn registration for uid: %v, err: %v", uid, err)
+		return errVerification
+	}
+
+	if ad.Flags&authDataFlagAttested == 0 {
+		logger.Warn("webauthn registration for uid: %v without attested credential data", uid)
+		return errVerification
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(ad.CredentialID)
+	if credentialID != a.ID {
+		logger.Warn("webauthn registration for uid: %v, credential id mismatch", uid)
+		return errVerification
+	}
+
+	if _, err := parseCOSEKey(ad.PublicKey); err != nil {
+		logger.Warn("webauthn registration for uid: %v, err: %v", uid, err)
+		return errVerification
+	}
+
+	if err := s.WebAuthnRepository.Create(ctx, &model.WebAuthnCredential{
+		ID:        credentialID,
+		UID:       uid,
+		PublicKey: ad.PublicKey,
+		SignCount: int64(ad.SignCount),
+	}); err != nil {
+		return err
+	}
+
+	recordEvent(ctx, s.SecurityEventRepository, uid, model.EventPasskeyRegistered, nil)
+	return nil
+}
+
+// BeginLogin creates options for an assertion. With an empty email
+// the authenticator picks a discoverable credential
+func (s *webAuthnService) BeginLogin(ctx context.Context, email string) (*model.WebAuthnRequestOptions, error) {
+	userID := ""
+	allow := []model.WebAuthnCredentialDescriptor{}
+
+	if email != "" {
+		if u, err := s.UserRepository.FindByEmail(ctx, email); err == nil {
+			userID = u.UID.String()
+			if allow, err = s.descriptors(ctx, u.UID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	challenge, err := s.newChallenge(ctx, purposeWebAuthnLogin, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.WebAuthnRequestOptions{
+		Challenge:        challenge,
+		RPID:             s.RPID,
+		Timeout:          s.Timeout.Milliseconds(),
+		AllowCredentials: allow,
+		UserVerification: "required",
+	}, nil
+}
+
+// FinishLogin verifies the assertion signature and returns the uid of the credential owner
+func (s *webAuthnService) FinishLogin(ctx context.Context, a *model.WebAuthnAssertion) (uuid.UUID, error) {
+	errVerification := apperrors.NewAuthorization("webauthn login verification failed")
+
+	cred, err := s.WebAuthnRepository.FindByID(ctx, a.ID)
+	if err != nil {
+		return uuid.Nil, errVerification
+	}
+
+	clientDataJSON, err := decodeBase64URL(a.ClientDataJSON)
+	if err != nil {
+		logger.Warn("webauthn login, invalid client data encoding: %v", err)
+		return uuid.Nil, errVerification
+	}
+
+	if err := s.checkClientData(ctx, clientDataJSON, "webauthn.get", purposeWebAuthnLogin, cred.UID.String()); err != nil {
+		logger.Warn("webauthn login for uid: %v, err: %v", cred.UID, err)
+		return uuid.Nil, errVerification
+	}
+
+	if a.UserHandle != "" {
+		userHandle, err := decodeBase64URL(a.UserHandle)
+		if err != nil || !bytes.Equal(userHandle, cred.UID[:]) {
+			logger.Warn("webauthn login for uid: %v, user handle mismatch", cred.UID)
+			return uuid.Nil, errVerification
+		}
+	}
+
+	rawAuthData, err := decodeBase64URL(a.AuthenticatorData)
+	if err != nil {
+		logger.Warn("webauthn login, invalid authenticator data encoding: %v", err)
+		return uuid.Nil, errVerification
+	}
+
+	ad, err := parseAuthData(rawAuthData)
+	if err != nil {
+		logger.Warn("webauthn login, invalid authenticator data: %v", err)
+		return uuid.Nil, errVerification
+	}
+
+	if err := s.checkAuthData(ad); err != nil {
+		logger.Warn("webauthn login for uid: %v, err: %v", cred.UID, err)
+		return uuid.Nil, errVerification
+	}
+
+	sig, err := decodeBase64URL(a.Signature)
+	if err != nil {
+		logger.Warn("webauthn login, invalid signature encoding: %v", err)
+		return uuid.Nil, errVerification
+	}
+
+	pub, err := parseCOSEKey(cred.PublicKey)
+	if err != nil {
+		logger.Error("webauthn login, stored key of credential: %s is invalid: %v", cred.ID, err)
+		return uuid.Nil, apperrors.NewInternal()
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if !pub.verify(signed, sig) {
+		logger.Warn("webauthn login for uid: %v, invalid signature", cred.UID)
+		return uuid.Nil, errVerification
+	}
+
+	// a counter which does not grow signals a cloned authenticator,
+	// authenticators without a counter always send zero
+	signCount := int64(ad.SignCount)
+	if (signCount != 0 || cred.SignCount != 0) && signCount <= cred.SignCount {
+		logger.Error("webauthn login for uid: %v, sign count of credential: %s did not increase, possible cloned authenticator", cred.UID, cred.ID)
+		return uuid.Nil, errVerification
+	}
+
+	if err := s.WebAuthnRepository.UpdateSignCount(ctx, cred.ID, signCount); err != nil {
+		return uuid.Nil, err
+	}
+
+	return cred.UID, nil
+}
+
+func (s *webAuthnService) newChallenge(ctx context.Context, purpose, userID string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		logger.Warn("unable to generate webauthn challenge: %v", err)
+		return "", apperrors.NewInternal()
+	}
+
+	challenge := base64.RawURLEncoding.EncodeToString(b)
+	if err := s.TokenRepository.SetOneTimeToken(ctx, purpose, hashOneTimeToken(challenge), userID, s.Timeout); err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+// checkClientData consumes the challenge and checks it was issued for userID,
+// a challenge issued for nobody (discoverable login) matches any user
+func (s *webAuthnService) checkClientData(ctx context.Context, raw []byte, ceremony, purpose, userID string) error {
+	cd, err := parseClientData(raw)
+	if err != nil {
+		return err
+	}
+
+	if cd.Type != ceremony {
+		return apperrors.NewBadRequest("unexpected client data type: " + cd.Type)
+	}
+
+	if cd.Origin != s.Origin {
+		return apperrors.NewBadRequest("unexpected origin: " + cd.Origin)
+	}
+
+	issuedFor, err := s.TokenRepository.ConsumeOneTimeToken(ctx, purpose, hashOneTimeToken(cd.Challenge))
+	if err != nil {
+		return err
+	}
+
+	if issuedFor != "" && issuedFor != userID {
+		return apperrors.NewBadRequest("challenge was issued for another user")
+	}
+
+	return nil
+}
+
+func (s *webAuthnService) checkAuthData(ad *webAuthnAuthData) error {
+	rpIDHash := sha256.Sum256([]byte(s.RPID))
+	if !bytes.Equal(ad.RPIDHash, rpIDHash[:]) {
+		return apperrors.NewBadRequest("rp id hash mismatch")
+	}
+
+	if ad.Flags&authDataFlagUserPresent == 0 {
+		return apperrors.NewBadRequest("user not present")
+	}
+
+	// a passkey login skips the password and the totp code,
+	// the authenticator has to verify the user by pin or biometrics
+	if ad.Flags&authDataFlagUserVerified == 0 {
+		return apperrors.NewBadRequest("user not verified")
+	}
+
+	return nil
+}
+
+func (s *webAuthnService) descriptors(ctx context.Context, uid uuid.UUID) ([]model.WebAuthnCredentialDescriptor, error) {
+	credentials, err := s.WebAuthnRepository.FindByUID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptors := make([]model.WebAuthnCredentialDescriptor, 0, len(credentials))
+	for _, c := range credentials {
+		descriptors = append(descriptors, model.WebAuthnCredentialDescriptor{Type: "public-key", ID: c.ID})
+	}
+
+	return descriptors, nil
+}
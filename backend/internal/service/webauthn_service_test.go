@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/Kara4ev/go-web-tmp/internal/model"
+	"github.com/Kara4ev/go-web-tmp/internal/model/apperrors"
+	"github.com/Kara4ev/go-web-tmp/internal/model/mocks"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// softAuthenticator is an in memory ES256 authenticator
+// producing the same structures as a platform authenticator
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	rpID         string
+	origin       string
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T, rpID, origin string) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return &softAuthenticator{key: key, credentialID: id, rpID: rpID, origin: origin}
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony, challenge string) []byte {
+	b, err := json.Marshal(webAuthnClientData{Type: ceremony, Challenge: challenge, Origin: a.origin})
+	assert.NoError(t, err)
+	return b
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, a.signCount)
+
+	b := append(rpIDHash[:], flags)
+	b = append(b, counter...)
+	return append(b, attested...)
+}
+
+func (a *softAuthenticator) create(t *testing.T, challenge string) *model.WebAuthnAttestation {
+	coseKey, err := cbor.Marshal(map[int]interface{}{
+		coseKeyKty: coseKtyEC2,
+		coseKeyAlg: coseAlgES256,
+		coseKeyCrv: coseCrvP256,
+		coseKeyX:   a.key.X.FillBytes(make([]byte, 32)),
+		coseKeyY:   a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	assert.NoError(t, err)
+
+	idLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(idLen, uint16(len(a.credentialID)))
+
+	attested := append(make([]byte, 16), idLen...)
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, coseKey...)
+
+	attestationObject, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(authDataFlagUserPresent|authDataFlagUserVerified|authDataFlagAttested, attested),
+	})
+	assert.NoError(t, err)
+
+	return &model.WebAuthnAttestation{
+		ID:                base64.RawURLEncoding.EncodeToString(a.credentialID),
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(a.clientData(t, "webauthn.create", challenge)),
+		AttestationObject: base64.RawURLEncoding.EncodeToString(attestationObject),
+	}
+}
+
+func (a *softAuthenticator) get(t *testing.T, challenge string) *model.WebAuthnAssertion {
+	return a.getWithFlags(t, challenge, authDataFlagUserPresent|authDataFlagUserVerified)
+}
+
+func (a *softAuthenticator) getWithFlags(t *testing.T, challenge string, flags byte) *model.WebAuthnAssertion {
+	a.signCount++
+	authData := a.authData(flags, nil)
+	clientData := a.clientData(t, "webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+
+	sum := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, sum[:])
+	assert.NoError(t, err)
+
+	return &model.WebAuthnAssertion{
+		ID:                base64.RawURLEncoding.EncodeToString(a.credentialID),
+		ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientData),
+		AuthenticatorData: base64.RawURLEncoding.EncodeToString(authData),
+		Signature:         base64.RawURLEncoding.EncodeToString(sig),
+	}
+}
+
+func TestWebAuthnCeremonies(t *testing.T) {
+	rpID := "malcorp.test"
+	origin := "http://malcorp.test"
+
+	uid, _ := uuid.NewRandom()
+	u := &model.User{UID: uid, Email: "bob@bob.com"}
+
+	mockWebAuthnRepository := new(mocks.MockWebAuthnRepository)
+	mockTokenRepository := new(mocks.MockTokenRepository)
+
+	ws := NewWebAuthnService(&WebAuthnConfig{
+		WebAuthnRepository: mockWebAuthnRepository,
+		TokenRepository:    mockTokenRepository,
+		RPID:               rpID,
+		RPName:             "Go TDS",
+		Origin:             origin,
+		TimeoutSecs:        300,
+	})
+
+	mockTokenRepository.
+		On("SetOneTimeToken", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.Anything).
+		Return(nil)
+
+	var stored *model.WebAuthnCredential
+	mockWebAuthnRepository.On("FindByUID", mock.Anything, uid).Return([]*model.WebAuthnCredential{}, nil)
+	mockWebAuthnRepository.
+		On("Create", mock.Anything, mock.AnythingOfType("*model.WebAuthnCredential")).
+		Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*model.WebAuthnCredential)
+		}).
+		Return(nil)
+
+	authenticator := newSoftAuthenticator(t, rpID, origin)
+
+	t.Run("Registration", func(t *testing.T) {
+		options, err := ws.BeginRegistration(context.TODO(), u)
+		assert.NoError(t, err)
+		assert.Equal(t, rpID, options.RP.ID)
+
+		mockTokenRepository.
+			On("ConsumeOneTimeToken", mock.Anything, purposeWebAuthnRegister, hashOneTimeToken(options.Challenge)).
+			Return(uid.String(), nil).
+			Once()
+
+		err = ws.FinishRegistration(context.TODO(), uid, authenticator.create(t, options.Challenge))
+		assert.NoError(t, err)
+
+		assert.NotNil(t, stored)
+		assert.Equal(t, uid, stored.UID)
+		assert.Equal(t, base64.RawURLEncoding.EncodeToString(authenticator.credentialID), stored.ID)
+	})
+
+	t.Run("Registration with wrong origin", func(t *testing.T) {
+		options, err := ws.BeginRegistration(context.TODO(), u)
+		assert.NoError(t, err)
+
+		phishing := newSoftAuthenticator(t, rpID, "http://phishing.test")
+		err = ws.FinishRegistration(context.TODO(), uid, phishing.create(t, options.Challenge))
+		assert.Error(t, err)
+	})
+
+	t.Run("Login", func(t *testing.T) {
+		mockWebAuthnRepository.On("FindByID", mock.Anything, stored.ID).Return(stored, nil)
+		mockWebAuthnRepository.On("UpdateSignCount", mock.Anything, stored.ID, int64(1)).Return(nil)
+
+		options, err := ws.BeginLogin(context.TODO(), "")
+		assert.NoError(t, err)
+
+		mockTokenRepository.
+			On("ConsumeOneTimeToken", mock.Anything, purposeWebAuthnLogin, hashOneTimeToken(options.Challenge)).
+			Return("", nil).
+			Once()
+
+		actual, err := ws.FinishLogin(context.TODO(), authenticator.get(t, options.Challenge))
+		assert.NoError(t, err)
+		assert.Equal(t, uid, actual)
+		mockWebAuthnRepository.AssertCalled(t, "UpdateSignCount", mock.Anything, stored.ID, int64(1))
+	})
+
+	t.Run("Login with replayed challenge", func(t *testing.T) {
+		options, err := ws.BeginLogin(context.TODO(), "")
+		assert.NoError(t, err)
+
+		assertion := authenticator.get(t, options.Challenge)
+		mockTokenRepository.
+			On("ConsumeOneTimeToken", mock.Anything, purposeWebAuthnLogin, hashOneTimeToken(options.Challenge)).
+			Return("", apperrors.NewNotFound("token", options.Challenge)).
+			Once()
+
+		_, err = ws.FinishLogin(context.TODO(), assertion)
+		assert.Error(t, err)
+	})
+
+	t.Run("Login with a forged signature", func(t *testing.T) {
+		options, err := ws.BeginLogin(context.TODO(), "")
+		assert.NoError(t, err)
+
+		mockTokenRepository.
+			On("ConsumeOneTimeToken", mock.Anything, purposeWebAuthnLogin, hashOneTimeToken(options.Challenge)).
+			Return("", nil).
+			Once()
+
+		forged := newSoftAuthenticator(t, rpID, origin)
+		forged.credentialID = authenticator.credentialID
+
+		_, err = ws.FinishLogin(context.TODO(), forged.get(t, options.Challenge))
+		assert.Error(t, err)
+	})
+
+	t.Run("Login without user verification", func(t *testing.T) {
+		options, err := ws.BeginLogin(context.TODO(), "")
+		assert.NoError(t, err)
+		assert.Equal(t, "required", options.UserVerification)
+
+		mockTokenRepository.
+			On("ConsumeOneTimeToken", mock.Anything, purposeWebAuthnLogin, hashOneTimeToken(options.Challenge)).
+			Return("", nil).
+			Once()
+
+		_, err = ws.FinishLogin(context.TODO(), authenticator.getWithFlags(t, options.Challenge, authDataFlagUserPresent))
+		assert.Error(t, err)
+	})
+}
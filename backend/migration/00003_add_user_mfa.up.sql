@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+  uid uuid PRIMARY KEY REFERENCES users (uid) ON DELETE CASCADE,
+  secret VARCHAR NOT NULL,
+  confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+  id BIGSERIAL PRIMARY KEY,
+  uid uuid NOT NULL REFERENCES users (uid) ON DELETE CASCADE,
+  code_hash VARCHAR NOT NULL,
+  used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS user_recovery_codes_uid_idx ON user_recovery_codes (uid);
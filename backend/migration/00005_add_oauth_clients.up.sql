@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS oauth_clients (
+  id VARCHAR PRIMARY KEY,
+  name VARCHAR NOT NULL,
+  redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+  scopes TEXT[] NOT NULL DEFAULT '{openid}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS service_accounts (
+  id VARCHAR PRIMARY KEY,
+  name VARCHAR NOT NULL,
+  secret VARCHAR NOT NULL,
+  scopes TEXT[] NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS roles (
+  name VARCHAR PRIMARY KEY,
+  description VARCHAR NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+  name VARCHAR PRIMARY KEY,
+  description VARCHAR NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+  role VARCHAR NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+  permission VARCHAR NOT NULL REFERENCES permissions (name) ON DELETE CASCADE,
+  PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+  uid uuid NOT NULL REFERENCES users (uid) ON DELETE CASCADE,
+  role VARCHAR NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (uid, role)
+);
+
+CREATE INDEX IF NOT EXISTS user_roles_role_idx ON user_roles (role);
+
+INSERT INTO roles (name, description) VALUES
+  ('admin', 'manages users')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+  ('users:read', 'list and view users'),
+  ('users:write', 'update, suspend and delete users')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+  ('admin', 'users:read'),
+  ('admin', 'users:write')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS users_status_idx;
+
+ALTER TABLE users
+  DROP CONSTRAINT IF EXISTS users_status_check,
+  DROP COLUMN IF EXISTS status;
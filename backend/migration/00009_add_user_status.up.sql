@@ -0,0 +1,6 @@
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS status VARCHAR NOT NULL DEFAULT 'active',
+  ADD CONSTRAINT users_status_check
+  CHECK (status IN ('active', 'pending_verification', 'suspended', 'deleted'));
+
+CREATE INDEX IF NOT EXISTS users_status_idx ON users (status);
@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/Kara4ev/go-web-tmp/pkg/logger"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	From     string
+}
+
+// SMTPSender sends plain text mails through an smtp relay
+type SMTPSender struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTP(c SMTPConfig) *SMTPSender {
+	var auth smtp.Auth
+	if c.User != "" {
+		auth = smtp.PlainAuth("", c.User, c.Password, c.Host)
+	}
+
+	return &SMTPSender{
+		addr: net.JoinHostPort(c.Host, c.Port),
+		auth: auth,
+		from: c.From,
+	}
+}
+
+func (s *SMTPSender) Send(ctx context.Context, to, subject, body string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	msg := strings.Join([]string{
+		fmt.Sprintf("From: %s", s.from),
+		fmt.Sprintf("To: %s", to),
+		fmt.Sprintf("Subject: %s", subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=\"utf-8\"",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("error send mail to %s: %w", to, err)
+	}
+
+	return nil
+}
+
+// LogSender writes mails to the application log instead of delivering them,
+// used for local development when no smtp relay is configured
+type LogSender struct{}
+
+func NewLog() *LogSender {
+	return &LogSender{}
+}
+
+func (s *LogSender) Send(ctx context.Context, to, subject, body string) error {
+	logger.Info("mail to: %s, subject: %s, body: %s", to, subject, body)
+	return nil
+}